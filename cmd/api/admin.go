@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type PingRequest struct {
+	Address string `json:"address"`
+}
+
+type LookupRequest struct {
+	ID string `json:"id"`
+}
+
+type ContactResponse struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Distance string `json:"distance"`
+}
+
+type LookupResponse struct {
+	Target   string                 `json:"target"`
+	Contacts []ContactResponse      `json:"contacts"`
+	Report   *kademlia.LookupReport `json:"report"`
+}
+
+// writeJSON writes `value` as the JSON body of the response with `status`
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// NodeHandler returns the ID, address, uptime and config of the node
+func NodeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, node.Info())
+}
+
+// RoutingTableHandler returns the contacts of every non empty bucket
+func RoutingTableHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, node.RT.Buckets())
+}
+
+// StoreHandler returns the keys in the local store with their expiry
+func StoreHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, node.StoreEntries())
+}
+
+// PingHandler pings the address given in the body
+func PingHandler(w http.ResponseWriter, r *http.Request) {
+	body := PingRequest{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	_, _, err = net.SplitHostPort(body.Address)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	result, err := node.PingAddress(body.Address)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, ErrorResponse{err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// LookupHandler runs a NodeLookup for the ID given in the body
+func LookupHandler(w http.ResponseWriter, r *http.Request) {
+	body := LookupRequest{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	target, err := kademlia.ParseNodeID(body.ID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	contacts, report := node.NodeLookupWithReport(target)
+
+	res := LookupResponse{target.String(), []ContactResponse{}, report}
+	for _, contact := range contacts {
+		res.Contacts = append(res.Contacts, ContactResponse{
+			contact.ID.String(),
+			contact.Address,
+			contact.ID.CalcDistance(target).String(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+func newTestNode() *kademlia.Node {
+	n := &kademlia.Node{}
+	n.RT = kademlia.NewRoutingTable(kademlia.NewContact(kademlia.NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	n.RT.AddContact(kademlia.NewContact(kademlia.NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080"))
+	return n
+}
+
+func TestNodeHandler(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	NodeHandler(recorder, httptest.NewRequest("GET", "/node", nil))
+
+	info := kademlia.NodeInfo{}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &info))
+	assert.Equal(t, "00000000000000000000000000000000ffffffff", info.ID)
+	assert.Equal(t, "10.0.8.1:8080", info.Address)
+	assert.Equal(t, kademlia.BucketSize, info.Config.BucketSize)
+}
+
+func TestRoutingTableHandler(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	RoutingTableHandler(recorder, httptest.NewRequest("GET", "/routing-table", nil))
+
+	buckets := []kademlia.BucketInfo{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &buckets))
+	assert.Equal(t, 1, len(buckets))
+	assert.Equal(t, 3, buckets[0].Index)
+	assert.Equal(t, "1111111100000000000000000000000000000000", buckets[0].Contacts[0].ID)
+	assert.False(t, buckets[0].Contacts[0].LastSeen.IsZero())
+}
+
+func TestStoreHandler(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	StoreHandler(recorder, httptest.NewRequest("GET", "/store", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "[]\n", recorder.Body.String())
+}
+
+func TestPingHandlerBadRequest(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	PingHandler(recorder, httptest.NewRequest("POST", "/ping", strings.NewReader(`{"address": "10.0.8.2"}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	PingHandler(recorder, httptest.NewRequest("POST", "/ping", strings.NewReader(`not json`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestLookupHandlerBadRequest(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	LookupHandler(recorder, httptest.NewRequest("POST", "/lookup", strings.NewReader(`{"id": "abcd"}`)))
+
+	res := ErrorResponse{}
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	assert.NotEqual(t, "", res.Error)
+}
@@ -2,44 +2,93 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+	"github.com/viktorfrom/d7024e-kademlia/internal/metrics"
 )
 
 type Response struct {
-	Location string `json:"location"`
-	Value    string `json:"value"`
+	Location string                 `json:"location"`
+	Value    string                 `json:"value"`
+	Report   *kademlia.LookupReport `json:"report,omitempty"`
+	Store    *kademlia.StoreResult  `json:"store,omitempty"`
 }
 
+const errBadQuorum string = "quorum must be at least 1"
+
 type Body struct {
 	Value string `json:"value"`
 }
 
-var node kademlia.Node
+var node *kademlia.Node
 
-func API(output io.Writer, n kademlia.Node) {
+func API(output io.Writer, n *kademlia.Node) {
 	fmt.Println("Starting REST API")
 	node = n
+	apiToken = os.Getenv(EnvAPIToken)
+	node.RegisterMetrics(metrics.DefaultRegistry)
 
 	r := mux.NewRouter()
 	r.HandleFunc("/objects/{hash}", GetHandler).Methods("GET")
+	r.HandleFunc("/objects/{hash}/watch", WatchHandler).Methods("GET")
 	r.HandleFunc("/objects", PostHandler).Methods("POST")
+	r.HandleFunc("/objects/batch", BatchHandler).Methods("POST")
+	r.HandleFunc("/objects/query", QueryHandler).Methods("POST")
+	r.HandleFunc("/objects/{hash}", authorized(DeleteHandler)).Methods("DELETE")
+	r.HandleFunc("/files", PutFileHandler).Methods("PUT")
+	r.HandleFunc("/files/{hash}", GetFileHandler).Methods("GET")
+	r.HandleFunc("/providers/{hash}", GetProvidersHandler).Methods("GET")
+	r.HandleFunc("/providers/{hash}", ProvideHandler).Methods("POST")
+	r.HandleFunc("/topics/{topic}", PublishHandler).Methods("POST")
+	r.HandleFunc("/topics/{topic}/events", EventsHandler).Methods("GET")
+	r.HandleFunc("/records/{key}", GetRecordHandler).Methods("GET")
+	r.HandleFunc("/records/{name}", authorized(PutRecordHandler)).Methods("PUT")
+	r.HandleFunc("/records/{name}", authorized(DeleteRecordHandler)).Methods("DELETE")
+	r.HandleFunc("/names", authorized(NewNameHandler)).Methods("POST")
+	r.HandleFunc("/names/{key}", GetNameHandler).Methods("GET")
+	r.HandleFunc("/names/{key}", authorized(PutNameHandler)).Methods("PUT")
+	r.Handle("/metrics", metrics.DefaultRegistry.Handler()).Methods("GET")
+	r.HandleFunc("/node", NodeHandler).Methods("GET")
+	r.HandleFunc("/routing-table", RoutingTableHandler).Methods("GET")
+	r.HandleFunc("/store", authorized(StoreHandler)).Methods("GET")
+	r.HandleFunc("/ping", authorized(PingHandler)).Methods("POST")
+	r.HandleFunc("/lookup", authorized(LookupHandler)).Methods("POST")
 	http.Handle("/", r)
 	log.Fatal(http.ListenAndServe(":3000", r))
 }
 
 func GetHandler(w http.ResponseWriter, r *http.Request) {
-	hash := strings.Split(r.URL.Path, "/")[2]
+	// the hash is either a SHA-1 hash or a multihash
+	hash, err := kademlia.NormalizeHash(strings.Split(r.URL.Path, "/")[2])
+
+	// ?quorum=N reads N replicas and returns the report telling whether they disagreed
+	quorum := 1
+	if err == nil {
+		quorum, err = parseQuorum(r, 1)
+	}
 
-	if len(hash) != 40 {
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
+	} else if r.URL.Query().Get("debug") == "true" || quorum > 1 {
+		value, report, err := node.FindValueQuorum(hash, quorum)
+
+		// the report is returned even if no value was found
+		if err != nil {
+			fmt.Println(err.Error())
+			w.WriteHeader(http.StatusNotFound)
+		}
+		res := Response{"/objects/" + hash, value, report, nil}
+		json.NewEncoder(w).Encode(res)
 	} else {
 		value, err := node.FindValue(hash)
 
@@ -47,13 +96,34 @@ func GetHandler(w http.ResponseWriter, r *http.Request) {
 			fmt.Println(err.Error())
 			w.WriteHeader(http.StatusNotFound)
 		} else {
-			res := Response{"/objects/" + hash, value}
+			res := Response{"/objects/" + hash, value, nil, nil}
 			json.NewEncoder(w).Encode(res)
 		}
 	}
 }
 
+// parseQuorum returns the ?quorum=N parameter of `r`, or `quorum` if it is not set
+func parseQuorum(r *http.Request, quorum int) (int, error) {
+	if r.URL.Query().Get("quorum") == "" {
+		return quorum, nil
+	}
+
+	quorum, err := strconv.Atoi(r.URL.Query().Get("quorum"))
+	if err == nil && quorum < 1 {
+		err = errors.New(errBadQuorum)
+	}
+	return quorum, err
+}
+
+// PostHandler stores the value on the k closest nodes. ?quorum=N sets the number of
+// nodes which must acknowledge the value, replying Service Unavailable if fewer did.
 func PostHandler(w http.ResponseWriter, r *http.Request) {
+	quorum, err := parseQuorum(r, node.WriteQuorum())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	b, err := ioutil.ReadAll(r.Body)
 
 	if err != nil {
@@ -67,11 +137,18 @@ func PostHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		fmt.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
+	} else if len(body.Value) > kademlia.MaxDataSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
 	} else {
-		key := node.StoreValue(body.Value)
-		res := Response{"/objects/" + key, body.Value}
+		result, err := node.StoreValueWithQuorum(body.Value, quorum)
+		res := Response{"/objects/" + result.Key, body.Value, nil, result}
 
-		w.WriteHeader(http.StatusCreated)
+		if err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
 		json.NewEncoder(w).Encode(res)
 	}
 }
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+func TestGetHandlerBadQuorum(t *testing.T) {
+	node = newTestNode()
+
+	for _, quorum := range []string{"0", "many"} {
+		recorder := httptest.NewRecorder()
+		GetHandler(recorder, httptest.NewRequest("GET", "/objects/1111111100000000000000000000000000000001?quorum="+quorum, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestPostHandlerBadQuorum(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	PostHandler(recorder, httptest.NewRequest("POST", "/objects?quorum=0", strings.NewReader(`{"value":"there"}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestPostHandlerWriteQuorumNotMet(t *testing.T) {
+	// no node acknowledges the value since the node knows no other node
+	node = &kademlia.Node{}
+	node.RT = kademlia.NewRoutingTable(kademlia.NewContact(kademlia.NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+
+	recorder := httptest.NewRecorder()
+	PostHandler(recorder, httptest.NewRequest("POST", "/objects", strings.NewReader(`{"value":"there"}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	res := Response{}
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+	assert.Equal(t, "there", res.Value)
+	assert.Equal(t, 1, res.Store.Quorum)
+	assert.Empty(t, res.Store.Acked)
+	assert.Equal(t, "/objects/"+res.Store.Key, res.Location)
+}
+
+func TestWatchHandlerBadHash(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	request := mux.SetURLVars(httptest.NewRequest("GET", "/objects/nothex/watch", nil), map[string]string{"hash": "nothex"})
+	WatchHandler(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
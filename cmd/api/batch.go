@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+const (
+	errTooManyValues string = "too many values given"
+	errValueTooLarge string = "value is too large"
+)
+
+// BatchBody is the body of a batch store, the values to store
+type BatchBody struct {
+	Values []string `json:"values"`
+}
+
+// QueryBody is the body of a batch query, the hashes to find the values of
+type QueryBody struct {
+	Hashes []string `json:"hashes"`
+}
+
+// BatchResponse lists the location and store result of every value of a batch
+// store, in the order of the values
+type BatchResponse struct {
+	Objects []Response `json:"objects"`
+}
+
+// QueryResponse lists the values found by a batch query and the hashes without value
+type QueryResponse struct {
+	Objects []Response `json:"objects"`
+	Missing []string   `json:"missing"`
+}
+
+// BatchHandler stores every value in the body, grouping the values by the nodes
+// responsible for them. Replies Service Unavailable if fewer nodes than the write
+// quorum acknowledged any value.
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	body := BatchBody{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	} else if len(body.Values) > kademlia.MaxBatch {
+		writeJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{errTooManyValues})
+		return
+	}
+
+	for _, value := range body.Values {
+		if len(value) > kademlia.MaxDataSize {
+			writeJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{errValueTooLarge})
+			return
+		}
+	}
+
+	results, err := node.StoreBatch(body.Values)
+	res := BatchResponse{[]Response{}}
+	for i, result := range results {
+		res.Objects = append(res.Objects, Response{"/objects/" + result.Key, body.Values[i], nil, result})
+	}
+
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, res)
+	} else {
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
+
+// QueryHandler returns the values of every hash in the body. Hashes without value
+// are returned in `missing`.
+func QueryHandler(w http.ResponseWriter, r *http.Request) {
+	body := QueryBody{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	} else if len(body.Hashes) > kademlia.MaxBatch {
+		writeJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{errTooManyValues})
+		return
+	}
+
+	hashes := []string{}
+	for _, hash := range body.Hashes {
+		hash, err := kademlia.NormalizeHash(hash)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+			return
+		}
+		hashes = append(hashes, hash)
+	}
+
+	values, err := node.FindValues(hashes)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	res := QueryResponse{[]Response{}, []string{}}
+	for _, hash := range hashes {
+		if value, ok := values[hash]; ok {
+			res.Objects = append(res.Objects, Response{"/objects/" + hash, value, nil, nil})
+		} else {
+			res.Missing = append(res.Missing, hash)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
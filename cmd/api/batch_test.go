@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+func TestBatchHandlerBadRequest(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	BatchHandler(recorder, httptest.NewRequest("POST", "/objects/batch", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	body := `{"values":["` + strings.Repeat("a", kademlia.MaxDataSize+1) + `"]}`
+	recorder = httptest.NewRecorder()
+	BatchHandler(recorder, httptest.NewRequest("POST", "/objects/batch", strings.NewReader(body)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestQueryHandlerBadHash(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	QueryHandler(recorder, httptest.NewRequest("POST", "/objects/query", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	QueryHandler(recorder, httptest.NewRequest("POST", "/objects/query", strings.NewReader(`{"hashes":["xyz"]}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+// maxFileSize the largest body PutFileHandler stores as a file
+const maxFileSize int64 = 1 << 30
+
+const (
+	errNoFilePart   string = "no file part given"
+	errBodyTooLarge string = "http: request body too large" // returned by http.MaxBytesReader
+)
+
+type FileResponse struct {
+	Location string `json:"location"`
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+}
+
+// PutFileHandler stores the body as a file, streaming it into chunks. The body is
+// either the raw content or a multipart form whose first file part is stored.
+// Replies with the location of the manifest and the hash of the content, or with
+// 413 if the body is larger than maxFileSize.
+func PutFileHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize)
+	body, err := fileBody(r)
+	if err != nil {
+		writeJSON(w, bodyErrorStatus(err, http.StatusBadRequest), ErrorResponse{err.Error()})
+		return
+	}
+
+	key, manifest, err := node.StoreFile(body)
+	if err != nil {
+		writeJSON(w, bodyErrorStatus(err, http.StatusServiceUnavailable), ErrorResponse{err.Error()})
+		return
+	}
+
+	w.Header().Set("Location", "/files/"+key)
+	w.Header().Set("ETag", `"`+manifest.Hash+`"`)
+	writeJSON(w, http.StatusCreated, FileResponse{"/files/" + key, manifest.Hash, manifest.Size})
+}
+
+// bodyErrorStatus returns 413 if `err` is the request body going over maxFileSize,
+// and `status` otherwise
+func bodyErrorStatus(err error, status int) int {
+	if err.Error() == errBodyTooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return status
+}
+
+// fileBody returns the first file part of a multipart request, or the body of other requests
+func fileBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return nil, errors.New(errNoFilePart)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if part.FileName() != "" || part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// GetFileHandler streams the content of the file whose manifest is stored under
+// the hash. Range requests are supported and the ETag is the hash of the content.
+// Replies with 404 if nothing is stored under the hash, 422 if what is stored is
+// not a manifest and 502 if the nodes holding it could not be reached.
+func GetFileHandler(w http.ResponseWriter, r *http.Request) {
+	hash, err := kademlia.NormalizeHash(mux.Vars(r)["hash"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	file, err := node.OpenFile(hash)
+	if kademlia.IsBadManifest(err) {
+		writeJSON(w, http.StatusUnprocessableEntity, ErrorResponse{err.Error()})
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	serveFile(w, r, file, file.Manifest.Hash)
+}
+
+// serveFile replies with the `content` of a file, answering range and conditional
+// requests, with the hash of the content as ETag
+func serveFile(w http.ResponseWriter, r *http.Request, content io.ReadSeeker, hash string) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+hash+`"`)
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
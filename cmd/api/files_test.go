@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+func TestFileHandlersBadRequest(t *testing.T) {
+	node = newTestNode()
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/files/xyz", nil)
+	GetFileHandler(recorder, mux.SetURLVars(request, map[string]string{"hash": "xyz"}))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	body := bytes.NewBuffer(nil)
+	form := multipart.NewWriter(body)
+	form.WriteField("name", "value")
+	form.Close()
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest("PUT", "/files", body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	PutFileHandler(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), errNoFilePart)
+}
+
+func TestGetFileHandlerNotFound(t *testing.T) {
+	// nothing is found since the node knows no other node
+	node = &kademlia.Node{}
+	node.RT = kademlia.NewRoutingTable(kademlia.NewContact(kademlia.NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+
+	hash := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/files/"+hash, nil)
+	GetFileHandler(recorder, mux.SetURLVars(request, map[string]string{"hash": hash}))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestServeFileRange(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/files/hash", nil)
+	request.Header.Set("Range", "bytes=6-10")
+	serveFile(recorder, request, strings.NewReader("hello world"), "hash")
+
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, "world", recorder.Body.String())
+	assert.Equal(t, "bytes 6-10/11", recorder.Header().Get("Content-Range"))
+	assert.Equal(t, `"hash"`, recorder.Header().Get("ETag"))
+
+	// the ETag answers conditional requests
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest("GET", "/files/hash", nil)
+	request.Header.Set("If-None-Match", `"hash"`)
+	serveFile(recorder, request, strings.NewReader("hello world"), "hash")
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+type NameBody struct {
+	Value string `json:"value"`
+}
+
+type NameKeyResponse struct {
+	Key      string `json:"key"`
+	Location string `json:"location"`
+}
+
+// NewNameHandler generates a key pair the node can publish a name with
+func NewNameHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := node.NewNameKey()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, NameKeyResponse{key, "/names/" + key})
+}
+
+// PutNameHandler signs the value with the key of the name and publishes it
+// with the next sequence number
+func PutNameHandler(w http.ResponseWriter, r *http.Request) {
+	body := NameBody{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	record, err := node.PublishName(key, body.Value)
+	if record == nil {
+		// names whose private key this node does not hold are not found
+		writeError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RecordResponse{"/names/" + key, record})
+}
+
+// GetNameHandler resolves the latest signed value published under the name
+func GetNameHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	_, err := kademlia.ParseNodeID(key)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	record, err := node.ResolveName(key)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RecordResponse{"/names/" + key, record})
+}
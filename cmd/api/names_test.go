@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutNameHandlerUnknownKey(t *testing.T) {
+	node = newTestNode()
+
+	key := "1111111100000000000000000000000000000001"
+	recorder := httptest.NewRecorder()
+	request := mux.SetURLVars(httptest.NewRequest("PUT", "/names/"+key, strings.NewReader(`{"value":"a"}`)), map[string]string{"key": key})
+	PutNameHandler(recorder, request)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	request = mux.SetURLVars(httptest.NewRequest("PUT", "/names/"+key, strings.NewReader(`not json`)), map[string]string{"key": key})
+	PutNameHandler(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
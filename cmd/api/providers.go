@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+type ProvidersResponse struct {
+	Location  string            `json:"location"`
+	Providers []ContactResponse `json:"providers"`
+}
+
+// ProvideHandler announces the node as a provider of the object to the k closest nodes
+func ProvideHandler(w http.ResponseWriter, r *http.Request) {
+	hash, err := kademlia.NormalizeHash(mux.Vars(r)["hash"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	err = node.Provide(hash)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, ErrorResponse{err.Error()})
+		return
+	}
+
+	w.Header().Set("Location", "/providers/"+hash)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetProvidersHandler returns the nodes providing the object
+func GetProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	hash, err := kademlia.NormalizeHash(mux.Vars(r)["hash"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	providers, err := node.FindProviders(hash)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{err.Error()})
+		return
+	}
+
+	target := kademlia.KeyIDWithWidth(hash, node.IDWidth())
+	res := ProvidersResponse{"/providers/" + hash, []ContactResponse{}}
+	for _, contact := range providers {
+		res.Providers = append(res.Providers, ContactResponse{
+			contact.ID.String(),
+			contact.Address,
+			contact.ID.CalcDistance(target).String(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvidersHandlersBadHash(t *testing.T) {
+	node = newTestNode()
+
+	for _, handler := range []http.HandlerFunc{ProvideHandler, GetProvidersHandler} {
+		recorder := httptest.NewRecorder()
+		request := mux.SetURLVars(httptest.NewRequest("GET", "/providers/nothex", nil), map[string]string{"hash": "nothex"})
+		handler(recorder, request)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+}
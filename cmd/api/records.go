@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+// EnvAPIToken is the environment variable holding the token required to
+// delete and update content. Deleting and updating is disabled if it is empty.
+const EnvAPIToken string = "KADEMLIA_API_TOKEN"
+
+const (
+	errNoToken  string = "deleting and updating is disabled, set " + EnvAPIToken
+	errBadToken string = "missing or wrong bearer token"
+)
+
+var apiToken string
+
+type RecordBody struct {
+	Value      string              `json:"value"`
+	Resolution kademlia.Resolution `json:"resolution"`
+}
+
+type RecordResponse struct {
+	Location string           `json:"location"`
+	Record   *kademlia.Record `json:"record"`
+}
+
+// authorized only calls `handler` if the request carries the API token
+// in an `Authorization: Bearer <token>` header
+func authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiToken == "" {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{errNoToken})
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{errBadToken})
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// writeError writes `err` with Conflict if a newer version is stored, or `status` otherwise
+func writeError(w http.ResponseWriter, status int, err error) {
+	if kademlia.IsConflict(err) {
+		status = http.StatusConflict
+	} else if kademlia.IsNotFound(err) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, ErrorResponse{err.Error()})
+}
+
+// DeleteHandler stores a tombstone for the object on the k closest nodes
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+	_, _, err := kademlia.ParseHash(hash)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	err = node.DeleteValue(hash)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PutRecordHandler publishes the next version of the record owned by the node
+func PutRecordHandler(w http.ResponseWriter, r *http.Request) {
+	body := RecordBody{Resolution: kademlia.HigherVersionWins}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	key, record, err := node.PutRecord(mux.Vars(r)["name"], body.Value, body.Resolution)
+	if record == nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RecordResponse{"/records/" + key, record})
+}
+
+// GetRecordHandler returns the latest version of the record stored under the key
+func GetRecordHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	_, err := kademlia.ParseNodeID(key)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	record, err := node.FindRecord(key)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RecordResponse{"/records/" + key, record})
+}
+
+// DeleteRecordHandler stores a tombstone replacing the record owned by the node
+func DeleteRecordHandler(w http.ResponseWriter, r *http.Request) {
+	err := node.DeleteRecord(mux.Vars(r)["name"])
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorized(t *testing.T) {
+	called := false
+	handler := authorized(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	apiToken = ""
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("DELETE", "/objects/hash", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	apiToken = "secret"
+	defer func() { apiToken = "" }()
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest("DELETE", "/objects/hash", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	handler(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.False(t, called)
+
+	recorder = httptest.NewRecorder()
+	request.Header.Set("Authorization", "Bearer secret")
+	handler(recorder, request)
+	assert.True(t, called)
+}
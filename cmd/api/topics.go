@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+const errNoStreaming string = "streaming is not supported"
+
+type PublishResponse struct {
+	Topic     string `json:"topic"`
+	Delivered int    `json:"delivered"`
+}
+
+// PublishHandler sends the value in the body to the subscribers of the topic
+func PublishHandler(w http.ResponseWriter, r *http.Request) {
+	body := Body{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	topic := mux.Vars(r)["topic"]
+	delivered, err := node.Publish(topic, body.Value)
+	if kademlia.IsMessageTooLarge(err) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{err.Error()})
+		return
+	} else if err != nil {
+		writeJSON(w, http.StatusBadGateway, ErrorResponse{err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PublishResponse{kademlia.TopicKey(topic), delivered})
+}
+
+// EventsHandler subscribes to the topic and streams the messages published to it
+// as Server-Sent Events until the client disconnects
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{errNoStreaming})
+		return
+	}
+
+	subscription, err := node.Subscribe(mux.Vars(r)["topic"])
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, ErrorResponse{err.Error()})
+		return
+	}
+	defer subscription.Close()
+
+	startEvents(w, flusher)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, open := <-subscription.Messages:
+			if !open {
+				return
+			}
+			writeEvent(w, flusher, "message", message)
+		}
+	}
+}
+
+// startEvents starts a stream of Server-Sent Events
+func startEvents(w http.ResponseWriter, flusher http.Flusher) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+}
+
+// writeEvent writes `value` as JSON in a Server-Sent Event called `name`
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, name string, value interface{}) {
+	data, _ := json.Marshal(value)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	flusher.Flush()
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+func TestPublishHandlerBadRequest(t *testing.T) {
+	node = newTestNode()
+	vars := map[string]string{"topic": "news"}
+
+	recorder := httptest.NewRecorder()
+	PublishHandler(recorder, mux.SetURLVars(httptest.NewRequest("POST", "/topics/news", strings.NewReader("{")), vars))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	body := `{"value":"` + strings.Repeat("a", kademlia.MaxValueSize+1) + `"}`
+	recorder = httptest.NewRecorder()
+	PublishHandler(recorder, mux.SetURLVars(httptest.NewRequest("POST", "/topics/news", strings.NewReader(body)), vars))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+)
+
+// WatchHandler watches the object and streams its events as Server-Sent Events
+// named after their kind until the client disconnects
+func WatchHandler(w http.ResponseWriter, r *http.Request) {
+	hash, err := kademlia.NormalizeHash(mux.Vars(r)["hash"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{errNoStreaming})
+		return
+	}
+
+	watch, err := node.Watch(hash)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, ErrorResponse{err.Error()})
+		return
+	}
+	defer watch.Close()
+
+	startEvents(w, flusher)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-watch.Events:
+			if !open {
+				return
+			}
+			writeEvent(w, flusher, string(event.Kind), event)
+		}
+	}
+}
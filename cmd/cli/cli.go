@@ -15,7 +15,7 @@ var out io.Writer = os.Stdout
 
 // Cli starts the program for the given node and outputs data to the given
 // io.writer
-func Cli(output io.Writer, node kademlia.Node) {
+func Cli(output io.Writer, node *kademlia.Node) {
 	fmt.Fprintln(out, "Starting CLI...")
 	reader := bufio.NewReader(in)
 
@@ -29,7 +29,7 @@ func Cli(output io.Writer, node kademlia.Node) {
 		} else {
 			commands := strings.Fields(trimInput)
 
-			Commands(output, &node, commands)
+			Commands(output, node, commands)
 
 		}
 
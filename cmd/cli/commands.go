@@ -3,8 +3,10 @@ package cli
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
 )
@@ -28,25 +30,75 @@ func Commands(output io.Writer, node *kademlia.Node, commands []string) {
 	switch commands[0] {
 	case "put":
 		if len(commands) == 2 {
-			Put(*node, commands[1])
+			Put(output, node, commands[1])
 		} else {
 			fmt.Fprintln(output, errNoArg)
 		}
 	case "p":
 		if len(commands) == 2 {
-			Put(*node, commands[1])
+			Put(output, node, commands[1])
 		} else {
 			fmt.Fprintln(output, errNoArg)
 		}
 	case "get":
 		if len(commands) == 2 {
-			Get(*node, commands[1])
+			Get(node, commands[1])
 		} else {
 			fmt.Fprintln(output, errNoArg)
 		}
 	case "g":
 		if len(commands) == 2 {
-			Get(*node, commands[1])
+			Get(node, commands[1])
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "put-file":
+		if len(commands) == 2 {
+			PutFile(output, node, commands[1])
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "get-many":
+		if len(commands) >= 2 {
+			GetMany(output, node, commands[1:])
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "delete":
+		if len(commands) == 2 {
+			Delete(output, node, commands[1])
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "update":
+		if len(commands) >= 3 {
+			Update(output, node, commands[1], strings.Join(commands[2:], " "))
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "record":
+		if len(commands) == 2 {
+			GetRecord(output, node, commands[1])
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "keygen":
+		Keygen(output, node)
+	case "publish":
+		if len(commands) >= 3 {
+			Publish(output, node, commands[1], strings.Join(commands[2:], " "))
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "resolve":
+		if len(commands) == 2 {
+			Resolve(output, node, commands[1])
+		} else {
+			fmt.Fprintln(output, errNoArg)
+		}
+	case "trace":
+		if len(commands) == 2 {
+			Trace(output, node, commands[1])
 		} else {
 			fmt.Fprintln(output, errNoArg)
 		}
@@ -65,12 +117,21 @@ func Commands(output io.Writer, node *kademlia.Node, commands []string) {
 	}
 }
 
-func Put(node kademlia.Node, input string) {
-	hash := node.StoreValue(input)
-	println("Hash = ", hash)
+func Put(output io.Writer, node *kademlia.Node, input string) {
+	result, err := node.StoreValue(input)
+	if result == nil {
+		fmt.Fprintln(output, err.Error())
+		return
+	}
+
+	fmt.Fprintln(output, "Hash = ", result.Key)
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	}
+	fmt.Fprintln(output, "Stored on ", len(result.Acked), " nodes")
 }
 
-func Get(node kademlia.Node, hash string) {
+func Get(node *kademlia.Node, hash string) {
 	value, err := node.FindValue(hash)
 
 	if err != nil {
@@ -80,6 +141,159 @@ func Get(node kademlia.Node, hash string) {
 	}
 }
 
+// PutFile stores every non-empty line of the file at `path` as a value and writes
+// the hash of each line to `output`
+func PutFile(output io.Writer, node *kademlia.Node, path string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(output, errNoFileFound+path)
+		return
+	}
+
+	values := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			values = append(values, line)
+		}
+	}
+
+	results, err := node.StoreBatch(values)
+	for _, result := range results {
+		fmt.Fprintf(output, "Hash = %s stored on %d nodes\n", result.Key, len(result.Acked))
+	}
+
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	}
+}
+
+// GetMany writes the value of every hash in `hashes` to `output`
+func GetMany(output io.Writer, node *kademlia.Node, hashes []string) {
+	for _, hash := range hashes {
+		_, _, err := kademlia.ParseHash(hash)
+		if err != nil {
+			fmt.Fprintln(output, err.Error())
+			return
+		}
+	}
+
+	values, err := node.FindValues(hashes)
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+		return
+	}
+
+	for _, hash := range hashes {
+		if value, ok := values[hash]; ok {
+			fmt.Fprintf(output, "%s = %s\n", hash, value)
+		} else {
+			fmt.Fprintf(output, "%s not found\n", hash)
+		}
+	}
+}
+
+// Delete removes the object `hash` from the network before it expires
+func Delete(output io.Writer, node *kademlia.Node, hash string) {
+	_, _, err := kademlia.ParseHash(hash)
+	if err == nil {
+		err = node.DeleteValue(hash)
+	}
+
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	} else {
+		fmt.Fprintln(output, "deleted ", hash)
+	}
+}
+
+// Update publishes `value` as the next version of the record `name` owned by the node
+func Update(output io.Writer, node *kademlia.Node, name string, value string) {
+	key, record, err := node.PutRecord(name, value, kademlia.HigherVersionWins)
+
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	} else {
+		fmt.Fprintf(output, "Key = %s version = %d\n", key, record.Version)
+	}
+}
+
+// GetRecord writes the latest version of the record under `key` to `output`
+func GetRecord(output io.Writer, node *kademlia.Node, key string) {
+	_, err := kademlia.ParseNodeID(key)
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+		return
+	}
+
+	record, err := node.FindRecord(key)
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	} else {
+		fmt.Fprintf(output, "%s version %d = %s\n", record.Name, record.Version, record.Value)
+	}
+}
+
+// Keygen generates a key pair for the node to publish a name with
+func Keygen(output io.Writer, node *kademlia.Node) {
+	key, err := node.NewNameKey()
+
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	} else {
+		fmt.Fprintln(output, "Key = ", key)
+	}
+}
+
+// Publish signs `value` with the key of the name `key` and publishes it
+func Publish(output io.Writer, node *kademlia.Node, key string, value string) {
+	record, err := node.PublishName(key, value)
+
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	} else {
+		fmt.Fprintf(output, "Key = %s sequence = %d\n", key, record.Version)
+	}
+}
+
+// Resolve writes the latest signed value of the name `key` to `output`
+func Resolve(output io.Writer, node *kademlia.Node, key string) {
+	_, err := kademlia.ParseNodeID(key)
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+		return
+	}
+
+	record, err := node.ResolveName(key)
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	} else {
+		fmt.Fprintf(output, "sequence %d = %s\n", record.Version, record.Value)
+	}
+}
+
+// Trace looks up `hash` and writes every contact queried during the lookup to `output`
+func Trace(output io.Writer, node *kademlia.Node, hash string) {
+	_, _, err := kademlia.ParseHash(hash)
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+		return
+	}
+
+	value, report, err := node.FindValueWithReport(hash)
+
+	for _, query := range report.Queries {
+		fmt.Fprintf(output, "round %d  %s  %s  distance %s  rtt %s  %s\n",
+			query.Round, query.ID, query.Address, query.Distance, query.RTT, query.Result)
+	}
+	fmt.Fprintf(output, "terminated: %s after %d rounds in %s\n", report.Termination, report.Rounds, report.Duration)
+
+	if err != nil {
+		fmt.Fprintln(output, err.Error())
+	} else {
+		fmt.Fprintln(output, "value = ", value)
+	}
+}
+
 func Exit() {
 	osExit(3)
 }
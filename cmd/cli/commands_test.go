@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
 )
 
 func TestHelp(t *testing.T) {
@@ -61,6 +62,20 @@ func TestDefault(t *testing.T) {
 
 func TestPut(t *testing.T) {
 	assert.Equal(t, errNoArg, cmdTester("put"))
+
+	// no node stores the value since the node knows no other node
+	node := &kademlia.Node{}
+	node.RT = kademlia.NewRoutingTable(kademlia.NewContact(kademlia.NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+
+	out = bytes.NewBuffer(nil)
+	Commands(out, node, []string{"put", "there"})
+	output := trimWriterOutput(out)
+	assert.Contains(t, output, "Hash =  490528f36debf7c15cea5e9a9d1ea024cf6b2921")
+	assert.Contains(t, output, "Stored on  0  nodes")
+
+	out = bytes.NewBuffer(nil)
+	Commands(out, node, []string{"put", strings.Repeat("a", kademlia.MaxDataSize+1)})
+	assert.Equal(t, "value is too large", trimWriterOutput(out))
 }
 
 func TestPutShort(t *testing.T) {
@@ -74,3 +89,51 @@ func TestGet(t *testing.T) {
 func TestGetShort(t *testing.T) {
 	assert.Equal(t, errNoArg, cmdTester("g"))
 }
+
+func TestTrace(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("trace"))
+
+	out = bytes.NewBuffer(nil)
+	Commands(out, nil, []string{"trace", "not a hash"})
+	assert.NotEqual(t, "", trimWriterOutput(out))
+}
+
+func TestDelete(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("delete"))
+}
+
+func TestUpdate(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("update"))
+}
+
+func TestRecord(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("record"))
+}
+
+func TestPublish(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("publish"))
+
+	out = bytes.NewBuffer(nil)
+	Commands(out, nil, []string{"publish", "key"})
+	assert.Equal(t, errNoArg, trimWriterOutput(out))
+}
+
+func TestResolve(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("resolve"))
+}
+
+func TestPutFile(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("put-file"))
+
+	out = bytes.NewBuffer(nil)
+	Commands(out, nil, []string{"put-file", "does/not/exist"})
+	assert.Equal(t, errNoFileFound+"does/not/exist", trimWriterOutput(out))
+}
+
+func TestGetMany(t *testing.T) {
+	assert.Equal(t, errNoArg, cmdTester("get-many"))
+
+	out = bytes.NewBuffer(nil)
+	Commands(out, nil, []string{"get-many", "not a hash"})
+	assert.NotEqual(t, "", trimWriterOutput(out))
+}
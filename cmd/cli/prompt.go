@@ -13,6 +13,15 @@ COMMANDS:
    exit, e      Terminates specified node
    get, g       Retrieves content of specified node
    put, p       Appends node and content to network
+   put-file     Stores every line of a file as content
+   get-many     Retrieves the content of several hashes
+   delete       Removes content from the network before it expires
+   update       Publishes a new version of a named record
+   record       Retrieves the latest version of a record
+   keygen       Generates a key pair to publish a name with
+   publish      Signs and publishes a new value of a name
+   resolve      Retrieves the latest signed value of a name
+   trace        Shows every node queried while retrieving content
    help, h      Show help
    version, v   Print the version
 `
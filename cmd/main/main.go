@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 
 	"github.com/viktorfrom/d7024e-kademlia/cmd/api"
 	"github.com/viktorfrom/d7024e-kademlia/cmd/cli"
 	"github.com/viktorfrom/d7024e-kademlia/internal/kademlia"
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
 )
 
 var out io.Writer = os.Stdout
@@ -15,12 +18,60 @@ var out io.Writer = os.Stdout
 func main() {
 	fmt.Fprintln(out, "Booting Kademlia....")
 
+	log := logger.NewWithConfig(logger.ConfigFromEnv())
+
 	node := kademlia.Node{}
-	node.InitNode()
+
+	exporter, err := tracing.ExporterFromEnv()
+	if err != nil {
+		log.Warn(err)
+	} else if exporter != nil {
+		hostname, _ := os.Hostname()
+		tracer := tracing.NewTracer("kademlia", hostname, exporter)
+		defer tracer.Close()
+		node.SetTracer(tracer)
+	}
+
+	if quorum := os.Getenv(kademlia.EnvWriteQuorum); quorum != "" {
+		writeQuorum, err := strconv.Atoi(quorum)
+		if err != nil {
+			log.Warn(err)
+		} else {
+			node.SetWriteQuorum(writeQuorum)
+		}
+	}
+
+	if name := os.Getenv(kademlia.EnvHashFunction); name != "" {
+		function, err := kademlia.ParseHashFunction(name)
+		if err != nil {
+			log.Warn(err)
+		} else {
+			node.SetHashFunction(function)
+		}
+	}
+
+	if width := os.Getenv(kademlia.EnvIDWidth); width != "" {
+		bits, err := strconv.Atoi(width)
+		if err == nil {
+			err = node.SetIDWidth(bits)
+		}
+		if err != nil {
+			log.Warn(err)
+		}
+	}
+
+	if kind := os.Getenv(kademlia.EnvRoutingTable); kind != "" {
+		err := node.SetRoutingTable(kind)
+		if err != nil {
+			log.Warn(err)
+		}
+	}
+
+	node.InitNodeWithLogger(log)
 
 	server := kademlia.InitServer(&node)
 	go server.Listen("8080")
-	go api.API(out, node)
+	go api.API(out, &node)
 
-	cli.Cli(out, node)
+	cli.Cli(out, &node)
 }
@@ -0,0 +1,326 @@
+package kademlia
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+const (
+	// MaxBatchEntries the largest number of entries in a STORE or FIND_VALUE RPC for several keys
+	MaxBatchEntries int = 16
+	// MaxBatchSize the largest number of value bytes in a STORE or FIND_VALUE RPC for several
+	// keys, so that the JSON escaped values fit in the UDP read buffer
+	MaxBatchSize int = MaxValueSize
+	// MaxBatch the largest number of values StoreBatch and FindValues accept
+	MaxBatch int = 1000
+)
+
+const (
+	errTooManyEntries string = "too many entries given"
+	errBatchTooLarge  string = "batch values are too large"
+	errTooManyValues  string = "too many values given"
+)
+
+// BatchEntry is a key and its value in a STORE or FIND_VALUE RPC for several
+// keys. FIND_VALUE RPCs carry only the keys, their replies the entries found.
+// Replies to STORE RPCs carry the keys which were stored.
+type BatchEntry struct {
+	Key   string  `json:"key"`
+	Value *string `json:"value,omitempty"`
+}
+
+// keyGroup is a set of keys which are stored on the same `nodes`
+type keyGroup struct {
+	keys  []string
+	nodes []Contact
+}
+
+func validateBatch(entries []BatchEntry) error {
+	if len(entries) > MaxBatchEntries {
+		return errors.New(errTooManyEntries)
+	}
+
+	size := 0
+	for _, entry := range entries {
+		if len(entry.Key) > MaxKeySize {
+			return errors.New(errKeyTooLarge)
+		}
+		if entry.Value != nil {
+			size += len(*entry.Value)
+		}
+	}
+
+	if size > MaxBatchSize {
+		return errors.New(errBatchTooLarge)
+	}
+	return nil
+}
+
+// splitBatch splits `entries` into batches small enough to be sent in an RPC
+func splitBatch(entries []BatchEntry) [][]BatchEntry {
+	batches := [][]BatchEntry{}
+	batch := []BatchEntry{}
+	size := 0
+
+	for _, entry := range entries {
+		entrySize := 0
+		if entry.Value != nil {
+			entrySize = len(*entry.Value)
+		}
+
+		if len(batch) == MaxBatchEntries || (len(batch) > 0 && size+entrySize > MaxBatchSize) {
+			batches = append(batches, batch)
+			batch, size = []BatchEntry{}, 0
+		}
+		batch = append(batch, entry)
+		size += entrySize
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// groupKeys groups `keys` by the nodes responsible for them. The keys are sorted
+// by ID and looked up in order. A key joins the current group without a lookup
+// while it shares more leading bits with the last key looked up than the closest
+// node found for that key does, or after a lookup finding the same nodes.
+func (kademlia *Node) groupKeys(keys []string, span *tracing.Span) []keyGroup {
+	sorted := append([]string{}, keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return kademlia.keyID(sorted[i]).Less(kademlia.keyID(sorted[j]))
+	})
+
+	groups := []keyGroup{}
+	var first *NodeID
+	shared := 0
+
+	for _, key := range sorted {
+		id := kademlia.keyID(key)
+		last := len(groups) - 1
+		if last >= 0 && first.CalcDistance(id).leadingZeros() > shared {
+			groups[last].keys = append(groups[last].keys, key)
+			continue
+		}
+
+		lookupSpan := span.Start("NodeLookup", tracing.Internal)
+		nodes := kademlia.nodeLookup(id, lookupSpan, nil)
+		lookupSpan.End()
+
+		first, shared = id, -1
+		for _, node := range nodes {
+			if bits := node.ID.CalcDistance(id).leadingZeros(); bits > shared {
+				shared = bits
+			}
+		}
+
+		// the lookup found the same nodes as for the previous group
+		if last >= 0 && sameContacts(groups[last].nodes, nodes) {
+			groups[last].keys = append(groups[last].keys, key)
+			continue
+		}
+
+		groups = append(groups, keyGroup{[]string{key}, nodes})
+	}
+	return groups
+}
+
+// sameContacts returns true if `contacts` and `others` have the same IDs in the same order
+func sameContacts(contacts []Contact, others []Contact) bool {
+	if len(contacts) != len(others) {
+		return false
+	}
+	for i := range contacts {
+		if !contacts[i].ID.Equals(others[i].ID) {
+			return false
+		}
+	}
+	return true
+}
+
+// StoreBatch stores every value of `data` like StoreValue, grouping the values by
+// the nodes responsible for them so that a lookup is done per group instead of per
+// value and each node is sent STORE RPCs carrying several values. Returns the
+// results in the order of `data` and an error if fewer nodes than the write quorum
+// of the node acknowledged any value.
+func (kademlia *Node) StoreBatch(data []string) ([]*StoreResult, error) {
+	if len(data) > MaxBatch {
+		return nil, errors.New(errTooManyValues)
+	}
+	for _, value := range data {
+		if len(value) > MaxDataSize {
+			return nil, errors.New(errValueTooLarge)
+		}
+	}
+
+	span := kademlia.tracer.Start("StoreBatch", tracing.Internal, nil)
+	defer span.End()
+
+	quorum := kademlia.WriteQuorum()
+	packages := map[string]string{}
+	results := map[string]*StoreResult{}
+	keys := []string{}
+	for _, value := range data {
+		key := HashKey(kademlia.HashFunction(), []byte(value))
+		if _, exists := packages[key]; !exists {
+			keys = append(keys, key)
+		}
+		packages[key] = timestampValue(value)
+		results[key] = newStoreResult(key, quorum)
+	}
+
+	client := kademlia.client.withSpan(span)
+	for _, group := range kademlia.groupKeys(keys, span) {
+		entries := []BatchEntry{}
+		for _, key := range group.keys {
+			value := packages[key]
+			entries = append(entries, BatchEntry{key, &value})
+		}
+
+		for _, node := range group.nodes {
+			for _, batch := range splitBatch(entries) {
+				rpc, err := client.SendStoreBatchMessage(&node, kademlia.RT.GetMe(), batch)
+				if err != nil {
+					kademlia.logger.WithField(logger.FieldPeerID, node.ID.String()).Warn(err)
+					kademlia.removeUnresponsive(node, err)
+				}
+				kademlia.addBatchAcks(results, node, batch, rpc, err)
+			}
+		}
+	}
+
+	var firstErr error
+	ordered := []*StoreResult{}
+	for _, value := range data {
+		result := results[HashKey(kademlia.HashFunction(), []byte(value))]
+		ordered = append(ordered, result)
+		if err := result.check(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	span.SetError(firstErr)
+	return ordered, firstErr
+}
+
+// addBatchAcks records the reply of `node` to a STORE RPC for the keys of `batch`.
+// Keys missing in the reply were rejected by the node.
+func (kademlia *Node) addBatchAcks(results map[string]*StoreResult, node Contact, batch []BatchEntry, rpc *RPC, err error) {
+	stored := map[string]bool{}
+	if err == nil && rpc.Payload != nil {
+		for _, entry := range rpc.Payload.Entries {
+			stored[entry.Key] = true
+		}
+	}
+
+	for _, entry := range batch {
+		if err == nil && !stored[entry.Key] {
+			results[entry.Key].add(node, errors.New(errBadKeyValue))
+		} else {
+			results[entry.Key].add(node, err)
+		}
+	}
+}
+
+// FindValues finds the values stored under `hashes`, grouping the hashes by the
+// nodes responsible for them and sending each node FIND_VALUE RPCs carrying several
+// hashes. Hashes not found that way are looked up one by one like FindValue. Returns
+// the values found by hash, hashes without value are left out.
+func (kademlia *Node) FindValues(hashes []string) (map[string]string, error) {
+	if len(hashes) > MaxBatch {
+		return nil, errors.New(errTooManyValues)
+	}
+
+	span := kademlia.tracer.Start("FindValues", tracing.Internal, nil)
+	defer span.End()
+
+	found := map[string]string{}
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, hash := range hashes {
+		key := normalizeKey(hash)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if content := kademlia.searchLocalStore(key); content != nil {
+			found[key] = *content
+		} else if cached := kademlia.searchCache(key); cached != nil {
+			found[key] = *cached
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	client := kademlia.client.withSpan(span)
+	for _, group := range kademlia.groupKeys(missing, span) {
+		for _, node := range group.nodes {
+			entries := []BatchEntry{}
+			for _, key := range group.keys {
+				if _, exists := found[key]; !exists {
+					entries = append(entries, BatchEntry{Key: key})
+				}
+			}
+
+			for _, batch := range splitBatch(entries) {
+				rpc, err := client.SendFindValuesMessage(&node, kademlia.RT.GetMe(), batch)
+				if err != nil {
+					kademlia.logger.WithField(logger.FieldPeerID, node.ID.String()).Warn(err)
+					kademlia.removeUnresponsive(node, err)
+					continue
+				}
+				kademlia.addFoundValues(found, node, batch, rpc)
+			}
+		}
+	}
+
+	values := map[string]string{}
+	for _, hash := range hashes {
+		key := normalizeKey(hash)
+		if _, exists := found[key]; !exists {
+			value, err := kademlia.FindValue(key)
+			if err != nil {
+				continue
+			}
+			found[key] = value
+		}
+		values[hash] = found[key]
+	}
+	return values, nil
+}
+
+// addFoundValues adds the values `node` replied with for the keys of `batch` to
+// `found`. Values which are not valid for their key are ignored and the node is penalized.
+func (kademlia *Node) addFoundValues(found map[string]string, node Contact, batch []BatchEntry, rpc *RPC) {
+	asked := map[string]bool{}
+	for _, entry := range batch {
+		asked[entry.Key] = true
+	}
+
+	if rpc.Payload == nil {
+		return
+	}
+
+	for _, entry := range rpc.Payload.Entries {
+		if !asked[entry.Key] || entry.Value == nil {
+			continue
+		}
+
+		err := kademlia.verifyRetrieved(entry.Key, Entry{entry.Value, nil})
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    entry.Key,
+			}).Warn(err)
+			badResponses.Inc()
+			kademlia.RT.Penalize(node, badResponsePenalty)
+			return
+		}
+		found[entry.Key] = *entry.Value
+	}
+}
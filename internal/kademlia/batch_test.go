@@ -0,0 +1,174 @@
+package kademlia
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+func TestValidateBatch(t *testing.T) {
+	value := "1600000000:there"
+	assert.NoError(t, validateBatch([]BatchEntry{{"490528f36debf7c15cea5e9a9d1ea024cf6b2921", &value}}))
+
+	large := strings.Repeat("a", MaxBatchSize/2+1)
+	assert.EqualError(t, validateBatch([]BatchEntry{{"a", &large}, {"b", &large}}), errBatchTooLarge)
+	assert.EqualError(t, validateBatch([]BatchEntry{{strings.Repeat("a", MaxKeySize+1), nil}}), errKeyTooLarge)
+	assert.EqualError(t, validateBatch(make([]BatchEntry, MaxBatchEntries+1)), errTooManyEntries)
+}
+
+func TestSplitBatch(t *testing.T) {
+	assert.Equal(t, [][]BatchEntry{}, splitBatch(nil))
+
+	batches := splitBatch(make([]BatchEntry, MaxBatchEntries*2+1))
+	assert.Equal(t, 3, len(batches))
+	assert.Equal(t, 1, len(batches[2]))
+
+	large := strings.Repeat("a", MaxBatchSize/2+1)
+	batches = splitBatch([]BatchEntry{{"a", &large}, {"b", &large}, {"c", nil}})
+	assert.Equal(t, 2, len(batches))
+	for _, batch := range batches {
+		assert.NoError(t, validateBatch(batch))
+	}
+}
+
+func TestIncomingBatchRPCS(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	sender := "1111111100000000000000000000000000000000"
+	hello := HashKey(node.HashFunction(), []byte("hello"))
+	world := HashKey(node.HashFunction(), []byte("world"))
+	helloValue := timestampValue("hello")
+	worldValue := timestampValue("world")
+
+	entries := []BatchEntry{{hello, &helloValue}, {"/unknown/" + world, &worldValue}, {world, &helloValue}}
+	rpc, _ := NewRPC(Store, sender, sender, Payload{Entries: entries})
+	reply, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+
+	// entries which are not valid for their key or do not hash to it are skipped
+	assert.Equal(t, []BatchEntry{{Key: hello}}, reply.Payload.Entries)
+	assert.Equal(t, &helloValue, node.searchLocalStore(hello))
+	assert.Nil(t, node.searchLocalStore("/unknown/"+world))
+	assert.Nil(t, node.searchLocalStore(world))
+
+	entries = []BatchEntry{{Key: hello}, {Key: world}}
+	rpc, _ = NewRPC(FindValue, sender, sender, Payload{Entries: entries})
+	reply, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, []BatchEntry{{hello, &helloValue}}, reply.Payload.Entries)
+}
+
+func TestGroupKeys(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peers := []Contact{
+		NewContact(NewNodeID("2000000000000000000000000000000000000000"), "10.0.8.2:8080"),
+		NewContact(NewNodeID("a000000000000000000000000000000000000000"), "10.0.8.3:8080"),
+		NewContact(NewNodeID("e000000000000000000000000000000000000000"), "10.0.8.4:8080"),
+	}
+
+	lookups := 0
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	for _, peer := range peers {
+		node.RT.AddContact(peer)
+	}
+	node.client = newFakeClient(func(message Message) Message {
+		lookups++
+		reply, _ := NewRPC(OK, message.receiver.ID.String(), me.ID.String(), Payload{})
+		return Message{message.receiver, *reply, nil}
+	})
+
+	keys := []string{
+		"e000000000000000000000000000000000000005",
+		"a100000000000000000000000000000000000000",
+		"2000000000000000000000000000000000000002",
+		"a000000000000000000000000000000000000001",
+		"2000000000000000000000000000000000000001",
+		"c000000000000000000000000000000000000002",
+		"c000000000000000000000000000000000000001",
+	}
+	span := tracing.NewTracer("kademlia", "node1", &recordingExporter{}).Start("StoreBatch", tracing.Internal, nil)
+
+	groups := node.groupKeys(keys, span)
+
+	// the keys are sorted by ID and grouped by the closest peer
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, []string{"2000000000000000000000000000000000000001", "2000000000000000000000000000000000000002"}, groups[0].keys)
+	assert.Equal(t, []string{"a000000000000000000000000000000000000001", "a100000000000000000000000000000000000000"}, groups[1].keys)
+	assert.Equal(t, []string{
+		"c000000000000000000000000000000000000001",
+		"c000000000000000000000000000000000000002",
+		"e000000000000000000000000000000000000005",
+	}, groups[2].keys)
+	for i, group := range groups {
+		assert.True(t, sameContacts(peers[i:i+1], group.nodes))
+	}
+
+	// the second key sharing more bits with the first one than with its closest
+	// peer joins the group without a lookup
+	assert.Equal(t, len(keys)-1, lookups)
+}
+
+// newServedNode returns a node whose only contact is `peer`, whose RPCs are handled
+// by the server of another node. `observe` is called with every RPC sent.
+func newServedNode(me Contact, peer Contact, observe func(rpc RPC)) *Node {
+	peerNode := Node{content: make(map[string]string), deadline: 10}
+	peerNode.RT = NewRoutingTable(peer)
+	server := InitServer(&peerNode)
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.SetWriteQuorum(1)
+	node.client = newFakeClient(func(message Message) Message {
+		rpc := message.rpc
+		observe(rpc)
+		reply, err := server.handleIncomingRPCS(&rpc, "10.0.8.1")
+		if err != nil {
+			reply = NewErrorRPC(&rpc, peer.ID.String(), errorCode(err), err.Error())
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+	return &node
+}
+
+func TestStoreBatchAndFindValues(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2920"), "10.0.8.2:8080")
+
+	batches := map[RPCType]int{}
+	node := newServedNode(me, peer, func(rpc RPC) {
+		if rpc.Payload.Entries != nil {
+			batches[*rpc.Type]++
+		}
+	})
+
+	data := []string{"a", "b", "c", "a"}
+	results, err := node.StoreBatch(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), len(results))
+	assert.Equal(t, results[0], results[3])
+
+	// every value is sent in a single STORE RPC to the only peer
+	assert.Equal(t, 1, batches[Store])
+	for i, result := range results {
+		assert.Equal(t, HashKey(node.HashFunction(), []byte(data[i])), result.Key)
+		assert.Equal(t, 1, len(result.Acked))
+	}
+
+	missing := HashKey(node.HashFunction(), []byte("missing"))
+	values, err := node.FindValues([]string{results[0].Key, results[1].Key, results[2].Key, missing})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(values))
+	for i, result := range results {
+		assert.Equal(t, data[i], entryData(values[result.Key]))
+	}
+	assert.Equal(t, 1, batches[FindValue])
+
+	_, err = node.StoreBatch(make([]string, MaxBatch+1))
+	assert.EqualError(t, err, errTooManyValues)
+}
@@ -2,21 +2,24 @@ package kademlia
 
 import (
 	"container/list"
+	"time"
 )
 
 // BucketSize the `k` value in the Kademlia paper
 const BucketSize int = 5
 
 // bucket definition
-// contains a List
+// contains a List and the time each contact in it was last seen
 type bucket struct {
-	list *list.List
+	list     *list.List
+	lastSeen map[NodeID]time.Time
 }
 
 // newBucket returns a new instance of a bucket
 func newBucket() *bucket {
 	bucket := &bucket{}
 	bucket.list = list.New()
+	bucket.lastSeen = make(map[NodeID]time.Time)
 	return bucket
 }
 
@@ -35,9 +38,11 @@ func (bucket *bucket) AddContact(contact Contact) {
 	if element == nil {
 		if bucket.list.Len() < BucketSize {
 			bucket.list.PushFront(contact)
+			bucket.lastSeen[*contact.ID] = time.Now()
 		}
 	} else {
 		bucket.list.MoveToFront(element)
+		bucket.lastSeen[*contact.ID] = time.Now()
 	}
 }
 
@@ -54,6 +59,7 @@ func (bucket *bucket) RemoveContact(contact Contact) {
 
 	if element != nil {
 		bucket.list.Remove(element)
+		delete(bucket.lastSeen, *contact.ID)
 	}
 }
 
@@ -90,6 +96,11 @@ func (bucket *bucket) GetContactAndCalcDistance(target *NodeID) []Contact {
 	return contacts
 }
 
+// LastSeen returns when the contact with `id` was last added to the bucket
+func (bucket *bucket) LastSeen(id *NodeID) time.Time {
+	return bucket.lastSeen[*id]
+}
+
 // Len return the size of the bucket
 func (bucket *bucket) Len() int {
 	return bucket.list.Len()
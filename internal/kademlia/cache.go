@@ -0,0 +1,122 @@
+package kademlia
+
+import (
+	"time"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+const errCachedRecord string = "only immutable values are cached"
+
+// cacheEntry is a value cached because a lookup passed the node. Cached values
+// are kept apart from the replicas in the store and expire at `expires`.
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+// lookupPath tracks the contacts a FindValue queried, to find the node that
+// should cache the value once it is found
+type lookupPath struct {
+	target  *NodeID
+	closest *Contact
+	replica *NodeID
+}
+
+// miss records that `contact` replied without the value
+func (path *lookupPath) miss(contact Contact) {
+	distance := contact.ID.CalcDistance(path.target)
+	if path.closest == nil || distance.Less(path.closest.ID.CalcDistance(path.target)) {
+		path.closest = &contact
+	}
+}
+
+// hit records that `contact` returned the value
+func (path *lookupPath) hit(contact Contact) {
+	distance := contact.ID.CalcDistance(path.target)
+	if path.replica == nil || distance.Less(path.replica) {
+		path.replica = distance
+	}
+}
+
+// cacheTTL returns the number of seconds the closest node that missed caches the
+// value. The TTL halves with every bit the distance of that node to the key is
+// longer than the distance of the closest node that returned the value.
+func (path *lookupPath) cacheTTL(deadline int64) int64 {
+	if path.closest == nil || path.replica == nil {
+		return 0
+	}
+
+	shift := bitLength(path.closest.ID.CalcDistance(path.target)) - bitLength(path.replica)
+	if shift <= 0 {
+		return deadline
+	} else if shift >= 63 {
+		return 0
+	}
+	return deadline >> uint(shift)
+}
+
+// bitLength returns the number of bits needed to represent `distance`
+func bitLength(distance *NodeID) int {
+	return distance.Bits() - distance.leadingZeros()
+}
+
+// cacheValue sends `value` found under `key` to the closest node on `path` that
+// did not return it, which caches it for a TTL depending on its distance to the key
+func (kademlia *Node) cacheValue(key string, value string, path *lookupPath, span *tracing.Span) {
+	ttl := path.cacheTTL(kademlia.deadline)
+	if ttl <= 0 {
+		return
+	}
+
+	_, err := kademlia.client.withSpan(span).SendCacheMessage(path.closest, kademlia.RT.GetMe(), key, value, ttl)
+	if err != nil {
+		kademlia.logger.WithFields(logger.Fields{
+			logger.FieldPeerID: path.closest.ID.String(),
+			logger.FieldKey:    key,
+		}).Warn(err)
+	}
+}
+
+// insertCache caches `value` under `key` for `ttl` seconds, at most as long as
+// the node keeps replicas. Keys the node holds a replica of are not cached.
+func (kademlia *Node) insertCache(key string, value string, ttl int64) {
+	if ttl > kademlia.deadline {
+		ttl = kademlia.deadline
+	}
+
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if _, exists := kademlia.content[key]; exists {
+		return
+	}
+
+	if kademlia.cache == nil {
+		kademlia.cache = make(map[string]cacheEntry)
+	}
+	kademlia.cache[key] = cacheEntry{value, time.Now().Add(time.Duration(ttl) * time.Second)}
+}
+
+// searchCache returns the value cached under `key` or nil
+func (kademlia *Node) searchCache(key string) *string {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	entry, exists := kademlia.cache[key]
+	if !exists || entry.expires.Before(time.Now()) {
+		return nil
+	}
+	return &entry.value
+}
+
+// expireCache removes the cached values which expired before `now`. The content
+// mutex must be held.
+func (kademlia *Node) expireCache(now time.Time) {
+	for key, entry := range kademlia.cache {
+		if entry.expires.Before(now) {
+			delete(kademlia.cache, key)
+		}
+	}
+}
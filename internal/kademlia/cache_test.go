@@ -0,0 +1,119 @@
+package kademlia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTTL(t *testing.T) {
+	target := NewNodeID("1111111100000000000000000000000000000001")
+	path := lookupPath{target: target}
+	assert.Equal(t, int64(0), path.cacheTTL(16))
+
+	path.hit(NewContact(NewNodeID("1111111100000000000000000000000000000000"), ""))
+	path.miss(NewContact(NewNodeID("1111111100000000000000000000000000000101"), ""))
+	assert.Equal(t, int64(0), path.cacheTTL(16))
+
+	// every bit of extra distance halves the TTL
+	path.miss(NewContact(NewNodeID("1111111100000000000000000000000000000009"), ""))
+	assert.Equal(t, int64(2), path.cacheTTL(16))
+	path.miss(NewContact(NewNodeID("1111111100000000000000000000000000000003"), ""))
+	assert.Equal(t, int64(8), path.cacheTTL(16))
+
+	path.miss(NewContact(NewNodeID("1111111100000000000000000000000000000001"), ""))
+	assert.Equal(t, int64(16), path.cacheTTL(16))
+
+	assert.Equal(t, 0, bitLength(NewNodeID("0000000000000000000000000000000000000000")))
+	assert.Equal(t, IDLength*8, bitLength(NewNodeID("8000000000000000000000000000000000000000")))
+}
+
+func TestIncomingCacheStore(t *testing.T) {
+	sender := "1111111100000000000000000000000000000000"
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	key := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	value := "1600000000:elsewhere"
+	ttl := int64(5)
+	rpc, _ := NewRPC(Store, sender, sender, Payload{Key: &key, Value: &value, TTL: &ttl})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadContentHash)
+	assert.Nil(t, node.searchCache(key))
+
+	value = "1600000000:there"
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Value: &value, TTL: &ttl})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+
+	// cached values are kept apart from the replicas but returned by FIND_VALUE
+	assert.Nil(t, node.searchLocalStore(key))
+	assert.Equal(t, &value, node.searchCache(key))
+	rpc, _ = NewRPC(FindValue, sender, key, Payload{Key: &key})
+	reply, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, &value, reply.Payload.Value)
+
+	entries := node.StoreEntries()
+	assert.Equal(t, 1, len(entries))
+	assert.True(t, entries[0].Cached)
+
+	node.contentMutex.Lock()
+	node.expireCache(time.Now().Add(6 * time.Second))
+	node.contentMutex.Unlock()
+	assert.Nil(t, node.searchCache(key))
+
+	// replicas are not cached
+	node.insertLocalStore(key, value)
+	node.insertCache(key, value, 5)
+	assert.Nil(t, node.searchCache(key))
+
+	ttl = 0
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Value: &value, TTL: &ttl})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadTTL)
+
+	ttl = 5
+	record := Record{Publisher: sender, Deleted: true, Resolution: LastWriterWins}
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Record: &record, TTL: &ttl})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errCachedRecord)
+}
+
+func TestFindValueCachesAlongPath(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	replica := NewContact(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2920"), "10.0.8.2:8080")
+	miss := NewContact(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2922"), "10.0.8.3:8080")
+	key := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	value := "1600000000:there"
+	cached := make(chan Message, 1)
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(replica)
+	node.RT.AddContact(miss)
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, message.receiver.ID.String(), me.ID.String(), Payload{Contacts: []Contact{}})
+		if *message.rpc.Type == Store {
+			cached <- message
+		} else if message.receiver.Address == replica.Address {
+			reply.Payload.Value = &value
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	found, _, err := node.FindValueQuorum(key, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, value, found)
+
+	select {
+	case message := <-cached:
+		assert.Equal(t, miss.Address, message.receiver.Address)
+		assert.Equal(t, int64(5), *message.rpc.Payload.TTL)
+		assert.Equal(t, value, *message.rpc.Payload.Value)
+	default:
+		t.Error("value was not cached")
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"net"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
 )
 
 // the time before a RPC call times out
@@ -19,9 +20,11 @@ type Message struct {
 }
 
 type Client struct {
-	ip   string
-	send chan Message // channel for sending messages from the client to a server
-	resp chan Message // channel for the responses from the server to the client
+	ip     string
+	send   chan Message // channel for sending messages from the client to a server
+	resp   chan Message // channel for the responses from the server to the client
+	logger *logger.Logger
+	span   *tracing.Span // the span RPCs are sent as part of, nil if not traced
 }
 
 //InitClient sets up and returns a client object
@@ -41,7 +44,6 @@ func (client *Client) Start() {
 			err := client.sendRPC()
 			if err != nil {
 				client.resp <- Message{Contact{}, RPC{}, err}
-				log.Warn(err)
 			}
 		}
 	}()
@@ -73,7 +75,11 @@ func (client *Client) sendRPC() error {
 		return errors.New(errNoID)
 	}
 
-	readBuffer := make([]byte, 1024)
+	if rpc.Type == nil || rpc.ID == nil {
+		return errors.New(errNilRPC)
+	}
+
+	readBuffer := make([]byte, UDPReadBufferSize)
 
 	msg, err := MarshalRPC(rpc)
 	if err != nil {
@@ -86,6 +92,9 @@ func (client *Client) sendRPC() error {
 	}
 	defer conn.Close()
 
+	rpcsSent.Inc(string(*rpc.Type))
+	start := time.Now()
+
 	_, err = conn.Write(msg)
 	if err != nil {
 		return err
@@ -93,14 +102,22 @@ func (client *Client) sendRPC() error {
 
 	reply, err := client.getRPCReply(conn, readBuffer, sendAddr)
 	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			rpcTimeouts.Inc(string(*rpc.Type))
+		}
 		return err
 	}
+	rpcLatency.Observe(time.Since(start).Seconds(), string(*rpc.Type))
 
 	// validate the reply
 	if *rpc.ID != *reply.ID {
 		return errors.New(errDiffID)
 	}
 
+	if *reply.Type == Error {
+		return reply.Error
+	}
+
 	client.resp <- Message{receiver, *reply, nil}
 	return nil
 }
@@ -152,33 +169,54 @@ func (client *Client) getRPCFromBuffer(bytesRead int, receiveAddr, sendAddr stri
 		return nil, err
 	}
 
+	err = ValidateRPC(reply)
+	if err != nil {
+		return nil, err
+	}
+
 	return reply, nil
 }
 
+// withSpan returns a copy of the client sending its RPCs as children of `span`
+func (client *Client) withSpan(span *tracing.Span) *Client {
+	traced := *client
+	traced.span = span
+	return &traced
+}
+
 func (client *Client) sendMessage(rpc *RPC, contact *Contact) (*RPC, error) {
+	span := client.span.Start(string(*rpc.Type), tracing.Client)
+	defer span.End()
+	span.SetAttribute(attrPeerID, contact.ID.String())
+	span.SetAttribute(attrPeerAddress, contact.Address)
+	span.SetAttribute(attrRPCID, *rpc.ID)
+	rpc.Trace = span.SpanContext()
+
 	client.send <- Message{*contact, *rpc, nil}
 	resp := <-client.resp
 
 	if resp.err != nil {
-		log.Warn(resp.err)
+		client.logger.WithFields(rpc.logFields()).WithField(logger.FieldPeerID, contact.ID.String()).Warn(resp.err)
+		span.SetError(resp.err)
 		return nil, resp.err
 	}
 
+	span.SetAttribute(attrResult, resp.rpc.describe())
 	return &resp.rpc, resp.err
 }
 
 // SendPingMessage sends a PING RPC to the `contact` and returns an acknowledgement. `sender` is needed in
 // case the receiving node needs information about the node who sent the RPC. Returns an error
-// if the contact fails to respond or any argument is invalid.
+// if the contact fails to respond or any argument is invalid, or an *RPCError if the contact replies with an error.
 func (client *Client) SendPingMessage(contact *Contact, sender *Contact) (*RPC, error) {
 	err := checkNilContacts(contact, sender)
 	if err != nil {
-		log.Warn(err)
+		client.logger.Warn(err)
 		return nil, err
 	}
 
 	pingMsg := pingMsg
-	payload := Payload{nil, &pingMsg, nil}
+	payload := Payload{Value: &pingMsg}
 	rpc, _ := NewRPC(Ping, sender.ID.String(), contact.ID.String(), payload)
 
 	return client.sendMessage(rpc, contact)
@@ -186,15 +224,16 @@ func (client *Client) SendPingMessage(contact *Contact, sender *Contact) (*RPC,
 
 // SendFindContactMessage sends a FIND_NODE RPC to `contact`. `sender` is needed in case the receiving
 // node needs information about the node who sent the RPC. `targetID` is the NodeID which is targeted in this RPC.
-// Returns an error if the contact fails to respond or any argument is invalid.
+// Returns an error if the contact fails to respond or any argument is invalid, or an *RPCError if the contact
+// replies with an error.
 func (client *Client) SendFindContactMessage(contact, sender *Contact, targetID *NodeID) (*RPC, error) {
 	err := checkNilContacts(contact, sender)
 	if err != nil {
-		log.Warn(err)
+		client.logger.Warn(err)
 		return nil, err
 	}
 
-	payload := Payload{nil, nil, []Contact{}}
+	payload := Payload{Contacts: []Contact{}}
 	rpc, _ := NewRPC(FindNode, sender.ID.String(), targetID.String(), payload)
 
 	return client.sendMessage(rpc, contact)
@@ -203,31 +242,227 @@ func (client *Client) SendFindContactMessage(contact, sender *Contact, targetID
 // SendFindDataMessage sends a FIND_VALUE RPC to `contact` looking for the value belonging to `key`. If the
 // value is found it will return the stored value otherwise the contacts `k` closest nodes will return.
 // Note that `key` is the hash of the value, it is used as a TargetID internally because they share the same
-// ID space. Returns an error if the contact fails to respond or any argument is invalid.
+// ID space. Returns an error if the contact fails to respond or any argument is invalid, or an *RPCError if the
+// contact replies with an error.
 func (client *Client) SendFindDataMessage(contact, sender *Contact, key string) (*RPC, error) {
 	err := checkNilContacts(contact, sender)
 	if err != nil {
-		log.Warn(err)
+		client.logger.Warn(err)
 		return nil, err
 	}
 
-	targetID := NewNodeID(key)
-	payload := Payload{&key, nil, nil}
+	targetID := KeyIDWithWidth(key, sender.ID.Bits())
+	payload := Payload{Key: &key}
 	rpc, _ := NewRPC(FindValue, sender.ID.String(), targetID.String(), payload)
 
 	return client.sendMessage(rpc, contact)
 }
 
 // SendStoreMessage sends a STORE RPC to `contact` with a given `key`, `value`. `sender` is the node that sends this
-// RPC. Note that `key` is the hash of `value`. Returns an error if the contact fails to respond or any argument is invalid.
+// RPC. Note that `key` is the hash of `value`. Returns an error if the contact fails to respond or any argument is invalid,
+// or an *RPCError if the contact replies with an error (e.g. ValueTooLarge).
 func (client *Client) SendStoreMessage(contact *Contact, sender *Contact, key string, value string) (*RPC, error) {
 	err := checkNilContacts(contact, sender)
 	if err != nil {
-		log.Warn(err)
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, Value: &value}
+	rpc, _ := NewRPC(Store, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendStoreRecordMessage sends a STORE RPC to `contact` storing `record` under `key`. `sender` is the node
+// that sends this RPC. Returns an error if the contact fails to respond or any argument is invalid, or an *RPCError
+// if the contact replies with an error (e.g. Conflict if it stores a record that wins over `record`).
+func (client *Client) SendStoreRecordMessage(contact *Contact, sender *Contact, key string, record Record) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, Record: &record}
+	rpc, _ := NewRPC(Store, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendFindRangeMessage sends a FIND_RANGE RPC to `contact` asking for the keys it stores in the range of `query`.
+// `sender` is the node that sends this RPC. Returns an error if the contact fails to respond or any argument is
+// invalid, or an *RPCError if the contact replies with an error.
+func (client *Client) SendFindRangeMessage(contact *Contact, sender *Contact, query RangeQuery) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Range: &query}
+	rpc, _ := NewRPC(FindRange, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendAddProviderMessage sends an ADD_PROVIDER RPC to `contact` asking it to keep `sender` as a provider
+// of `key` for `ttl` seconds. Returns an error if the contact fails to respond or any argument is invalid,
+// or an *RPCError if the contact replies with an error.
+func (client *Client) SendAddProviderMessage(contact *Contact, sender *Contact, key string, ttl int64) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, TTL: &ttl, Providers: []Contact{*sender}}
+	rpc, _ := NewRPC(AddProvider, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendGetProvidersMessage sends a GET_PROVIDERS RPC to `contact` asking for the providers of `key` it keeps.
+// `sender` is the node that sends this RPC. Returns an error if the contact fails to respond or any argument
+// is invalid, or an *RPCError if the contact replies with an error.
+func (client *Client) SendGetProvidersMessage(contact *Contact, sender *Contact, key string) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key}
+	rpc, _ := NewRPC(GetProviders, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendSubscribeMessage sends a SUBSCRIBE RPC to `contact` asking it to keep `sender` as a subscriber of the
+// topic stored under `key` for `ttl` seconds. Returns an error if the contact fails to respond or any argument
+// is invalid, or an *RPCError if the contact replies with an error.
+func (client *Client) SendSubscribeMessage(contact *Contact, sender *Contact, key string, ttl int64) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, TTL: &ttl}
+	rpc, _ := NewRPC(Subscribe, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendPublishMessage sends a PUBLISH RPC to `contact` with the `message` published to the topic stored under
+// `key`. The contact replies with the subscribers of the topic it keeps. Returns an error if the contact fails
+// to respond or any argument is invalid, or an *RPCError if the contact replies with an error.
+func (client *Client) SendPublishMessage(contact *Contact, sender *Contact, key string, message string) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, Value: &message}
+	rpc, _ := NewRPC(Publish, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendFindSubscribersMessage sends a PUBLISH RPC without message to `contact` asking for the page of the
+// subscribers of the topic stored under `key` it keeps whose IDs come after `after`. Returns an error if the
+// contact fails to respond or any argument is invalid, or an *RPCError if the contact replies with an error.
+func (client *Client) SendFindSubscribersMessage(contact *Contact, sender *Contact, key string, after string) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, Range: &RangeQuery{After: after, Limit: MaxContacts}}
+	rpc, _ := NewRPC(Publish, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendWatchMessage sends an ADD_WATCHER RPC to `contact` asking it to notify `sender` of the events of `key`
+// for `ttl` seconds. Returns an error if the contact fails to respond or any argument is invalid, or an
+// *RPCError if the contact replies with an error.
+func (client *Client) SendWatchMessage(contact *Contact, sender *Contact, key string, ttl int64) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, TTL: &ttl}
+	rpc, _ := NewRPC(AddWatcher, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendNotifyMessage sends a NOTIFY RPC to `contact` telling it that `kind` happened to `key`, which now
+// holds `value`. `sender` is the node that sends this RPC. Returns an error if the contact fails to respond
+// or any argument is invalid, or an *RPCError if the contact replies with an error.
+func (client *Client) SendNotifyMessage(contact *Contact, sender *Contact, key string, kind EventKind, value string) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Key: &key, Value: &value, Event: &kind}
+	rpc, _ := NewRPC(Notify, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendStoreBatchMessage sends a STORE RPC to `contact` storing the values of `entries` under their keys. `sender`
+// is the node that sends this RPC. The reply carries the keys the contact stored. Returns an error if the contact
+// fails to respond or any argument is invalid, or an *RPCError if the contact replies with an error.
+func (client *Client) SendStoreBatchMessage(contact *Contact, sender *Contact, entries []BatchEntry) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Entries: entries}
+	rpc, _ := NewRPC(Store, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendFindValuesMessage sends a FIND_VALUE RPC to `contact` looking for the values of the keys of `entries`.
+// `sender` is the node that sends this RPC. The reply carries the entries the contact stores a value for.
+// Returns an error if the contact fails to respond or any argument is invalid, or an *RPCError if the contact
+// replies with an error.
+func (client *Client) SendFindValuesMessage(contact *Contact, sender *Contact, entries []BatchEntry) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
+		return nil, err
+	}
+
+	payload := Payload{Entries: entries}
+	rpc, _ := NewRPC(FindValue, sender.ID.String(), contact.ID.String(), payload)
+
+	return client.sendMessage(rpc, contact)
+}
+
+// SendCacheMessage sends a STORE RPC to `contact` asking it to cache `value` found under
+// `key` for `ttl` seconds. `sender` is the node that sends this RPC. Returns an error if
+// the contact fails to respond or any argument is invalid, or an *RPCError if the contact
+// replies with an error.
+func (client *Client) SendCacheMessage(contact *Contact, sender *Contact, key string, value string, ttl int64) (*RPC, error) {
+	err := checkNilContacts(contact, sender)
+	if err != nil {
+		client.logger.Warn(err)
 		return nil, err
 	}
 
-	payload := Payload{&key, &value, nil}
+	payload := Payload{Key: &key, Value: &value, TTL: &ttl}
 	rpc, _ := NewRPC(Store, sender.ID.String(), contact.ID.String(), payload)
 
 	return client.sendMessage(rpc, contact)
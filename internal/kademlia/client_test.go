@@ -1,6 +1,8 @@
 package kademlia
 
 import (
+	"errors"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -57,7 +59,36 @@ func TestGetLocalIp(t *testing.T) {
 // 	nodeID := NewNodeID("00000000000000000000000000000000FFFFFFFF")
 // 	c := NewContact(nodeID, "10.0.8.1:8080")
 
-// 	payload := Payload{nil, nil, []Contact{}}
+// 	payload := Payload{Contacts: []Contact{}}
 // 	_, err := network.sendRPC(&c, Ping, nodeID, nodeID, payload)
 // 	assert.Error(t, err)
 // }
+
+func TestSendMessageErrorReply(t *testing.T) {
+	addr, _ := net.ResolveUDPAddr(udpNetwork, "127.0.0.1:9095")
+	conn, _ := net.ListenUDP(udpNetwork, addr)
+	defer conn.Close()
+
+	// reply to the first RPC with an ERROR RPC
+	go func() {
+		buffer := make([]byte, UDPReadBufferSize)
+		n, clientAddr, _ := conn.ReadFromUDP(buffer)
+		rpc, _ := UnmarshalRPC(buffer[:n])
+		reply := NewErrorRPC(rpc, "1111111100000000000000000000000000000000", ValueTooLarge, errValueTooLarge)
+		data, _ := MarshalRPC(*reply)
+		conn.WriteToUDP(data, clientAddr)
+	}()
+
+	client := InitClient()
+	client.Start()
+	contact := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "127.0.0.1:9095")
+	sender := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "127.0.0.1:8080")
+
+	rpc, err := client.SendStoreMessage(&contact, &sender, "key", "value")
+	assert.Nil(t, rpc)
+
+	var rpcError *RPCError
+	assert.True(t, errors.As(err, &rpcError))
+	assert.Equal(t, ValueTooLarge, rpcError.Code)
+	assert.Equal(t, errValueTooLarge, rpcError.Message)
+}
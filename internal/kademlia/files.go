@@ -0,0 +1,363 @@
+package kademlia
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// fileChunkSize the number of file bytes stored in a chunk, so that the base64
+// encoded chunk fits in a value
+const fileChunkSize = MaxDataSize / 4 * 3
+
+// fileBatch the number of chunks and indexes StoreFile buffers before storing them
+const fileBatch = MaxBatchEntries * 4
+
+// maxFileDepth the largest depth of the index tree of a file
+const maxFileDepth = 32
+
+const (
+	errBadManifest  string = "file manifest is not valid"
+	errMissingChunk string = "file chunk not found"
+	errBadOffset    string = "seek to a negative offset"
+	errBadWhence    string = "seek whence is not valid"
+)
+
+// FileManifest is stored under the key of a file. The file is split into chunks
+// of `Chunk` bytes which are the leaves of a tree of indexes, each linking up to
+// `Fanout` chunks or indexes. The manifest is the root of the tree at `Depth`,
+// indexes at depth 0 link chunks. `Hash` is the hash of the content of the file.
+type FileManifest struct {
+	Hash   string   `json:"hash"`
+	Size   int64    `json:"size"`
+	Chunk  int      `json:"chunk"`
+	Fanout int      `json:"fanout"`
+	Depth  int      `json:"depth"`
+	Links  []string `json:"links"`
+}
+
+// fileIndex is an index of the tree of a file below its manifest
+type fileIndex struct {
+	Links []string `json:"links"`
+}
+
+// fileFanout returns the largest number of links which fit in a manifest when
+// keys are made with `function`
+func fileFanout(function HashFunction) int {
+	key := HashKey(function, nil)
+	manifest := FileManifest{key, math.MaxInt64, fileChunkSize, 99, maxFileDepth, []string{}}
+	data, _ := json.Marshal(manifest)
+
+	return (MaxDataSize - len(data)) / (len(key) + len(`"",`))
+}
+
+func validateManifest(manifest *FileManifest) error {
+	if manifest.Size < 0 || manifest.Chunk <= 0 || manifest.Fanout < 2 ||
+		manifest.Depth < 0 || manifest.Depth > maxFileDepth || len(manifest.Links) > manifest.Fanout {
+		return errors.New(errBadManifest)
+	}
+	return nil
+}
+
+// IsBadManifest returns true if `err` means that the value stored under the hash
+// of a file, or one of its indexes, is not a valid manifest or index
+func IsBadManifest(err error) bool {
+	return err != nil && err.Error() == errBadManifest
+}
+
+// span returns the number of chunks below each link of an index at `depth`,
+// or math.MaxInt64 if it is larger
+func (manifest *FileManifest) span(depth int) int64 {
+	span := int64(1)
+	for i := 0; i < depth; i++ {
+		if span > math.MaxInt64/int64(manifest.Fanout) {
+			return math.MaxInt64
+		}
+		span *= int64(manifest.Fanout)
+	}
+	return span
+}
+
+// fileBuilder builds the tree of indexes of a file while its chunks are added,
+// storing the chunks and indexes in batches
+type fileBuilder struct {
+	node     *Node
+	function HashFunction
+	fanout   int
+	levels   [][]string
+	pending  []string
+}
+
+// add stores `value` and links it from the index at depth `level` being built.
+// The index is added to the level above once it links `fanout` values.
+func (builder *fileBuilder) add(level int, value string) error {
+	builder.pending = append(builder.pending, value)
+	if len(builder.pending) >= fileBatch {
+		err := builder.flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(builder.levels) == level {
+		builder.levels = append(builder.levels, []string{})
+	}
+
+	builder.levels[level] = append(builder.levels[level], HashKey(builder.function, []byte(value)))
+	if len(builder.levels[level]) < builder.fanout {
+		return nil
+	}
+	return builder.close(level)
+}
+
+// close adds the index linking the values of `level` to the level above
+func (builder *fileBuilder) close(level int) error {
+	data, _ := json.Marshal(fileIndex{builder.levels[level]})
+	builder.levels[level] = []string{}
+	return builder.add(level+1, string(data))
+}
+
+// flush stores the pending values
+func (builder *fileBuilder) flush() error {
+	values := builder.pending
+	builder.pending = nil
+
+	_, err := builder.node.StoreBatch(values)
+	return err
+}
+
+// finish closes the partial indexes of every level but the top one, which becomes
+// the links of the manifest, and stores the manifest. Returns its key.
+func (builder *fileBuilder) finish(manifest *FileManifest) (string, error) {
+	if len(builder.levels) == 0 {
+		builder.levels = [][]string{{}}
+	}
+
+	for level := 0; level < len(builder.levels)-1; level++ {
+		if len(builder.levels[level]) == 0 {
+			continue
+		}
+		err := builder.close(level)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	manifest.Depth = len(builder.levels) - 1
+	manifest.Links = builder.levels[manifest.Depth]
+	data, _ := json.Marshal(manifest)
+
+	builder.pending = append(builder.pending, string(data))
+	return HashKey(builder.function, data), builder.flush()
+}
+
+// StoreFile stores the content read from `reader` in chunks and returns the key
+// of the manifest of the file. The chunks and indexes are stored in batches while
+// the content is read, so that the file does not have to fit in memory. Returns
+// an error if reading fails or fewer nodes than the write quorum acknowledged a value.
+func (kademlia *Node) StoreFile(reader io.Reader) (string, *FileManifest, error) {
+	span := kademlia.tracer.Start("StoreFile", tracing.Internal, nil)
+	defer span.End()
+
+	function := kademlia.HashFunction()
+	builder := fileBuilder{kademlia, function, fileFanout(function), nil, nil}
+	content := function.newHash()
+	size := int64(0)
+
+	buffer := make([]byte, fileChunkSize)
+	for {
+		n, err := io.ReadFull(reader, buffer)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			span.SetError(err)
+			return "", nil, err
+		}
+
+		content.Write(buffer[:n])
+		size += int64(n)
+
+		addErr := builder.add(0, base64.StdEncoding.EncodeToString(buffer[:n]))
+		if addErr != nil {
+			span.SetError(addErr)
+			return "", nil, addErr
+		} else if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	manifest := &FileManifest{Hash: canonicalHash(function, content.Sum(nil)), Size: size,
+		Chunk: fileChunkSize, Fanout: builder.fanout}
+	key, err := builder.finish(manifest)
+	if err != nil {
+		span.SetError(err)
+		return "", nil, err
+	}
+
+	span.SetAttribute(attrKey, key)
+	return key, manifest, nil
+}
+
+// FileReader reads a file stored with StoreFile. The chunks linked by an index
+// are found together when the first of them is read.
+type FileReader struct {
+	Manifest *FileManifest
+	node     *Node
+	offset   int64
+	path     map[int]cachedIndex
+	leaf     string
+	chunks   map[string][]byte
+}
+
+// cachedIndex is the last index read at a depth of the tree of a file
+type cachedIndex struct {
+	key   string
+	links []string
+}
+
+// OpenFile returns a FileReader of the file whose manifest is stored under `hash`
+func (kademlia *Node) OpenFile(hash string) (*FileReader, error) {
+	value, err := kademlia.FindValue(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &FileManifest{}
+	err = json.Unmarshal([]byte(entryData(value)), manifest)
+	if err != nil {
+		return nil, errors.New(errBadManifest)
+	}
+
+	err = validateManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	path := map[int]cachedIndex{manifest.Depth: {normalizeKey(hash), manifest.Links}}
+	return &FileReader{manifest, kademlia, 0, path, "", nil}, nil
+}
+
+// Read reads the file from the current offset, up to the end of a chunk
+func (reader *FileReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.Manifest.Size {
+		return 0, io.EOF
+	}
+
+	chunkSize := int64(reader.Manifest.Chunk)
+	chunk, err := reader.chunk(reader.offset / chunkSize)
+	if err != nil {
+		return 0, err
+	}
+
+	start := reader.offset % chunkSize
+	if start >= int64(len(chunk)) {
+		return 0, errors.New(errBadManifest)
+	}
+
+	n := copy(p, chunk[start:])
+	reader.offset += int64(n)
+	return n, nil
+}
+
+// Seek sets the offset of the next Read as io.Seeker does
+func (reader *FileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.Manifest.Size
+	default:
+		return 0, errors.New(errBadWhence)
+	}
+
+	if offset < 0 {
+		return 0, errors.New(errBadOffset)
+	}
+	reader.offset = offset
+	return offset, nil
+}
+
+// chunk returns the content of the chunk at `position` in the file
+func (reader *FileReader) chunk(position int64) ([]byte, error) {
+	manifest := reader.Manifest
+	index := reader.path[manifest.Depth]
+
+	for depth := manifest.Depth; depth > 0; depth-- {
+		span := manifest.span(depth)
+		child := position / span
+		if child >= int64(len(index.links)) {
+			return nil, errors.New(errBadManifest)
+		}
+		position %= span
+
+		var err error
+		index, err = reader.index(depth-1, index.links[child])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if position >= int64(len(index.links)) {
+		return nil, errors.New(errBadManifest)
+	}
+
+	if reader.leaf != index.key {
+		err := reader.readLeaf(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunk, ok := reader.chunks[index.links[position]]
+	if !ok {
+		return nil, errors.New(errMissingChunk)
+	}
+	return chunk, nil
+}
+
+// index returns the index stored under `key` at `depth`, finding it unless it
+// was the last index read at that depth
+func (reader *FileReader) index(depth int, key string) (cachedIndex, error) {
+	if cached, ok := reader.path[depth]; ok && cached.key == key {
+		return cached, nil
+	}
+
+	value, err := reader.node.FindValue(key)
+	if err != nil {
+		return cachedIndex{}, err
+	}
+
+	index := fileIndex{}
+	err = json.Unmarshal([]byte(entryData(value)), &index)
+	if err != nil || len(index.Links) > reader.Manifest.Fanout {
+		return cachedIndex{}, errors.New(errBadManifest)
+	}
+
+	reader.path[depth] = cachedIndex{key, index.Links}
+	return reader.path[depth], nil
+}
+
+// readLeaf finds every chunk linked by the index at depth 0 `index`
+func (reader *FileReader) readLeaf(index cachedIndex) error {
+	values, err := reader.node.FindValues(index.links)
+	if err != nil {
+		return err
+	}
+
+	chunks := map[string][]byte{}
+	for key, value := range values {
+		chunk, err := base64.StdEncoding.DecodeString(entryData(value))
+		if err != nil {
+			return errors.New(errBadManifest)
+		}
+		chunks[key] = chunk
+	}
+
+	reader.leaf, reader.chunks = index.key, chunks
+	return nil
+}
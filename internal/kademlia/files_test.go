@@ -0,0 +1,84 @@
+package kademlia
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileFanout(t *testing.T) {
+	for _, function := range []HashFunction{SHA1, SHA256} {
+		fanout := fileFanout(function)
+		assert.True(t, fanout >= 2)
+
+		links := []string{}
+		for i := 0; i < fanout; i++ {
+			links = append(links, HashKey(function, nil))
+		}
+		data, _ := json.Marshal(FileManifest{HashKey(function, nil), 1 << 62, fileChunkSize, fanout, maxFileDepth, links})
+		assert.True(t, len(data) <= MaxDataSize)
+	}
+}
+
+func TestStoreAndReadFile(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2920"), "10.0.8.2:8080")
+	node := newServedNode(me, peer, func(rpc RPC) {})
+
+	content := make([]byte, fileChunkSize*fileFanout(SHA1)*fileFanout(SHA1)+10)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	key, manifest, err := node.StoreFile(bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, HashKey(SHA1, content), manifest.Hash)
+	assert.Equal(t, int64(len(content)), manifest.Size)
+	assert.Equal(t, 2, manifest.Depth)
+
+	file, err := node.OpenFile(key)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, file.Manifest)
+
+	read, err := ioutil.ReadAll(file)
+	assert.NoError(t, err)
+	assert.Equal(t, content, read)
+
+	// reads continue from any offset
+	offset := int64(fileChunkSize*3 + 7)
+	_, err = file.Seek(offset, io.SeekStart)
+	assert.NoError(t, err)
+	part := make([]byte, fileChunkSize*2)
+	_, err = io.ReadFull(file, part)
+	assert.NoError(t, err)
+	assert.Equal(t, content[offset:offset+int64(len(part))], part)
+
+	_, err = file.Seek(-1, io.SeekStart)
+	assert.EqualError(t, err, errBadOffset)
+}
+
+func TestStoreEmptyFile(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2920"), "10.0.8.2:8080")
+	node := newServedNode(me, peer, func(rpc RPC) {})
+
+	key, manifest, err := node.StoreFile(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, manifest.Depth)
+	assert.Equal(t, []string{}, manifest.Links)
+
+	file, err := node.OpenFile(key)
+	assert.NoError(t, err)
+	read, err := ioutil.ReadAll(file)
+	assert.NoError(t, err)
+	assert.Empty(t, read)
+
+	// values which are not manifests are not opened
+	result, _ := node.StoreValue("not a manifest")
+	_, err = node.OpenFile(result.Key)
+	assert.EqualError(t, err, errBadManifest)
+	assert.True(t, IsBadManifest(err))
+}
@@ -0,0 +1,81 @@
+//go:build go1.18
+// +build go1.18
+
+package kademlia
+
+import (
+	"testing"
+)
+
+// fuzzSeeds returns valid and almost valid RPCs to start the fuzzer from
+func fuzzSeeds() [][]byte {
+	senderID := "00000000000000000000000000000000FFFFFFFF"
+	key := "1111111100000000000000000000000000000000"
+	value := "1600000000:hello"
+	contact := NewContact(NewNodeID(key), "10.0.8.2:8080")
+
+	seeds := [][]byte{
+		[]byte(`{}`),
+		[]byte(`null`),
+		[]byte(`{"type":"PING"}`),
+		[]byte(`{"type":"FIND_NODE","payload":{"contacts":[{"id":null}]}}`),
+		[]byte(`{"type":"STORE","id":"00","senderID":"zz","targetID":""}`),
+	}
+
+	rpcs := []*RPC{}
+	for _, rpcType := range rpcTypes {
+		rpc, _ := NewRPC(rpcType, senderID, key, Payload{Key: &key, Value: &value, Contacts: []Contact{contact}})
+		rpcs = append(rpcs, rpc)
+	}
+
+	for _, rpc := range rpcs {
+		data, _ := MarshalRPC(*rpc)
+		seeds = append(seeds, data)
+	}
+
+	return seeds
+}
+
+func FuzzUnmarshalRPC(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rpc, err := UnmarshalRPC(data)
+		if err != nil {
+			return
+		}
+
+		err = ValidateRPC(rpc)
+		if err != nil {
+			return
+		}
+
+		_, err = MarshalRPC(*rpc)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func FuzzServerHandlers(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		node := Node{content: make(map[string]string), deadline: 10}
+		me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+		node.RT = NewRoutingTable(me)
+		node.RT.AddContact(NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080"))
+		server := InitServer(&node)
+
+		rpc, err := server.parsePacket(data)
+		if err != nil {
+			return
+		}
+
+		server.handleIncomingRPCS(rpc, "10.0.8.3")
+	})
+}
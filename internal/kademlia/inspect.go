@@ -0,0 +1,136 @@
+package kademlia
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const errBadAddress string = "address must be host:port"
+
+// NodeInfo describes a running node
+type NodeInfo struct {
+	ID      string     `json:"id"`
+	Address string     `json:"address"`
+	Started time.Time  `json:"started"`
+	Uptime  float64    `json:"uptime"`
+	Config  NodeConfig `json:"config"`
+}
+
+// NodeConfig the settings of a node. `Expiry` is the number of seconds a
+// value is kept and `UpdateInterval` the seconds between expiry checks.
+// `HashFunction` is the multihash name of the function values are stored with
+// `IDWidth` is the number of bits in the IDs of the network and `RoutingTable`
+// the kind of routing table of the node.
+type NodeConfig struct {
+	BucketSize     int    `json:"k"`
+	Alpha          int    `json:"alpha"`
+	Expiry         int64  `json:"expiry"`
+	UpdateInterval int    `json:"updateInterval"`
+	MaxDataSize    int    `json:"maxDataSize"`
+	Tracing        bool   `json:"tracing"`
+	HashFunction   string `json:"hashFunction"`
+	IDWidth        int    `json:"idWidth"`
+	RoutingTable   string `json:"routingTable"`
+}
+
+// StoreEntry describes a value in the local store of a node. `Cached` is set
+// for values cached because a lookup passed the node, which are not replicas.
+type StoreEntry struct {
+	Key     string    `json:"key"`
+	Size    int       `json:"size"`
+	Stored  time.Time `json:"stored"`
+	Expires time.Time `json:"expires"`
+	Cached  bool      `json:"cached,omitempty"`
+}
+
+// PingResult the node that replied to a ping and the time it took
+type PingResult struct {
+	ID      string        `json:"id"`
+	Address string        `json:"address"`
+	RTT     time.Duration `json:"rtt"`
+}
+
+// Info returns the ID, address, uptime and config of the node
+func (kademlia *Node) Info() NodeInfo {
+	me := kademlia.RT.GetMe()
+
+	return NodeInfo{
+		ID:      me.ID.String(),
+		Address: me.Address,
+		Started: kademlia.started,
+		Uptime:  time.Since(kademlia.started).Seconds(),
+		Config: NodeConfig{
+			BucketSize:     BucketSize,
+			Alpha:          lookupAlpha,
+			Expiry:         kademlia.deadline,
+			UpdateInterval: updateTimer,
+			MaxDataSize:    MaxDataSize,
+			Tracing:        kademlia.tracer != nil,
+			HashFunction:   kademlia.HashFunction().String(),
+			IDWidth:        kademlia.IDWidth(),
+			RoutingTable:   kademlia.RoutingTableKind(),
+		},
+	}
+}
+
+// StoreEntries returns every value in the local store sorted by key
+func (kademlia *Node) StoreEntries() []StoreEntry {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	entries := []StoreEntry{}
+	for key, value := range kademlia.content {
+		entry := StoreEntry{Key: key, Size: len(value)}
+
+		// values are stored as "timestamp:data"
+		timestamp, err := strconv.ParseInt(strings.SplitN(value, ":", 2)[0], 10, 64)
+		if err == nil {
+			entry.Stored = time.Unix(timestamp, 0)
+			entry.Expires = time.Unix(timestamp+kademlia.deadline, 0)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	for key, cached := range kademlia.cache {
+		entry := StoreEntry{Key: key, Size: len(cached.value), Expires: cached.expires, Cached: true}
+
+		timestamp, err := strconv.ParseInt(strings.SplitN(cached.value, ":", 2)[0], 10, 64)
+		if err == nil {
+			entry.Stored = time.Unix(timestamp, 0)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// PingAddress pings the node at `address` without knowing its ID. The node
+// is added to the routing table if it replies.
+func (kademlia *Node) PingAddress(address string) (*PingResult, error) {
+	_, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.New(errBadAddress)
+	}
+
+	contact := NewContact(NewNodeID(""), address)
+	start := time.Now()
+	rpc, err := kademlia.client.SendPingMessage(&contact, kademlia.RT.GetMe())
+	if err != nil {
+		return nil, err
+	}
+	rtt := time.Since(start)
+
+	id := NewNodeID(*rpc.SenderID)
+	kademlia.RT.AddContact(NewContact(id, address))
+
+	return &PingResult{id.String(), address, rtt}, nil
+}
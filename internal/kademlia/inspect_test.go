@@ -0,0 +1,57 @@
+package kademlia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreEntries(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.insertLocalStore("b", "1600000000:there")
+	node.insertLocalStore("a", "broken")
+
+	entries := node.StoreEntries()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "a", entries[0].Key)
+	assert.True(t, entries[0].Expires.IsZero())
+	assert.Equal(t, "b", entries[1].Key)
+	assert.Equal(t, 16, entries[1].Size)
+	assert.Equal(t, time.Unix(1600000000, 0), entries[1].Stored)
+	assert.Equal(t, time.Unix(1600000010, 0), entries[1].Expires)
+}
+
+func TestPingAddress(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peerID := NewNodeID("1111111100000000000000000000000000000000")
+
+	node := Node{}
+	node.RT = NewRoutingTable(me)
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, peerID.String(), me.ID.String(), Payload{})
+		return Message{message.receiver, *reply, nil}
+	})
+
+	_, err := node.PingAddress("10.0.8.2")
+	assert.EqualError(t, err, errBadAddress)
+
+	result, err := node.PingAddress("10.0.8.2:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, peerID.String(), result.ID)
+	assert.Equal(t, 1, node.RT.BucketSizes()[3])
+}
+
+func TestRoutingTableBuckets(t *testing.T) {
+	routingTable := NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	assert.Equal(t, 0, len(routingTable.Buckets()))
+
+	contact := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080")
+	routingTable.AddContact(contact)
+	buckets := routingTable.Buckets()
+	assert.Equal(t, 1, len(buckets))
+	assert.Equal(t, "10.0.8.2:8080", buckets[0].Contacts[0].Address)
+
+	routingTable.RemoveContact(contact)
+	assert.Equal(t, 0, len(routingTable.Buckets()))
+}
@@ -0,0 +1,75 @@
+package kademlia
+
+import (
+	"strconv"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/metrics"
+)
+
+// lookupBuckets are the upper bounds of the lookup hop count histogram
+var lookupBuckets = []float64{1, 2, 3, 5, 8, 13, 21}
+
+var (
+	rpcsSent = metrics.DefaultRegistry.NewCounter("kademlia_rpcs_sent_total",
+		"Number of RPCs sent by the client.", "type")
+	rpcsReceived = metrics.DefaultRegistry.NewCounter("kademlia_rpcs_received_total",
+		"Number of RPCs handled by the server.", "type")
+	rpcErrors = metrics.DefaultRegistry.NewCounter("kademlia_rpc_errors_total",
+		"Number of ERROR RPCs replied by the server.", "code")
+	rpcTimeouts = metrics.DefaultRegistry.NewCounter("kademlia_rpc_timeouts_total",
+		"Number of RPCs sent by the client that got no reply in time.", "type")
+	rpcLatency = metrics.DefaultRegistry.NewHistogram("kademlia_rpc_latency_seconds",
+		"Time between sending an RPC and receiving its reply.", nil, "type")
+	packetsDropped = metrics.DefaultRegistry.NewCounter("kademlia_packets_dropped_total",
+		"Number of packets dropped by the server.", "reason")
+	lookupHops = metrics.DefaultRegistry.NewHistogram("kademlia_lookup_hops",
+		"Number of rounds of queries a lookup took.", lookupBuckets, "lookup")
+	expirations = metrics.DefaultRegistry.NewCounter("kademlia_store_expirations_total",
+		"Number of stored values that expired.")
+	badResponses = metrics.DefaultRegistry.NewCounter("kademlia_bad_responses_total",
+		"Number of lookup replies holding values which were not valid for the key.")
+	readDisagreements = metrics.DefaultRegistry.NewCounter("kademlia_read_disagreements_total",
+		"Number of quorum reads where the replicas returned different values.")
+)
+
+// RegisterMetrics adds the gauges describing the routing table and local
+// store of the node to `registry`
+func (kademlia *Node) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("kademlia_routing_table_contacts",
+		"Number of contacts in each non empty bucket of the routing table.",
+		kademlia.collectBucketSizes, "bucket")
+	registry.NewGaugeFunc("kademlia_store_keys",
+		"Number of keys in the local store.",
+		kademlia.collectStoreKeys)
+	registry.NewGaugeFunc("kademlia_store_bytes",
+		"Number of value bytes in the local store.",
+		kademlia.collectStoreBytes)
+}
+
+func (kademlia *Node) collectBucketSizes() []metrics.Sample {
+	samples := []metrics.Sample{}
+	for i, size := range kademlia.RT.BucketSizes() {
+		if size > 0 {
+			samples = append(samples, metrics.Sample{LabelValues: []string{strconv.Itoa(i)}, Value: float64(size)})
+		}
+	}
+	return samples
+}
+
+func (kademlia *Node) collectStoreKeys() []metrics.Sample {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	return []metrics.Sample{{Value: float64(len(kademlia.content))}}
+}
+
+func (kademlia *Node) collectStoreBytes() []metrics.Sample {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	bytes := 0
+	for _, value := range kademlia.content {
+		bytes += len(value)
+	}
+	return []metrics.Sample{{Value: float64(bytes)}}
+}
@@ -0,0 +1,53 @@
+package kademlia
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/metrics"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	node.RT.AddContact(NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080"))
+	node.insertLocalStore("hello", "1600000000:there")
+
+	registry := metrics.NewRegistry()
+	node.RegisterMetrics(registry)
+
+	out := bytes.NewBuffer(nil)
+	registry.Write(out)
+
+	assert.Contains(t, out.String(), "kademlia_routing_table_contacts{bucket=\"3\"} 1\n")
+	assert.Contains(t, out.String(), "kademlia_store_keys 1\n")
+	assert.Contains(t, out.String(), "kademlia_store_bytes 16\n")
+}
+
+func TestServerCountsRPCs(t *testing.T) {
+	node := Node{}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	received := rpcsReceived.Value(string(Store))
+	badRequests := rpcErrors.Value(string(BadRequest))
+
+	rpc, _ := NewRPC(Store, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{})
+	server.incoming <- packet{rpc, "127.0.0.1", nil}
+	server.readIncomingChannel()
+	<-server.outgoing
+
+	assert.Equal(t, received+1, rpcsReceived.Value(string(Store)))
+	assert.Equal(t, badRequests+1, rpcErrors.Value(string(BadRequest)))
+}
+
+func TestUpdateContentCountsExpirations(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 0}
+	node.insertLocalStore("hello", "1000:there")
+
+	expired := expirations.Value()
+	node.updateContent()
+
+	assert.Equal(t, expired+1, expirations.Value())
+}
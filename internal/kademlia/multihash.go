@@ -0,0 +1,171 @@
+package kademlia
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+)
+
+// HashFunction is the multihash code of a hash function keys are made with
+type HashFunction uint8
+
+// HashFunction declaration
+const (
+	SHA1   = HashFunction(0x11)
+	SHA256 = HashFunction(0x12)
+)
+
+// EnvHashFunction is the environment variable naming the hash function StoreValue
+// uses, either "sha1" or "sha2-256"
+const EnvHashFunction string = "KADEMLIA_HASH"
+
+const (
+	errBadHash         string = "key is not a hex encoded SHA-1 hash or multihash"
+	errUnknownFunction string = "unknown hash function"
+)
+
+var hashFunctionNames = map[HashFunction]string{
+	SHA1:   "sha1",
+	SHA256: "sha2-256",
+}
+
+// ParseHashFunction returns the hash function called `name`
+func ParseHashFunction(name string) (HashFunction, error) {
+	for function, functionName := range hashFunctionNames {
+		if functionName == name {
+			return function, nil
+		}
+	}
+	return 0, errors.New(errUnknownFunction)
+}
+
+// String returns the multihash name of the hash function
+func (function HashFunction) String() string {
+	return hashFunctionNames[function]
+}
+
+// size returns the length of the digests of the hash function in bytes
+func (function HashFunction) size() int {
+	switch function {
+	case SHA1:
+		return sha1.Size
+	case SHA256:
+		return sha256.Size
+	}
+	return 0
+}
+
+// sum returns the digest of `data`
+func (function HashFunction) sum(data []byte) []byte {
+	switch function {
+	case SHA256:
+		digest := sha256.Sum256(data)
+		return digest[:]
+	default:
+		digest := sha1.Sum(data)
+		return digest[:]
+	}
+}
+
+// newHash returns a hash.Hash computing the digests of the hash function
+func (function HashFunction) newHash() hash.Hash {
+	if function == SHA256 {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+// Multihash returns the hex encoded multihash of `digest` made with `function`
+func Multihash(function HashFunction, digest []byte) string {
+	return hex.EncodeToString(append([]byte{byte(function), byte(len(digest))}, digest...))
+}
+
+// HashKey returns the key `data` is stored under when hashed with `function`.
+// SHA-1 keys are plain hex digests, as used before keys were multihashes, and
+// keys of other functions are multihashes.
+func HashKey(function HashFunction, data []byte) string {
+	return canonicalHash(function, function.sum(data))
+}
+
+func canonicalHash(function HashFunction, digest []byte) string {
+	if function == SHA1 {
+		return hex.EncodeToString(digest)
+	}
+	return Multihash(function, digest)
+}
+
+// ParseHash returns the hash function and digest of `hash`, which is either a
+// hex encoded multihash or a plain hex encoded SHA-1 or SHA-256 digest
+func ParseHash(hash string) (HashFunction, []byte, error) {
+	decoded, err := hex.DecodeString(hash)
+	if err != nil {
+		return 0, nil, errors.New(errBadHash)
+	}
+
+	switch {
+	case len(decoded) == sha1.Size:
+		return SHA1, decoded, nil
+	case len(decoded) == sha256.Size:
+		return SHA256, decoded, nil
+	case len(decoded) > 2:
+		function := HashFunction(decoded[0])
+		if function.size() != 0 && int(decoded[1]) == function.size() && len(decoded) == function.size()+2 {
+			return function, decoded[2:], nil
+		}
+	}
+	return 0, nil, errors.New(errBadHash)
+}
+
+// NormalizeHash returns the form of `hash` values are stored under, so that a
+// SHA-1 multihash and the plain SHA-1 digest name the same key
+func NormalizeHash(hash string) (string, error) {
+	function, digest, err := ParseHash(hash)
+	if err != nil {
+		return "", err
+	}
+	return canonicalHash(function, digest), nil
+}
+
+// normalizeKey returns `key` with its hash normalized, or `key` itself if it
+// is not a valid key
+func normalizeKey(key string) string {
+	namespace, hash, err := ParseKey(key)
+	if err != nil {
+		return key
+	}
+
+	normalized, err := NormalizeHash(hash)
+	if err != nil {
+		return key
+	}
+	return namespace + normalized
+}
+
+// hashID maps `digest` into the space of IDs `bits` wide. Digests longer than
+// an ID are truncated, so the XOR metric compares their first bytes, and
+// shorter digests are zero padded.
+func hashID(digest []byte, bits int) *NodeID {
+	return newNodeIDFromBytes(digest, bits/8)
+}
+
+// verifyDigest returns true if `data` hashes to `hash`
+func verifyDigest(hash string, data []byte) bool {
+	function, digest, err := ParseHash(hash)
+	return err == nil && bytes.Equal(function.sum(data), digest)
+}
+
+// SetHashFunction sets the hash function StoreValue makes keys with
+func (kademlia *Node) SetHashFunction(function HashFunction) {
+	kademlia.hashFunction = function
+}
+
+// HashFunction returns the hash function StoreValue makes keys with, SHA-1 by default
+func (kademlia *Node) HashFunction() HashFunction {
+	if kademlia.hashFunction.size() == 0 {
+		return SHA1
+	}
+	return kademlia.hashFunction
+}
@@ -0,0 +1,80 @@
+package kademlia
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHash(t *testing.T) {
+	plain := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+
+	function, digest, err := ParseHash(plain)
+	assert.NoError(t, err)
+	assert.Equal(t, SHA1, function)
+	assert.Equal(t, plain, hex.EncodeToString(digest))
+
+	function, digest, err = ParseHash("1114" + plain)
+	assert.NoError(t, err)
+	assert.Equal(t, SHA1, function)
+	assert.Equal(t, plain, hex.EncodeToString(digest))
+
+	sum := sha256.Sum256([]byte("there"))
+	function, digest, err = ParseHash(Multihash(SHA256, sum[:]))
+	assert.NoError(t, err)
+	assert.Equal(t, SHA256, function)
+	assert.Equal(t, sum[:], digest)
+
+	for _, hash := range []string{"abcd", "zz" + plain[2:], "1214" + plain, "1115" + plain, "9914" + plain} {
+		_, _, err = ParseHash(hash)
+		assert.EqualError(t, err, errBadHash, hash)
+	}
+}
+
+func TestNormalizeHash(t *testing.T) {
+	plain := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+
+	normalized, err := NormalizeHash("1114" + plain)
+	assert.NoError(t, err)
+	assert.Equal(t, plain, normalized)
+
+	sum := sha256.Sum256([]byte("there"))
+	normalized, err = NormalizeHash(hex.EncodeToString(sum[:]))
+	assert.NoError(t, err)
+	assert.Equal(t, "1220"+hex.EncodeToString(sum[:]), normalized)
+
+	assert.Equal(t, ContentNamespace+plain, normalizeKey(ContentNamespace+"1114"+plain))
+}
+
+func TestHashKey(t *testing.T) {
+	assert.Equal(t, "490528f36debf7c15cea5e9a9d1ea024cf6b2921", HashKey(SHA1, []byte("there")))
+
+	key := HashKey(SHA256, []byte("there"))
+	assert.Equal(t, 68, len(key))
+	assert.NoError(t, verifyContent(key, "1600000000:there"))
+	assert.EqualError(t, verifyContent(key, "1600000000:elsewhere"), errBadContentHash)
+
+	// SHA-256 digests are truncated to the ID length in the key space
+	assert.Equal(t, NewNodeID(key[4:4+IDLength*2]), KeyID(key))
+	assert.Equal(t, KeyID("490528f36debf7c15cea5e9a9d1ea024cf6b2921"), KeyID("1114490528f36debf7c15cea5e9a9d1ea024cf6b2921"))
+
+	// in a 256-bit network SHA-256 digests are IDs and SHA-1 digests are zero padded
+	assert.Equal(t, key[4:], KeyIDWithWidth(key, MaxIDLength*8).String())
+	assert.Equal(t, "490528f36debf7c15cea5e9a9d1ea024cf6b2921000000000000000000000000", KeyIDWithWidth("490528f36debf7c15cea5e9a9d1ea024cf6b2921", MaxIDLength*8).String())
+}
+
+func TestHashFunction(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	assert.Equal(t, SHA1, node.HashFunction())
+
+	function, err := ParseHashFunction("sha2-256")
+	assert.NoError(t, err)
+	node.SetHashFunction(function)
+	assert.Equal(t, SHA256, node.HashFunction())
+	assert.Equal(t, "sha2-256", node.HashFunction().String())
+
+	_, err = ParseHashFunction("md5")
+	assert.EqualError(t, err, errUnknownFunction)
+}
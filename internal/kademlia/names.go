@@ -0,0 +1,135 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	errBadPublicKey   string = "public key has the wrong length"
+	errBadSignature   string = "record signature is not valid"
+	errSignedVersions string = "signed records must use the version resolution"
+	errUnknownNameKey string = "no private key held for name"
+)
+
+// NameKey returns the key a name published with `publicKey` is stored under
+func NameKey(publicKey ed25519.PublicKey) string {
+	sha1 := sha1.Sum(publicKey)
+	return hex.EncodeToString(sha1[:])
+}
+
+// signedBytes returns the bytes of `record` covered by its signature
+func (record *Record) signedBytes() []byte {
+	return []byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%t",
+		record.Publisher, record.Value, record.Version, record.Timestamp, record.Deleted))
+}
+
+// sign signs `record` with `privateKey`, publishing it under the name key of the key pair
+func (record *Record) sign(privateKey ed25519.PrivateKey) {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	record.PublicKey = publicKey
+	record.Publisher = NameKey(publicKey)
+	record.Signature = ed25519.Sign(privateKey, record.signedBytes())
+}
+
+// validateSignedRecord checks the fields of a record carrying a public key
+func validateSignedRecord(record *Record) error {
+	if len(record.PublicKey) != ed25519.PublicKeySize {
+		return errors.New(errBadPublicKey)
+	}
+
+	if len(record.Signature) != ed25519.SignatureSize {
+		return errors.New(errBadSignature)
+	}
+
+	if record.Resolution != HigherVersionWins {
+		return errors.New(errSignedVersions)
+	}
+	return nil
+}
+
+// verifySignedRecord returns an error if the signed `record` may not be stored
+// under `key`, either because `key` is not the hash of its public key or because
+// the signature does not match
+func verifySignedRecord(key string, record *Record) error {
+	if record.Publisher != key || NameKey(record.PublicKey) != key {
+		return errors.New(errBadRecordKey)
+	}
+
+	if !ed25519.Verify(record.PublicKey, record.signedBytes(), record.Signature) {
+		return errors.New(errBadSignature)
+	}
+	return nil
+}
+
+// NewNameKey generates a key pair to publish a name with. The node keeps the private
+// key in memory. Returns the key the name is stored under.
+func (kademlia *Node) NewNameKey() (string, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	key := NameKey(privateKey.Public().(ed25519.PublicKey))
+
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.nameKeys == nil {
+		kademlia.nameKeys = make(map[string]ed25519.PrivateKey)
+	}
+	kademlia.nameKeys[key] = privateKey
+
+	return key, nil
+}
+
+// PublishName signs `value` with the private key of the name `key` and stores it
+// with the next sequence number on the k closest nodes, under the key in the
+// NameNamespace
+func (kademlia *Node) PublishName(key string, value string) (*Record, error) {
+	kademlia.contentMutex.RLock()
+	privateKey, exists := kademlia.nameKeys[key]
+	kademlia.contentMutex.RUnlock()
+
+	if !exists {
+		return nil, errors.New(errUnknownNameKey)
+	}
+
+	record := Record{
+		Value:      value,
+		Version:    1,
+		Timestamp:  time.Now().UnixNano(),
+		Resolution: HigherVersionWins,
+	}
+	if latest := kademlia.latestRecord(NameNamespace + key); latest != nil {
+		record.Version = latest.Version + 1
+	}
+	record.sign(privateKey)
+
+	err := validateRecord(&record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, kademlia.storeRecord("PublishName", NameNamespace+key, record)
+}
+
+// ResolveName finds the latest value published under the name `key`. The signature
+// is checked again since the record was returned by another node.
+func (kademlia *Node) ResolveName(key string) (*Record, error) {
+	record, err := kademlia.FindRecord(NameNamespace + key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = kademlia.validate(NameNamespace+key, Entry{nil, record})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
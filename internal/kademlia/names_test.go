@@ -0,0 +1,112 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedRecord(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	key := NameKey(publicKey)
+
+	record := Record{Value: "a", Version: 1, Timestamp: 1, Resolution: HigherVersionWins}
+	record.sign(privateKey)
+	assert.Equal(t, key, record.Publisher)
+	assert.NoError(t, validateRecord(&record))
+	assert.NoError(t, checkRecordKey(key, &record))
+
+	// a record may only be stored under the hash of its public key
+	assert.EqualError(t, checkRecordKey(RecordKey(key, ""), &record), errBadRecordKey)
+
+	tampered := record
+	tampered.Value = "b"
+	assert.EqualError(t, checkRecordKey(key, &tampered), errBadSignature)
+
+	tampered = record
+	tampered.Version = 2
+	assert.EqualError(t, checkRecordKey(key, &tampered), errBadSignature)
+
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	tampered = record
+	tampered.PublicKey = otherKey
+	assert.EqualError(t, checkRecordKey(key, &tampered), errBadRecordKey)
+
+	tampered = record
+	tampered.Signature = tampered.Signature[1:]
+	assert.EqualError(t, validateRecord(&tampered), errBadSignature)
+
+	tampered = record
+	tampered.PublicKey = tampered.PublicKey[1:]
+	assert.EqualError(t, validateRecord(&tampered), errBadPublicKey)
+
+	tampered = record
+	tampered.Resolution = LastWriterWins
+	assert.EqualError(t, validateRecord(&tampered), errSignedVersions)
+}
+
+func TestIncomingStoreSignedRecord(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	key := NameKey(publicKey)
+	sender := "1111111100000000000000000000000000000000"
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	record := Record{Value: "a", Version: 2, Timestamp: 1, Resolution: HigherVersionWins}
+	record.sign(privateKey)
+	rpc, _ := NewRPC(Store, sender, sender, Payload{Key: &key, Record: &record})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+
+	// lower sequence numbers are rejected
+	older := Record{Value: "b", Version: 1, Timestamp: 2, Resolution: HigherVersionWins}
+	older.sign(privateKey)
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Record: &older})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errStaleRecord)
+
+	// forged records are rejected
+	forged := record
+	forged.Value = "c"
+	forged.Version = 3
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Record: &forged})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadSignature)
+
+	assert.Equal(t, "a", node.getLocalRecord(key).Value)
+}
+
+func TestPublishName(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+
+	_, err := node.PublishName(me.ID.String(), "a")
+	assert.EqualError(t, err, errUnknownNameKey)
+
+	key, err := node.NewNameKey()
+	assert.NoError(t, err)
+
+	record, err := node.PublishName(key, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), record.Version)
+
+	record, err = node.PublishName(key, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), record.Version)
+
+	resolved, err := node.ResolveName(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", resolved.Value)
+	assert.Equal(t, key, NameKey(resolved.PublicKey))
+
+	// records which are not names do not resolve
+	recordKey, _, _ := node.PutRecord("name", "a", HigherVersionWins)
+	_, err = node.ResolveName(recordKey)
+	assert.Error(t, err)
+}
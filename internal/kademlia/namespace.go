@@ -0,0 +1,327 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// Namespaces of keys. A namespaced key is the namespace followed by a hex encoded
+// hash, e.g. "/content/<sha1 of the data>", and is looked up at the node ID of its hash.
+// Keys without namespace are the plain hashes used by StoreValue and records.
+const (
+	// ContentNamespace holds immutable data stored under its SHA-1 hash
+	ContentNamespace string = "/content/"
+	// PublicKeyNamespace holds hex encoded public keys stored under NameKey(key)
+	PublicKeyNamespace string = "/pk/"
+	// NameNamespace holds the signed records published with PublishName
+	NameNamespace string = "/name/"
+)
+
+const (
+	errBadNamespace     string = "key has no namespace"
+	errUnknownNamespace string = "no validator for the namespace of the key"
+	errBadContentHash   string = "data does not hash to the key"
+	errNotInNamespace   string = "entry does not belong in the namespace of the key"
+)
+
+// Entry is an immutable value or a record stored under a key
+type Entry struct {
+	Value  *string
+	Record *Record
+}
+
+// Validator checks the entries stored in a namespace. `hash` is the key without
+// its namespace.
+type Validator interface {
+	// Validate returns an error if `entry` may not be stored under `hash`. It is
+	// called on every STORE RPC and on every value a lookup retrieves.
+	Validate(hash string, entry Entry) error
+	// Select returns the index of the best of the valid `entries` for `hash`
+	Select(hash string, entries []Entry) int
+}
+
+var defaultValidators = map[string]Validator{
+	"":                 defaultValidator{},
+	ContentNamespace:   contentValidator{},
+	PublicKeyNamespace: publicKeyValidator{},
+	NameNamespace:      nameValidator{},
+}
+
+// ParseKey splits `key` into its namespace and hash. Keys without namespace
+// are returned as they are with an empty namespace.
+func ParseKey(key string) (string, string, error) {
+	if !strings.HasPrefix(key, "/") {
+		return "", key, nil
+	}
+
+	end := strings.Index(key[1:], "/")
+	if end < 0 {
+		return "", "", errors.New(errBadNamespace)
+	}
+
+	namespace, hash := key[:end+2], key[end+2:]
+	_, _, err := ParseHash(hash)
+	if err != nil {
+		return "", "", err
+	}
+	return namespace, hash, nil
+}
+
+// KeyID returns the 160-bit node ID a value stored under `key` is looked up at,
+// which is the digest of its hash mapped into the ID space
+func KeyID(key string) *NodeID {
+	return KeyIDWithWidth(key, IDLength*8)
+}
+
+// KeyIDWithWidth returns the node ID a value stored under `key` is looked up at
+// in a network of IDs `bits` wide
+func KeyIDWithWidth(key string, bits int) *NodeID {
+	_, hash, err := ParseKey(key)
+	if err != nil {
+		hash = key
+	}
+
+	_, digest, err := ParseHash(hash)
+	if err != nil {
+		digest, _ = hex.DecodeString(hash)
+	}
+	return hashID(digest, bits)
+}
+
+// SetValidator makes the node check the keys in `namespace` with `validator`,
+// replacing the default validator of the namespace
+func (kademlia *Node) SetValidator(namespace string, validator Validator) {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.validators == nil {
+		kademlia.validators = make(map[string]Validator)
+	}
+	kademlia.validators[namespace] = validator
+}
+
+// validator returns the validator of `namespace`
+func (kademlia *Node) validator(namespace string) (Validator, error) {
+	kademlia.contentMutex.RLock()
+	validator, exists := kademlia.validators[namespace]
+	kademlia.contentMutex.RUnlock()
+
+	if !exists {
+		validator, exists = defaultValidators[namespace]
+	}
+
+	if !exists {
+		return nil, errors.New(errUnknownNamespace)
+	}
+	return validator, nil
+}
+
+// validate returns an error if `entry` may not be stored under `key`
+func (kademlia *Node) validate(key string, entry Entry) error {
+	namespace, hash, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+
+	validator, err := kademlia.validator(namespace)
+	if err != nil {
+		return err
+	}
+	return validator.Validate(hash, entry)
+}
+
+// selectEntry returns the best of the valid `entries` stored under `key`
+func (kademlia *Node) selectEntry(key string, entries []Entry) Entry {
+	namespace, hash, _ := ParseKey(key)
+
+	validator, err := kademlia.validator(namespace)
+	if err != nil {
+		return entries[0]
+	}
+	return entries[validator.Select(hash, entries)]
+}
+
+// timestamp returns the time the entry was written in nanoseconds
+func (entry *Entry) timestamp() int64 {
+	if entry.Record != nil {
+		return entry.Record.Timestamp
+	}
+	return valueTimestamp(*entry.Value)
+}
+
+// wins returns true if `entry` should replace `other`
+func (entry *Entry) wins(other *Entry) bool {
+	if entry.Record != nil && other.Record != nil {
+		return entry.Record.wins(other.Record)
+	}
+	return entry.timestamp() > other.timestamp()
+}
+
+// equal returns true if `entry` holds the same data or record version as `other`.
+// The timestamps of immutable values are ignored since they change when re-stored.
+func (entry *Entry) equal(other *Entry) bool {
+	if entry.Record != nil || other.Record != nil {
+		return entry.Record != nil && other.Record != nil &&
+			entry.Record.Publisher == other.Record.Publisher &&
+			entry.Record.Version == other.Record.Version &&
+			entry.Record.Value == other.Record.Value &&
+			entry.Record.Deleted == other.Record.Deleted
+	}
+	return entryData(*entry.Value) == entryData(*other.Value)
+}
+
+// selectLatest returns the index of the entry which wins over all others
+func selectLatest(entries []Entry) int {
+	best := 0
+	for i := range entries {
+		if entries[i].wins(&entries[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// entryData returns the data of an immutable "timestamp:data" value
+func entryData(value string) string {
+	parts := strings.SplitN(value, ":", 2)
+	return parts[len(parts)-1]
+}
+
+// defaultValidator accepts any value under keys without namespace. Records
+// must belong under their key.
+type defaultValidator struct{}
+
+func (defaultValidator) Validate(hash string, entry Entry) error {
+	if entry.Record != nil {
+		return checkRecordKey(hash, entry.Record)
+	}
+	return nil
+}
+
+func (defaultValidator) Select(hash string, entries []Entry) int {
+	return selectLatest(entries)
+}
+
+// verifyContent returns an error unless the data of the immutable `value` hashes to
+// `hash` with the hash function the hash names
+func verifyContent(hash string, value string) error {
+	if !verifyDigest(hash, []byte(entryData(value))) {
+		return errors.New(errBadContentHash)
+	}
+	return nil
+}
+
+// verifyRetrieved returns an error if an `entry` returned or stored by another node
+// is not valid for `key`. Immutable values under keys without namespace are content
+// addressed and must hash to the key.
+func (kademlia *Node) verifyRetrieved(key string, entry Entry) error {
+	err := kademlia.validate(key, entry)
+	if err != nil {
+		return err
+	}
+
+	if namespace, hash, _ := ParseKey(key); namespace == "" && entry.Value != nil {
+		return verifyContent(hash, *entry.Value)
+	}
+	return nil
+}
+
+// contentValidator accepts data hashing to its key and tombstones deleting it
+type contentValidator struct{}
+
+func (contentValidator) Validate(hash string, entry Entry) error {
+	if entry.Record != nil {
+		if entry.Record.deletesValue(hash) {
+			return nil
+		}
+		return errors.New(errNotInNamespace)
+	}
+
+	return verifyContent(hash, *entry.Value)
+}
+
+func (contentValidator) Select(hash string, entries []Entry) int {
+	return selectLatest(entries)
+}
+
+// publicKeyValidator accepts hex encoded public keys stored under their NameKey
+type publicKeyValidator struct{}
+
+func (publicKeyValidator) Validate(hash string, entry Entry) error {
+	if entry.Record != nil {
+		return errors.New(errNotInNamespace)
+	}
+
+	publicKey, err := hex.DecodeString(entryData(*entry.Value))
+	if err != nil {
+		return err
+	}
+
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New(errBadPublicKey)
+	}
+
+	if !strings.EqualFold(NameKey(publicKey), hash) {
+		return errors.New(errBadRecordKey)
+	}
+	return nil
+}
+
+func (publicKeyValidator) Select(hash string, entries []Entry) int {
+	return 0
+}
+
+// nameValidator accepts records signed by the key the name is stored under
+type nameValidator struct{}
+
+func (nameValidator) Validate(hash string, entry Entry) error {
+	if entry.Record == nil || entry.Record.PublicKey == nil {
+		return errors.New(errNotInNamespace)
+	}
+	return verifySignedRecord(hash, entry.Record)
+}
+
+// Select returns the record with the highest sequence number
+func (nameValidator) Select(hash string, entries []Entry) int {
+	return selectLatest(entries)
+}
+
+// replyEntry returns the value or record of a FIND_VALUE reply, if it holds one
+func replyEntry(rpc *RPC, err error) (Entry, bool) {
+	if err != nil || rpc.Payload == nil {
+		return Entry{}, false
+	} else if rpc.Payload.Record != nil {
+		return Entry{nil, rpc.Payload.Record}, true
+	} else if rpc.Payload.Value != nil && *rpc.Payload.Value != "" {
+		return Entry{rpc.Payload.Value, nil}, true
+	}
+	return Entry{}, false
+}
+
+// entryDescription returns a short description of what `entry` holds
+func entryDescription(entry Entry) string {
+	rpc := RPC{Payload: &Payload{Value: entry.Value, Record: entry.Record}}
+	return rpc.describe()
+}
+
+// Put stores the immutable `data` under the namespaced `key` on the k closest
+// nodes. Returns an error if the data is not valid for the namespace of the key
+// or if the write quorum of the node was not met.
+func (kademlia *Node) Put(key string, data string) error {
+	span := kademlia.tracer.Start("Put", tracing.Internal, nil)
+	defer span.End()
+
+	value := "0:" + data
+	err := kademlia.validate(key, Entry{&value, nil})
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	_, err = kademlia.storeData(key, data, kademlia.WriteQuorum(), span)
+	return err
+}
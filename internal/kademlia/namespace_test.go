@@ -0,0 +1,151 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func contentKey(data string) string {
+	sha1 := sha1.Sum([]byte(data))
+	return ContentNamespace + hex.EncodeToString(sha1[:])
+}
+
+func TestParseKey(t *testing.T) {
+	hash := "1111111100000000000000000000000000000001"
+
+	namespace, parsed, err := ParseKey(ContentNamespace + hash)
+	assert.NoError(t, err)
+	assert.Equal(t, ContentNamespace, namespace)
+	assert.Equal(t, hash, parsed)
+
+	namespace, parsed, err = ParseKey(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, "", namespace)
+	assert.Equal(t, hash, parsed)
+
+	_, _, err = ParseKey("/content")
+	assert.EqualError(t, err, errBadNamespace)
+	_, _, err = ParseKey("/content/abcd")
+	assert.Error(t, err)
+
+	assert.Equal(t, NewNodeID(hash), KeyID(NameNamespace+hash))
+}
+
+func TestValidators(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+
+	data := "1600000000:there"
+	key := contentKey("there")
+	assert.NoError(t, node.validate(key, Entry{&data, nil}))
+
+	other := "1600000000:elsewhere"
+	assert.EqualError(t, node.validate(key, Entry{&other, nil}), errBadContentHash)
+	assert.NoError(t, node.validate(key, Entry{nil, &Record{Deleted: true, Resolution: LastWriterWins}}))
+	assert.EqualError(t, node.validate(key, Entry{nil, &Record{Publisher: "abcd"}}), errNotInNamespace)
+
+	// values under keys without namespace are not checked
+	assert.NoError(t, node.validate("1111111100000000000000000000000000000001", Entry{&other, nil}))
+	assert.EqualError(t, node.validate("/unknown/1111111100000000000000000000000000000001", Entry{&data, nil}), errUnknownNamespace)
+
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	encoded := "1600000000:" + hex.EncodeToString(publicKey)
+	assert.NoError(t, node.validate(PublicKeyNamespace+NameKey(publicKey), Entry{&encoded, nil}))
+	assert.EqualError(t, node.validate(PublicKeyNamespace+"1111111100000000000000000000000000000001", Entry{&encoded, nil}), errBadRecordKey)
+
+	record := Record{Value: "a", Version: 1, Resolution: HigherVersionWins}
+	record.sign(privateKey)
+	assert.NoError(t, node.validate(NameNamespace+NameKey(publicKey), Entry{nil, &record}))
+	assert.EqualError(t, node.validate(NameNamespace+NameKey(publicKey), Entry{&data, nil}), errNotInNamespace)
+
+	// validators of a namespace can be replaced
+	node.SetValidator(ContentNamespace, defaultValidator{})
+	assert.NoError(t, node.validate(key, Entry{&other, nil}))
+}
+
+func TestSelectEntry(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+
+	older := "1600000000:there"
+	newer := "1600000001:there"
+	selected := node.selectEntry(contentKey("there"), []Entry{{&older, nil}, {&newer, nil}})
+	assert.Equal(t, &newer, selected.Value)
+
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	first := Record{Value: "a", Version: 2, Timestamp: 1, Resolution: HigherVersionWins}
+	first.sign(privateKey)
+	second := Record{Value: "b", Version: 1, Timestamp: 2, Resolution: HigherVersionWins}
+	second.sign(privateKey)
+
+	selected = node.selectEntry(NameNamespace+first.Publisher, []Entry{{nil, &second}, {nil, &first}})
+	assert.Equal(t, &first, selected.Record)
+}
+
+func TestIncomingStoreNamespaced(t *testing.T) {
+	sender := "1111111100000000000000000000000000000000"
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	key := contentKey("there")
+	value := "1600000000:elsewhere"
+	rpc, _ := NewRPC(Store, sender, sender, Payload{Key: &key, Value: &value})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadContentHash)
+	assert.Nil(t, node.searchLocalStore(key))
+
+	value = "1600000000:there"
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Value: &value})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.NotNil(t, node.searchLocalStore(key))
+
+	// values stored under keys without namespace must hash to the key too
+	plain := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	value = "1600000000:elsewhere"
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &plain, Value: &value})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadContentHash)
+	assert.Nil(t, node.searchLocalStore(plain))
+}
+
+func TestFindValueIgnoresInvalidReplies(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	bad := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080")
+	good := NewContact(NewNodeID("2222222200000000000000000000000000000000"), "10.0.8.3:8080")
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, message.receiver.ID.String(), me.ID.String(), Payload{})
+		if *message.rpc.Type == FindValue && message.receiver.Address == bad.Address {
+			value := "1600000000:elsewhere"
+			reply.Payload.Value = &value
+		} else if *message.rpc.Type == FindValue {
+			value := "1600000000:there"
+			reply.Payload.Value = &value
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	for _, key := range []string{contentKey("there"), "490528f36debf7c15cea5e9a9d1ea024cf6b2921"} {
+		node.RT = NewRoutingTable(me)
+		node.RT.AddContact(bad)
+
+		_, err := node.FindValue(key)
+		assert.Error(t, err)
+
+		// the contact returning data not hashing to the key is penalized
+		assert.False(t, node.RT.Contains(bad))
+		node.RT.AddContact(bad)
+		assert.False(t, node.RT.Contains(bad))
+	}
+
+	node.RT.AddContact(good)
+	found, err := node.FindValue(contentKey("there"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1600000000:there", found)
+}
@@ -1,30 +1,70 @@
 package kademlia
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"crypto/ed25519"
 	"errors"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
 )
 
 const updateTimer = 10
 
+// lookupAlpha the number of contacts queried in each round of a lookup
+const lookupAlpha = 1
+
+// badResponsePenalty how long a contact returning invalid values is kept out of the routing table
+const badResponsePenalty = 10 * time.Minute
+
+// MaxDataSize the largest data StoreValue accepts, leaving room in the
+// stored value for the timestamp prefix
+const MaxDataSize = MaxValueSize - 21
+
+const errValueNotFound string = "no value found"
+
 //Node a struct representing a node in the kademlia network
 type Node struct {
-	RT       *RoutingTable
-	client   Client
-	content  map[string]string
-	deadline int64
+	RT           RoutingTable
+	client       Client
+	content      map[string]string
+	owners       map[string]Contact
+	records      map[string]Record
+	cache        map[string]cacheEntry
+	providers    leases
+	provided     map[string]bool
+	subscribers  leases
+	subscribed   map[string]map[*Subscription]bool
+	watchers     leases
+	watches      map[string]map[*Watch]bool
+	watchedOn    leases
+	nameKeys     map[string]ed25519.PrivateKey
+	validators   map[string]Validator
+	deadline     int64
+	contentMutex sync.RWMutex
+	logger       *logger.Logger
+	tracer       *tracing.Tracer
+	writeQuorum  int
+	hashFunction HashFunction
+	idWidth      int
+	routingTable string
+	started      time.Time
 }
 
 // InitNode initializes the Kademlia Node
 // with a Routing Table and a Network
 func (kademlia *Node) InitNode() {
+	kademlia.InitNodeWithLogger(nil)
+}
+
+// InitNodeWithLogger initializes the Kademlia Node with a Routing Table and a Network.
+// The node and its client log to a child of `log` carrying the ID of the node.
+func (kademlia *Node) InitNodeWithLogger(log *logger.Logger) {
+	kademlia.started = time.Now()
 	client := InitClient()
 	client.Start()
 	kademlia.client = client
@@ -33,19 +73,23 @@ func (kademlia *Node) InitNode() {
 
 	var id *NodeID
 
-	rendezvousID := NewNodeID("00000000000000000000000000000000FFFFFFFF")
+	rendezvousID := NewNodeIDWithWidth("00000000000000000000000000000000FFFFFFFF", kademlia.IDWidth())
 
 	// set a specific ID to the rendezvous node, the node that has the address "10.0.8.3"
 	if ip == "10.0.8.3" {
 		id = rendezvousID
 	} else {
 		// for all nodes that is not the rendezvous node set a random ID
-		id = NewRandomNodeID()
+		id = NewRandomNodeIDWithWidth(kademlia.IDWidth())
 	}
 
 	me := NewContact(id, ip+":8080")
 	me.CalcDistance(me.ID)
-	kademlia.RT = NewRoutingTable(me)
+	kademlia.RT, _ = NewRoutingTableOfKind(kademlia.routingTable, me)
+
+	log = log.WithField(logger.FieldNodeID, id.String())
+	kademlia.logger = log.Component("node")
+	kademlia.client.logger = log.Component("client")
 
 	if ip != "10.0.8.3" {
 		rendezvousNode := NewContact(rendezvousID, "10.0.8.3:8080")
@@ -55,11 +99,11 @@ func (kademlia *Node) InitNode() {
 			_, err := kademlia.client.SendPingMessage(&rendezvousNode, &me)
 
 			if err == nil {
-				log.Info("Rendezvous node is live, joining network")
+				kademlia.logger.Info("Rendezvous node is live, joining network")
 				kademlia.JoinNetwork(rendezvousNode)
 				break
 			} else {
-				log.Warn("Rendezvous node is not live")
+				kademlia.logger.Warn("Rendezvous node is not live")
 			}
 		}
 	}
@@ -69,18 +113,39 @@ func (kademlia *Node) InitNode() {
 	go func() {
 		for {
 			kademlia.updateContent()
+			time.Sleep(updateTimer * time.Second)
+		}
+	}()
+	go func() {
+		for {
+			time.Sleep(providerRepublish)
+			kademlia.republishProviders()
+		}
+	}()
+	go func() {
+		for {
+			time.Sleep(subscriptionRenewal)
+			kademlia.renewSubscriptions()
+		}
+	}()
+	go func() {
+		for {
+			time.Sleep(watchRenewal)
+			kademlia.renewWatches()
 		}
 	}()
 }
 
 func (kademlia *Node) updateContent() {
+	expired := []string{}
+	kademlia.contentMutex.Lock()
 	for key, value := range kademlia.content {
 		timestamp := strings.Split(value, ":")[0]
 
 		n, err := strconv.ParseInt(timestamp, 10, 64)
 
 		if err != nil {
-			log.Warn(err)
+			kademlia.logger.WithField(logger.FieldKey, key).Warn(err)
 		}
 
 		now := time.Now() // current local time
@@ -88,26 +153,79 @@ func (kademlia *Node) updateContent() {
 
 		if ((n + kademlia.deadline) - sec) < 0 {
 			delete(kademlia.content, key) // delete a key-value pair
+			delete(kademlia.owners, key)
+			expirations.Inc()
+			expired = append(expired, key)
 		}
 	}
-	time.Sleep(updateTimer * time.Second)
+
+	for key, record := range kademlia.records {
+		if record.expired(kademlia.deadline, time.Now()) {
+			delete(kademlia.records, key)
+			if _, hasValue := kademlia.content[key]; !hasValue {
+				delete(kademlia.owners, key)
+			}
+			expirations.Inc()
+			expired = append(expired, key)
+		}
+	}
+
+	kademlia.expireCache(time.Now())
+	kademlia.providers.expire(time.Now())
+	kademlia.subscribers.expire(time.Now())
+	kademlia.watchers.expire(time.Now())
+	kademlia.watchedOn.expire(time.Now())
+	kademlia.contentMutex.Unlock()
+
+	for _, key := range expired {
+		kademlia.notifyWatchers(key, EventExpired, "")
+	}
 }
 
 //NodeLookup - finds the k closests nodes to a target ID in the kademlia network
 func (kademlia *Node) NodeLookup(targetID *NodeID) []Contact {
-	alpha := 1
+	span := kademlia.tracer.Start("NodeLookup", tracing.Internal, nil)
+	defer span.End()
+
+	return kademlia.nodeLookup(targetID, span, nil)
+}
+
+// NodeLookupWithReport does a NodeLookup and returns a report of every contact queried
+func (kademlia *Node) NodeLookupWithReport(targetID *NodeID) ([]Contact, *LookupReport) {
+	span := kademlia.tracer.Start("NodeLookup", tracing.Internal, nil)
+	defer span.End()
+
+	report := newLookupReport(targetID)
+	return kademlia.nodeLookup(targetID, span, report), report
+}
+
+// nodeLookup does a NodeLookup sending its RPCs as children of `span` and
+// recording them in `report` if it is not nil
+func (kademlia *Node) nodeLookup(targetID *NodeID, span *tracing.Span, report *LookupReport) []Contact {
+	span.SetAttribute(attrTarget, targetID.String())
+	client := kademlia.client.withSpan(span)
+
+	alpha := lookupAlpha
 	shortList := ContactCandidates{kademlia.RT.FindClosestContacts(targetID, alpha)}
 
 	// set a temporary value to currentClosest that is the furthest away a node can be
-	currentClosest := NewContact(NewNodeID("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"), "")
-	currentClosest.distance = NewNodeID("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF")
+	currentClosest := NewContact(maxNodeID(targetID.Len()), "")
+	currentClosest.distance = maxNodeID(targetID.Len())
 
 	// a list of nodes to know which nodes has been probed already
 	probedNodes := ContactCandidates{}
 
+	hops := 0
+	defer func() {
+		lookupHops.Observe(float64(hops), "node")
+		span.SetAttribute(attrHops, strconv.Itoa(hops))
+	}()
+
 	for {
 		updateClosest := false
 		numProbed := 0
+		report.nextRound()
+		hops++
 
 		for i := 0; i < shortList.Len() && numProbed < alpha; i++ {
 
@@ -115,205 +233,443 @@ func (kademlia *Node) NodeLookup(targetID *NodeID) []Contact {
 				continue
 
 			} else {
-				rpc, err := kademlia.client.SendFindContactMessage(&shortList.contacts[i], &kademlia.RT.me, targetID)
+				start := time.Now()
+				rpc, err := client.SendFindContactMessage(&shortList.contacts[i], kademlia.RT.GetMe(), targetID)
+				report.add(shortList.contacts[i], targetID, time.Since(start), rpc, err)
 
 				// if a node responds with an error remove that node
 				// from the shortlist and from the bucket
 				if err != nil {
-					log.Warn(err)
-					kademlia.RT.RemoveContact(shortList.contacts[i])
+					kademlia.logger.WithField(logger.FieldPeerID, shortList.contacts[i].ID.String()).Warn(err)
+					kademlia.removeUnresponsive(shortList.contacts[i], err)
 					shortList.contacts = append(shortList.contacts[:i], shortList.contacts[i+1:]...)
+					i--
 					continue
 
 				} else {
 					kademlia.updateShortlist(
 						targetID,
-						shortList, probedNodes,
+						&shortList, &probedNodes,
 						rpc,
-						i, numProbed,
-						currentClosest,
-						updateClosest)
+						i, &numProbed,
+						&currentClosest,
+						&updateClosest)
 
 				}
 			}
 		}
 		if !updateClosest || probedNodes.Len() >= BucketSize {
+			report.terminate(termination(shortList, probedNodes))
 			break
 
 		}
 	}
+
+	span.SetAttribute(attrContacts, strconv.Itoa(len(shortList.contacts)))
 	return shortList.contacts
 }
 
-//FindValue - finds a value stored in the kademlia network
+//FindValue - finds a value stored in the kademlia network. Returns the value of
+// the Record if a mutable record is stored under `hash`.
 func (kademlia *Node) FindValue(hash string) (string, error) {
-	if content, ok := kademlia.content[hash]; ok {
-		return content, nil
+	value, record, err := kademlia.findValue(hash, 1, nil)
+	return recordValue(value, record, err)
+}
+
+// FindValueWithReport does a FindValue and returns a report of every contact queried
+func (kademlia *Node) FindValueWithReport(hash string) (string, *LookupReport, error) {
+	return kademlia.FindValueQuorum(hash, 1)
+}
+
+// FindValueQuorum does a FindValue which continues until `quorum` replicas, the
+// local store included, returned a value for `hash`. The best value is selected by
+// the validator of the namespace of the key. The report tells how many replicas
+// answered and whether they disagreed. If fewer than `quorum` replicas answered
+// before the lookup terminated the best of their values is returned.
+func (kademlia *Node) FindValueQuorum(hash string, quorum int) (string, *LookupReport, error) {
+	report := newLookupReport(kademlia.keyID(hash))
+	value, record, err := kademlia.findValue(hash, quorum, report)
+	value, err = recordValue(value, record, err)
+	return value, report, err
+}
+
+// recordValue returns the value of `record` if it is not nil, or an error if it is a tombstone
+func recordValue(value string, record *Record, err error) (string, error) {
+	if err != nil || record == nil {
+		return value, err
+	} else if record.Deleted {
+		return "", errors.New(errDeletedValue)
+	}
+	return record.Value, nil
+}
+
+// findValue does a FindValue reading `quorum` replicas and recording every RPC in
+// `report` if it is not nil. Returns the Record if one is stored under `hash`,
+// tombstones included.
+func (kademlia *Node) findValue(hash string, quorum int, report *LookupReport) (string, *Record, error) {
+	hash = normalizeKey(hash)
+
+	span := kademlia.tracer.Start("FindValue", tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, hash)
+
+	if record := kademlia.getLocalRecord(hash); record != nil && quorum <= 1 {
+		span.SetAttribute(attrResult, "local")
+		report.terminate(TerminationLocal)
+		return "", record, nil
+
+	} else if content := kademlia.searchLocalStore(hash); content != nil && quorum <= 1 {
+		span.SetAttribute(attrResult, "local")
+		report.terminate(TerminationLocal)
+		return *content, nil, nil
+
+	} else if cached := kademlia.searchCache(hash); cached != nil && quorum <= 1 {
+		span.SetAttribute(attrResult, "cache")
+		report.terminate(TerminationLocal)
+		return *cached, nil, nil
 
 	} else {
-		alpha := 1
-		shortList := ContactCandidates{kademlia.RT.FindClosestContacts(NewNodeID(hash), alpha)}
+		client := kademlia.client.withSpan(span)
+		alpha := lookupAlpha
+		if quorum > alpha {
+			alpha = quorum
+		}
+		targetID := kademlia.keyID(hash)
+		entries := kademlia.localEntries(hash)
+		path := &lookupPath{target: targetID}
+		shortList := ContactCandidates{kademlia.RT.FindClosestContacts(targetID, alpha)}
 
 		// set a temporary value to currentClosest that is the furthest away a node can be
-		currentClosest := NewContact(NewNodeID("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"), "")
-		currentClosest.distance = NewNodeID("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF")
+		currentClosest := NewContact(maxNodeID(targetID.Len()), "")
+		currentClosest.distance = maxNodeID(targetID.Len())
 
 		// a list of nodes to know which nodes has been probed already
 		probedNodes := ContactCandidates{}
 
+		hops := 0
+		defer func() {
+			lookupHops.Observe(float64(hops), "value")
+			span.SetAttribute(attrHops, strconv.Itoa(hops))
+		}()
+
 		for {
 			updateClosest := false
 			numProbed := 0
+			report.nextRound()
+			hops++
 
 			for i := 0; i < shortList.Len() && numProbed < alpha; i++ {
 
 				if probedNodes.Contains(shortList.contacts[i]) {
 					continue
 				} else {
-					rpc, err := kademlia.client.SendFindDataMessage(&shortList.contacts[i], &kademlia.RT.me, hash)
-
-					if rpc.Payload.Value != nil && *rpc.Payload.Value != "" {
-
-						// update timestamp and re-store the value
-						value := strings.Split(*rpc.Payload.Value, ":")[1]
-						kademlia.StoreValue(value)
-
-						return *rpc.Payload.Value, nil
+					start := time.Now()
+					rpc, err := client.SendFindDataMessage(&shortList.contacts[i], kademlia.RT.GetMe(), hash)
+					report.add(shortList.contacts[i], targetID, time.Since(start), rpc, err)
+
+					if entry, found := replyEntry(rpc, err); found {
+						// replies which are not valid for the key are ignored and
+						// the contact is penalized, the lookup continues with other contacts
+						err = kademlia.verifyRetrieved(hash, entry)
+						if err != nil {
+							kademlia.logger.WithFields(logger.Fields{
+								logger.FieldPeerID: shortList.contacts[i].ID.String(),
+								logger.FieldKey:    hash,
+							}).Warn(err)
+							badResponses.Inc()
+							kademlia.RT.Penalize(shortList.contacts[i], badResponsePenalty)
+						} else {
+							entries = append(entries, entry)
+							path.hit(shortList.contacts[i])
+						}
+						probedNodes.Append([]Contact{shortList.contacts[i]})
+						numProbed++
+						continue
 					}
 
 					// if a node responds with an error remove that node
 					// from the shortlist and from the bucket
 					if err != nil {
-						log.Warn(err)
-						kademlia.RT.RemoveContact(shortList.contacts[i])
+						kademlia.logger.WithFields(logger.Fields{
+							logger.FieldPeerID: shortList.contacts[i].ID.String(),
+							logger.FieldKey:    hash,
+						}).Warn(err)
+						kademlia.removeUnresponsive(shortList.contacts[i], err)
 						shortList.contacts = append(shortList.contacts[:i], shortList.contacts[i+1:]...)
+						i--
 						continue
 
 					} else {
+						path.miss(shortList.contacts[i])
 						kademlia.updateShortlist(
-							NewNodeID(hash),
-							shortList, probedNodes,
+							targetID,
+							&shortList, &probedNodes,
 							rpc,
-							i, numProbed,
-							currentClosest,
-							updateClosest)
+							i, &numProbed,
+							&currentClosest,
+							&updateClosest)
 
 					}
 				}
 			}
+			if len(entries) > 0 && len(entries) >= quorum {
+				report.terminate(TerminationValue)
+				return kademlia.selectReplica(hash, entries, path, span, report)
+			}
+
 			if !updateClosest || probedNodes.Len() >= BucketSize {
+				report.terminate(termination(shortList, probedNodes))
+				if len(entries) > 0 {
+					return kademlia.selectReplica(hash, entries, path, span, report)
+				}
 				break
 
 			}
 		}
-		return "", errors.New("no value found")
+
+		err := errors.New(errValueNotFound)
+		span.SetError(err)
+		if span != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldKey:     hash,
+				logger.FieldTraceID: span.TraceID(),
+			}).Info(err)
+		}
+		return "", nil, err
 	}
 }
 
+// localEntries returns the record or value stored locally under `hash`, if any
+func (kademlia *Node) localEntries(hash string) []Entry {
+	if record := kademlia.getLocalRecord(hash); record != nil {
+		return []Entry{{nil, record}}
+	} else if content := kademlia.searchLocalStore(hash); content != nil {
+		return []Entry{{content, nil}}
+	}
+	return []Entry{}
+}
+
+// selectReplica returns the best of the `entries` found for `hash`, recording in
+// `report` whether the replicas disagreed. A value is cached at the closest node
+// on `path` which did not return it.
+func (kademlia *Node) selectReplica(hash string, entries []Entry, path *lookupPath, span *tracing.Span, report *LookupReport) (string, *Record, error) {
+	entry := kademlia.selectEntry(hash, entries)
+
+	disagreement := false
+	for i := range entries {
+		if !entries[i].equal(&entry) {
+			disagreement = true
+		}
+	}
+	report.compare(len(entries), disagreement)
+
+	if disagreement {
+		readDisagreements.Inc()
+		kademlia.logger.WithFields(logger.Fields{
+			logger.FieldKey:     hash,
+			logger.FieldTraceID: span.TraceID(),
+		}).Warn("replicas returned different values")
+	}
+
+	span.SetAttribute(attrResult, entryDescription(entry))
+	if entry.Record != nil {
+		return "", entry.Record, nil
+	}
+
+	kademlia.cacheValue(hash, *entry.Value, path, span)
+	return *entry.Value, nil, nil
+}
+
+// termination returns why a lookup that did not find a value stopped
+func termination(shortList, probedNodes ContactCandidates) string {
+	if probedNodes.Len() >= BucketSize {
+		return TerminationKQueried
+	} else if shortList.Len() == 0 {
+		return TerminationExhausted
+	}
+	return TerminationNoCloser
+}
+
+// updateShortlist marks the i:th contact of `shortList` as probed and adds the
+// contacts it replied with to the shortlist, recording in `updateClosest` whether
+// they include one closer than `currentClosest`
 func (kademlia *Node) updateShortlist(
 	targetID *NodeID,
-	shortList, probedNodes ContactCandidates,
+	shortList, probedNodes *ContactCandidates,
 	rpc *RPC,
-	i, numProbed int,
-	currentClosest Contact,
-	updateClosest bool) {
+	i int, numProbed *int,
+	currentClosest *Contact,
+	updateClosest *bool) {
 
 	probedNodes.Append([]Contact{shortList.contacts[i]})
 
-	bucket := kademlia.RT.buckets[kademlia.RT.getBucketIndex(shortList.contacts[i].ID)]
-
 	// if there is space in the bucket add the node
-	kademlia.updateBucket(*bucket, shortList.contacts[i])
+	kademlia.updateBucket(shortList.contacts[i])
 
 	// append contacts to shortlist if err is none
-	for i := 0; i < len(rpc.Payload.Contacts); i++ {
-		rpc.Payload.Contacts[i].CalcDistance(targetID)
+	if rpc.Payload != nil {
+		for i := 0; i < len(rpc.Payload.Contacts); i++ {
+			rpc.Payload.Contacts[i].CalcDistance(targetID)
+		}
 	}
 
 	kademlia.appendUniqueContacts(rpc, shortList, currentClosest, updateClosest)
 
-	numProbed++
+	*numProbed++
 }
 
 // if the closest node in the payload is less than the currentClosest
-// update the shortlist and the currentClosest node
+// update the shortlist and the currentClosest node. The node itself is
+// never added to the shortlist.
 func (kademlia *Node) appendUniqueContacts(rpc *RPC,
-	shortList ContactCandidates,
-	currentClosest Contact,
-	updateClosest bool) {
+	shortList *ContactCandidates,
+	currentClosest *Contact,
+	updateClosest *bool) {
 
-	if rpc.Payload.Contacts[0].Less(&currentClosest) {
-		currentClosest = rpc.Payload.Contacts[0]
-		shortList.AppendUnique(rpc.Payload.Contacts)
+	if rpc.Payload == nil {
+		return
+	}
+
+	contacts := []Contact{}
+	for _, contact := range rpc.Payload.Contacts {
+		if !contact.ID.Equals(kademlia.RT.GetMeID()) {
+			contacts = append(contacts, contact)
+		}
+	}
+	if len(contacts) == 0 {
+		return
+	}
+
+	closest := contacts[0]
+	for _, contact := range contacts[1:] {
+		if contact.Less(&closest) {
+			closest = contact
+		}
+	}
+
+	if closest.Less(currentClosest) {
+		*currentClosest = closest
+		shortList.AppendUnique(contacts)
 		shortList.Sort()
 		if shortList.Len() >= BucketSize {
 			shortList.contacts = shortList.contacts[:BucketSize]
 		}
 
-		updateClosest = true
+		*updateClosest = true
 	}
 }
 
 // StoreValue takes some data, hashes it with SHA1 and finds the k closest
-// nodes to that hash, then sends a store RPC to those k nodes
-func (kademlia *Node) StoreValue(data string) string {
-	sha1 := sha1.Sum([]byte(data))
-	key := hex.EncodeToString(sha1[:])
+// nodes to that hash, then sends a store RPC to those k nodes. Returns an error
+// if the data is larger than MaxDataSize or if fewer nodes than the write quorum
+// of the node acknowledged the value.
+func (kademlia *Node) StoreValue(data string) (*StoreResult, error) {
+	return kademlia.StoreValueWithQuorum(data, kademlia.WriteQuorum())
+}
 
-	// find the K closest nodes to the hashed value in the whole Kademlia network
-	targetID := NewNodeID(key)
-	nodes := kademlia.NodeLookup(targetID)
+// StoreValueWithQuorum does a StoreValue which fails unless `quorum` nodes
+// acknowledged the value
+func (kademlia *Node) StoreValueWithQuorum(data string, quorum int) (*StoreResult, error) {
+	span := kademlia.tracer.Start("StoreValue", tracing.Internal, nil)
+	defer span.End()
+
+	return kademlia.storeValue(data, quorum, span)
+}
+
+// storeValue does a StoreValue sending its RPCs as children of `span`
+func (kademlia *Node) storeValue(data string, quorum int, span *tracing.Span) (*StoreResult, error) {
+	if len(data) > MaxDataSize {
+		err := errors.New(errValueTooLarge)
+		span.SetError(err)
+		return nil, err
+	}
+
+	key := HashKey(kademlia.HashFunction(), []byte(data))
 
-	now := time.Now() // current local time
-	sec := now.Unix() // number of seconds since January 1, 1970 UTC
+	return kademlia.storeData(key, data, quorum, span)
+}
+
+// storeData stores `data` under `key` on the k closest nodes to the key. Returns
+// an error if fewer than `quorum` nodes acknowledged the data.
+func (kademlia *Node) storeData(key string, data string, quorum int, span *tracing.Span) (*StoreResult, error) {
+	span.SetAttribute(attrKey, key)
+
+	// find the K closest nodes to the hashed value in the whole Kademlia network
+	targetID := kademlia.keyID(key)
+	lookupSpan := span.Start("NodeLookup", tracing.Internal)
+	nodes := kademlia.nodeLookup(targetID, lookupSpan, nil)
+	lookupSpan.End()
 
 	// Store value in the map of the current node
-	data_package := strconv.FormatInt(sec, 10) + ":" + data
+	data_package := timestampValue(data)
+
+	result := newStoreResult(key, quorum)
 
 	// for each of the closest nodes send a store RPC
+	client := kademlia.client.withSpan(span)
 	for _, node := range nodes {
-		_, err := kademlia.client.SendStoreMessage(&node, &kademlia.RT.me, key, data_package)
+		_, err := client.SendStoreMessage(&node, kademlia.RT.GetMe(), key, data_package)
+		result.add(node, err)
 
 		if err != nil {
-			log.Warn(err)
-			kademlia.RT.RemoveContact(node)
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeUnresponsive(node, err)
 		} else {
-			bucket := kademlia.RT.buckets[kademlia.RT.getBucketIndex(node.ID)]
-
-			kademlia.updateBucket(*bucket, node)
+			kademlia.updateBucket(node)
 		}
 	}
 
-	return key
+	err := result.check()
+	span.SetError(err)
+	return result, err
+}
+
+// timestampValue returns `data` prefixed with the current time in seconds, as
+// immutable values are stored
+func timestampValue(data string) string {
+	return strconv.FormatInt(time.Now().Unix(), 10) + ":" + data
 }
 
 // Ping sends a ping message to a target node
 // if the node responds move it to the end of the bucket it exists in
 // if the node does not respond remove it from the bucket
 func (kademlia *Node) Ping(target *Contact) {
-	rpc, err := kademlia.client.SendPingMessage(target, &kademlia.RT.me)
+	rpc, err := kademlia.client.SendPingMessage(target, kademlia.RT.GetMe())
 
 	if err != nil {
-		log.Warn(err)
-		kademlia.RT.RemoveContact(*target)
+		kademlia.logger.WithField(logger.FieldPeerID, target.ID.String()).Warn(err)
+		kademlia.removeUnresponsive(*target, err)
 	} else if *rpc.Type == "OK" {
 		kademlia.RT.AddContact(*target)
 	}
 }
 
+// removeUnresponsive removes the contact from the routing table if it failed
+// to respond. A contact replying with an *RPCError is alive and is kept.
+func (kademlia *Node) removeUnresponsive(contact Contact, err error) {
+	var rpcError *RPCError
+	if !errors.As(err, &rpcError) {
+		kademlia.RT.RemoveContact(contact)
+	}
+}
+
 // updateBucket checks if a contact should be added to a bucket if it does not exist,
 // removes a stale first node in the bucket and replace it with the new node
 // or a active old node from the front to the back
-func (kademlia *Node) updateBucket(bucket bucket, contact Contact) {
+func (kademlia *Node) updateBucket(contact Contact) {
 	// if there is space in the bucket add the node
-	if bucket.Len() < BucketSize || bucket.Contains(contact) {
+	candidate := kademlia.RT.evictionCandidate(contact)
+	if candidate == nil {
 		kademlia.RT.AddContact(contact)
 	} else {
 		// if there is no space in the bucket ping the least recently seen node
-		kademlia.Ping(bucket.GetFirst())
+		kademlia.Ping(candidate)
 
 		// if there now is space in the bucket add the node
-		if bucket.Len() < BucketSize {
+		if kademlia.RT.evictionCandidate(contact) == nil {
 			kademlia.RT.AddContact(contact)
 		}
 	}
@@ -322,6 +678,9 @@ func (kademlia *Node) updateBucket(bucket bucket, contact Contact) {
 // searchLocalStore looks for a value in the node's store. Returns the value
 // if found else nil.
 func (kademlia *Node) searchLocalStore(key string) *string {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
 	value, exists := kademlia.content[key]
 	if !exists {
 		return nil
@@ -330,32 +689,34 @@ func (kademlia *Node) searchLocalStore(key string) *string {
 }
 
 // generate a random ID that is inside a given bucket
-func generateRefreshNodeValue(bucketIndex int, seed int64) *NodeID {
-	bytePos := 19 - (bucketIndex / 8) // position of the highest byte of the ID
+func generateRefreshNodeValue(bucketIndex int, seed int64, length int) *NodeID {
+	bytePos := length - 1 - (bucketIndex / 8) // position of the highest byte of the ID
 	offset := bucketIndex % 8
 
-	nodeValue := NewNodeID("0000000000000000000000000000000000000000")
+	nodeValue := NodeID{length: uint8(length)}
 
 	t := 0
 	t = 1 << offset
 
-	nodeValue[bytePos] = byte(t)
+	nodeValue.bytes[bytePos] = byte(t)
 	rand.Seed(int64(seed))
 
 	// generate a random byte for each byte position from the end of the string to the bytePos
-	for i := 19; i > bytePos; i-- {
+	for i := length - 1; i > bytePos; i-- {
 		scew := uint8(rand.Intn(bucketIndex))
-		nodeValue[i] ^= byte(scew)
+		nodeValue.bytes[i] ^= byte(scew)
 	}
 
-	return nodeValue
+	return &nodeValue
 }
 
+// refreshNodes looks up a random ID in the range of each bucket of the routing
+// table, one bucket for every bit of the IDs
 func (kademlia *Node) refreshNodes() {
-	for i := 1; i > 159; i++ {
-		nodeID := generateRefreshNodeValue(i, time.Now().UTC().UnixNano())
-		contact := NewContact(nodeID, "")
-		kademlia.NodeLookup(contact.ID)
+	me := kademlia.RT.GetMeID()
+	for i := 0; i < kademlia.IDWidth(); i++ {
+		distance := generateRefreshNodeValue(i, time.Now().UTC().UnixNano(), me.Len())
+		kademlia.NodeLookup(me.CalcDistance(distance))
 	}
 }
 
@@ -370,5 +731,8 @@ func (kademlia *Node) JoinNetwork(target Contact) {
 }
 
 func (kademlia *Node) insertLocalStore(key string, value string) {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
 	kademlia.content[key] = value
 }
@@ -9,7 +9,7 @@ import (
 )
 
 func TestSearchLocalStore(t *testing.T) {
-	node := Node{nil, Client{}, make(map[string]string), 10}
+	node := Node{content: make(map[string]string), deadline: 10}
 	node.insertLocalStore("hello", "there")
 
 	val1 := node.searchLocalStore("hello")
@@ -21,7 +21,7 @@ func TestSearchLocalStore(t *testing.T) {
 }
 
 func TestUpdateContent(t *testing.T) {
-	node := Node{nil, Client{}, make(map[string]string), 0}
+	node := Node{content: make(map[string]string), deadline: 0}
 
 	now := time.Now() // current local time
 	sec := now.Unix() // number of seconds since January 1, 1970 UTC
@@ -37,9 +37,34 @@ func TestUpdateContent(t *testing.T) {
 }
 
 func TestGenerateRefreshNodeValue(t *testing.T) {
-	assert.Equal(t, "0000000000000000000000000000000000000002", generateRefreshNodeValue(1, 1).String())
-	assert.Equal(t, "0000000000000000000000000000000000000004", generateRefreshNodeValue(2, 1).String())
-	assert.Equal(t, "0000000000000000000000000000010113070701", generateRefreshNodeValue(40, 1).String())
-	assert.Equal(t, "00000000000000100b5e0038281912513b2f5751", generateRefreshNodeValue(100, 1).String())
-	assert.Equal(t, "802935036b019b8104836f4026824e22449e125f", generateRefreshNodeValue(159, 1).String())
+	assert.Equal(t, "0000000000000000000000000000000000000002", generateRefreshNodeValue(1, 1, IDLength).String())
+	assert.Equal(t, "0000000000000000000000000000000000000004", generateRefreshNodeValue(2, 1, IDLength).String())
+	assert.Equal(t, "0000000000000000000000000000010113070701", generateRefreshNodeValue(40, 1, IDLength).String())
+	assert.Equal(t, "00000000000000100b5e0038281912513b2f5751", generateRefreshNodeValue(100, 1, IDLength).String())
+	assert.Equal(t, "802935036b019b8104836f4026824e22449e125f", generateRefreshNodeValue(159, 1, IDLength).String())
+}
+
+func TestRefreshNodes(t *testing.T) {
+	me := NewContact(NewNodeIDWithWidth("0000ffff", 32), "10.0.8.1:8080")
+	peer := NewContact(NewNodeIDWithWidth("11110000", 32), "10.0.8.2:8080")
+	targets := make(chan string, 64)
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		targets <- *message.rpc.TargetID
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{Contacts: []Contact{}})
+		return Message{message.receiver, *reply, nil}
+	})
+
+	node.refreshNodes()
+	close(targets)
+
+	// one lookup for every bucket of the 32 bit wide routing table
+	buckets := map[int]bool{}
+	for target := range targets {
+		buckets[NewNodeIDWithWidth(target, 32).CalcDistance(me.ID).leadingZeros()] = true
+	}
+	assert.Equal(t, 32, len(buckets))
 }
@@ -2,44 +2,160 @@ package kademlia
 
 import (
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"math/rand"
 	"time"
 )
 
-// IDLength the static number of bytes in a NodeID
+// IDLength the number of bytes in a default 160-bit NodeID
 const IDLength = 20
 
-// NodeID type definition of a NodeID
-type NodeID [IDLength]byte
+// MaxIDLength the number of bytes in the widest, 256-bit, NodeID
+const MaxIDLength = 32
 
-// NewNodeID returns a new instance of a NodeID based on the string input
+// EnvIDWidth is the environment variable setting the number of bits in the
+// IDs of the network, either 160 or 256
+const EnvIDWidth string = "KADEMLIA_ID_WIDTH"
+
+const (
+	errBadIDLength string = "NodeID has the wrong length"
+	errBadIDWidth  string = "NodeID width must be 160 or 256 bits"
+)
+
+// NodeID type definition of a NodeID. IDs are `length` bytes wide and every
+// ID of a network has the same width.
+type NodeID struct {
+	bytes  [MaxIDLength]byte
+	length uint8
+}
+
+// NewNodeID returns a new instance of a NodeID based on the string input.
+// Bytes that could not be decoded are left as zero, use ParseNodeID
+// for input that has not been validated. The ID is 256 bits wide if `data`
+// is longer than a 160-bit ID.
 func NewNodeID(data string) *NodeID {
 	decoded, _ := hex.DecodeString(data)
 
-	newNodeID := NodeID{}
-	for i := 0; i < IDLength; i++ {
-		newNodeID[i] = decoded[i]
+	length := IDLength
+	if len(decoded) > IDLength {
+		length = MaxIDLength
 	}
+	return newNodeIDFromBytes(decoded, length)
+}
+
+// NewNodeIDWithWidth returns a new instance of a NodeID `bits` wide based on the
+// string input, truncating or zero padding it
+func NewNodeIDWithWidth(data string, bits int) *NodeID {
+	decoded, _ := hex.DecodeString(data)
+	return newNodeIDFromBytes(decoded, bits/8)
+}
+
+// newNodeIDFromBytes returns a NodeID of `length` bytes starting with `data`,
+// truncating or zero padding it
+func newNodeIDFromBytes(data []byte, length int) *NodeID {
+	newNodeID := NodeID{length: uint8(length)}
+	copy(newNodeID.bytes[:length], data)
 
 	return &newNodeID
 }
 
-// NewRandomNodeID returns a new instance of a random NodeID,
+// ParseNodeID returns a new instance of a NodeID based on the string input.
+// Returns an error if `data` is not exactly IDLength or MaxIDLength hex encoded bytes.
+func ParseNodeID(data string) (*NodeID, error) {
+	decoded, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decoded) != IDLength && len(decoded) != MaxIDLength {
+		return nil, errors.New(errBadIDLength)
+	}
+
+	return newNodeIDFromBytes(decoded, len(decoded)), nil
+}
+
+// ValidateIDWidth returns an error unless IDs can be `bits` wide
+func ValidateIDWidth(bits int) error {
+	if bits != IDLength*8 && bits != MaxIDLength*8 {
+		return errors.New(errBadIDWidth)
+	}
+	return nil
+}
+
+// NewRandomNodeID returns a new instance of a random 160-bit NodeID,
 // change this to a better version if you like
 func NewRandomNodeID() *NodeID {
+	return NewRandomNodeIDWithWidth(IDLength * 8)
+}
+
+// NewRandomNodeIDWithWidth returns a new instance of a random NodeID `bits` wide
+func NewRandomNodeIDWithWidth(bits int) *NodeID {
 	rand.Seed(time.Now().UTC().UnixNano())
-	newNodeID := NodeID{}
-	for i := 0; i < IDLength; i++ {
-		newNodeID[i] = uint8(rand.Intn(256))
+	newNodeID := NodeID{length: uint8(bits / 8)}
+	for i := 0; i < newNodeID.Len(); i++ {
+		newNodeID.bytes[i] = uint8(rand.Intn(256))
 	}
 	return &newNodeID
 }
 
+// maxNodeID returns the NodeID of `length` bytes with every bit set, which is
+// the furthest away an ID of that width can be
+func maxNodeID(length int) *NodeID {
+	newNodeID := NodeID{length: uint8(length)}
+	for i := 0; i < length; i++ {
+		newNodeID.bytes[i] = 0xFF
+	}
+	return &newNodeID
+}
+
+// Len returns the number of bytes in the NodeID
+func (nodeID NodeID) Len() int {
+	return int(nodeID.length)
+}
+
+// Bits returns the number of bits in the NodeID
+func (nodeID NodeID) Bits() int {
+	return nodeID.Len() * 8
+}
+
+// Bytes returns the bytes of the NodeID
+func (nodeID *NodeID) Bytes() []byte {
+	return nodeID.bytes[:nodeID.Len()]
+}
+
+// leadingZeros returns the number of leading zero bits in the NodeID
+func (nodeID NodeID) leadingZeros() int {
+	for i := 0; i < nodeID.Len(); i++ {
+		for j := 0; j < 8; j++ {
+			if (nodeID.bytes[i]>>uint8(7-j))&0x1 != 0 {
+				return i*8 + j
+			}
+		}
+	}
+	return nodeID.Bits()
+}
+
+// bit returns bit `i` of the NodeID, counting from the most significant bit
+func (nodeID NodeID) bit(i int) int {
+	return int(nodeID.bytes[i/8]>>uint8(7-i%8)) & 0x1
+}
+
+// setBit sets bit `i` of the NodeID to `value`
+func (nodeID *NodeID) setBit(i int, value int) {
+	mask := byte(0x80) >> uint8(i%8)
+	if value == 0 {
+		nodeID.bytes[i/8] &^= mask
+	} else {
+		nodeID.bytes[i/8] |= mask
+	}
+}
+
 // Less returns true if NodeID < otherNodeID (bitwise)
 func (nodeID NodeID) Less(otherNodeID *NodeID) bool {
-	for i := 0; i < IDLength; i++ {
-		if nodeID[i] != otherNodeID[i] {
-			return nodeID[i] < otherNodeID[i]
+	for i := 0; i < nodeID.Len(); i++ {
+		if nodeID.bytes[i] != otherNodeID.bytes[i] {
+			return nodeID.bytes[i] < otherNodeID.bytes[i]
 		}
 	}
 	return false
@@ -47,25 +163,75 @@ func (nodeID NodeID) Less(otherNodeID *NodeID) bool {
 
 // Equals returns true if NodeID == otherNodeID (bitwise)
 func (nodeID NodeID) Equals(otherNodeID *NodeID) bool {
-	for i := 0; i < IDLength; i++ {
-		if nodeID[i] != otherNodeID[i] {
-			return false
-		}
-	}
-	return true
+	return nodeID == *otherNodeID
 }
 
 // CalcDistance returns a new instance of a NodeID that is built
 // through a bitwise XOR operation betweeen NodeID and target
 func (nodeID NodeID) CalcDistance(target *NodeID) *NodeID {
-	result := NodeID{}
-	for i := 0; i < IDLength; i++ {
-		result[i] = nodeID[i] ^ target[i]
+	result := NodeID{length: nodeID.length}
+	for i := 0; i < nodeID.Len(); i++ {
+		result.bytes[i] = nodeID.bytes[i] ^ target.bytes[i]
 	}
 	return &result
 }
 
+// MarshalJSON encodes the NodeID as an array of its bytes, as 160-bit IDs were
+// encoded before IDs had a width
+func (nodeID NodeID) MarshalJSON() ([]byte, error) {
+	values := make([]int, nodeID.Len())
+	for i := range values {
+		values[i] = int(nodeID.bytes[i])
+	}
+	return json.Marshal(values)
+}
+
+// UnmarshalJSON decodes a NodeID encoded by MarshalJSON. The ID is 256 bits
+// wide if more bytes than in a 160-bit ID are given.
+func (nodeID *NodeID) UnmarshalJSON(data []byte) error {
+	var values []uint8
+	err := json.Unmarshal(data, &values)
+	if err != nil {
+		return err
+	}
+
+	length := IDLength
+	if len(values) > IDLength {
+		length = MaxIDLength
+	}
+	*nodeID = *newNodeIDFromBytes(values, length)
+	return nil
+}
+
 // String returns a simple string representation of a NodeID
 func (nodeID *NodeID) String() string {
-	return hex.EncodeToString(nodeID[0:IDLength])
+	return hex.EncodeToString(nodeID.Bytes())
+}
+
+// SetIDWidth sets the number of bits in the ID the node gets when it is
+// initialized. Returns an error unless `bits` is 160 or 256.
+func (kademlia *Node) SetIDWidth(bits int) error {
+	err := ValidateIDWidth(bits)
+	if err != nil {
+		return err
+	}
+
+	kademlia.idWidth = bits
+	return nil
+}
+
+// IDWidth returns the number of bits in the IDs of the node, 160 by default
+func (kademlia *Node) IDWidth() int {
+	if kademlia.RT != nil {
+		return kademlia.RT.Bits()
+	} else if kademlia.idWidth == 0 {
+		return IDLength * 8
+	}
+	return kademlia.idWidth
+}
+
+// keyID returns the node ID a value stored under `key` is looked up at in the
+// network of the node
+func (kademlia *Node) keyID(key string) *NodeID {
+	return KeyIDWithWidth(key, kademlia.IDWidth())
 }
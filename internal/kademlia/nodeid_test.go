@@ -1,6 +1,9 @@
 package kademlia
 
 import (
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,6 +18,27 @@ func TestNewNodeID(t *testing.T) {
 	assert.Equal(t, id2.String(), "2111111400000000000000000000000000000000")
 }
 
+func TestNewNodeIDBadInput(t *testing.T) {
+	assert.Equal(t, "1100000000000000000000000000000000000000", NewNodeID("11").String())
+	assert.Equal(t, "1100000000000000000000000000000000000000", NewNodeID("11zz").String())
+	assert.Equal(t, "0000000000000000000000000000000000000000", NewNodeID("").String())
+}
+
+func TestParseNodeID(t *testing.T) {
+	id, err := ParseNodeID("FFFFFFFF00000000000000000000000000000000")
+	assert.NoError(t, err)
+	assert.Equal(t, NewNodeID("FFFFFFFF00000000000000000000000000000000"), id)
+
+	_, err = ParseNodeID("FFFF")
+	assert.Equal(t, errors.New(errBadIDLength), err)
+
+	_, err = ParseNodeID("FFFFFFFF0000000000000000000000000000000000")
+	assert.Equal(t, errors.New(errBadIDLength), err)
+
+	_, err = ParseNodeID("ZZFFFFFF00000000000000000000000000000000")
+	assert.Error(t, err)
+}
+
 func TestNewRandomNodeID(t *testing.T) {
 	id1 := NewRandomNodeID()
 
@@ -50,3 +74,33 @@ func TestNodeIDLess(t *testing.T) {
 	assert.Equal(t, id1.Less(id2), false)
 	assert.Equal(t, id1.Less(id1), false)
 }
+
+func TestNodeIDWidth(t *testing.T) {
+	wide := "ffffffff00000000000000000000000000000000000000000000000000000001"
+	id, err := ParseNodeID(wide)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxIDLength*8, id.Bits())
+	assert.Equal(t, wide, id.String())
+	assert.Equal(t, NewNodeID(wide), id)
+
+	assert.Equal(t, IDLength*8, NewNodeID("FFFF").Bits())
+	assert.Equal(t, "ffff"+strings.Repeat("0", MaxIDLength*2-4), NewNodeIDWithWidth("FFFF", MaxIDLength*8).String())
+	assert.Equal(t, MaxIDLength*8, NewRandomNodeIDWithWidth(MaxIDLength*8).Bits())
+
+	assert.Equal(t, "0000000000000000000000000000000000000000000000000000000000000001", id.CalcDistance(NewNodeIDWithWidth("FFFFFFFF", MaxIDLength*8)).String())
+	assert.False(t, id.Equals(NewNodeID("ffffffff00000000000000000000000000000000")))
+
+	assert.NoError(t, ValidateIDWidth(256))
+	assert.EqualError(t, ValidateIDWidth(128), errBadIDWidth)
+}
+
+func TestNodeIDJSON(t *testing.T) {
+	for _, id := range []*NodeID{NewRandomNodeID(), NewRandomNodeIDWithWidth(MaxIDLength * 8)} {
+		data, err := json.Marshal(id)
+		assert.NoError(t, err)
+
+		decoded := NodeID{}
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, *id, decoded)
+	}
+}
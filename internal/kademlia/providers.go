@@ -0,0 +1,248 @@
+package kademlia
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// ProviderTTL the number of seconds a node keeps a provider of a key unless
+// the provider announces itself again
+const ProviderTTL int64 = 60
+
+// MaxProviders the largest number of providers a node keeps for a key
+const MaxProviders int = 100
+
+// providerRepublish how often a node announces the keys it provides again
+const providerRepublish = time.Duration(ProviderTTL/2) * time.Second
+
+const (
+	errNoProvider    string = "no provider given"
+	errBadProvider   string = "provider is not the sender"
+	errNoProviders   string = "no providers found"
+	errTooManyLeases string = "too many contacts kept for the key"
+)
+
+// lease is a contact kept for a key until `expires`
+type lease struct {
+	contact Contact
+	expires time.Time
+}
+
+// leases keeps contacts for keys until their lease expires, such as the
+// providers of a key
+type leases map[string]map[NodeID]lease
+
+// add keeps `contact` for `key` for `ttl` seconds, renewing its lease if it is
+// kept already. Returns an error if `max` other contacts are kept for the key,
+// so that contacts already kept are not pushed out by new ones.
+func (leases leases) add(key string, contact Contact, ttl int64, max int) error {
+	if leases[key] == nil {
+		leases[key] = make(map[NodeID]lease)
+	}
+
+	now := time.Now()
+	contacts := leases[key]
+	if _, exists := contacts[*contact.ID]; !exists && len(contacts) >= max {
+		for id, entry := range contacts {
+			if entry.expires.Before(now) {
+				delete(contacts, id)
+			}
+		}
+		if len(contacts) >= max {
+			return errors.New(errTooManyLeases)
+		}
+	}
+
+	contacts[*contact.ID] = lease{contact, now.Add(time.Duration(ttl) * time.Second)}
+	return nil
+}
+
+// list returns the contacts kept for `key` whose lease has not expired, ordered by ID
+func (leases leases) list(key string) []Contact {
+	now := time.Now()
+	contacts := []Contact{}
+	for _, entry := range leases[key] {
+		if entry.expires.After(now) {
+			contacts = append(contacts, entry.contact)
+		}
+	}
+
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].ID.Less(contacts[j].ID)
+	})
+	return contacts
+}
+
+// expire removes the contacts whose lease expired before `now`
+func (leases leases) expire(now time.Time) {
+	for key, contacts := range leases {
+		for id, entry := range contacts {
+			if entry.expires.Before(now) {
+				delete(contacts, id)
+			}
+		}
+		if len(contacts) == 0 {
+			delete(leases, key)
+		}
+	}
+}
+
+// validateProviderKey returns an error unless `key` is a hash, with or without namespace
+func validateProviderKey(key string) error {
+	_, hash, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = ParseHash(hash)
+	return err
+}
+
+// addLocalProvider keeps `contact` as a provider of `key` for `ttl` seconds. Returns
+// an error if the key has MaxProviders other providers.
+func (kademlia *Node) addLocalProvider(key string, contact Contact, ttl int64) error {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.providers == nil {
+		kademlia.providers = make(leases)
+	}
+	return kademlia.providers.add(key, contact, ttl, MaxProviders)
+}
+
+// localProviders returns the providers of `key` which have not expired, ordered by ID
+func (kademlia *Node) localProviders(key string) []Contact {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	return kademlia.providers.list(key)
+}
+
+// Provide announces the node as a provider of `key` to the k closest nodes and
+// keeps announcing it every ProviderTTL/2 seconds. Returns the first error a
+// node replied with if no node stored the provider.
+func (kademlia *Node) Provide(key string) error {
+	key = normalizeKey(key)
+	err := validateProviderKey(key)
+	if err != nil {
+		return err
+	}
+
+	kademlia.contentMutex.Lock()
+	if kademlia.provided == nil {
+		kademlia.provided = make(map[string]bool)
+	}
+	kademlia.provided[key] = true
+	kademlia.contentMutex.Unlock()
+
+	return kademlia.announceProvider(key)
+}
+
+// announceProvider stores the node as a provider of `key` locally and on the k closest nodes
+func (kademlia *Node) announceProvider(key string) error {
+	span := kademlia.tracer.Start("Provide", tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, key)
+
+	err := kademlia.addLocalProvider(key, *kademlia.RT.GetMe(), ProviderTTL)
+	if err != nil {
+		kademlia.logger.WithField(logger.FieldKey, key).Warn(err)
+	}
+
+	lookupSpan := span.Start("NodeLookup", tracing.Internal)
+	nodes := kademlia.nodeLookup(kademlia.keyID(key), lookupSpan, nil)
+	lookupSpan.End()
+
+	var firstErr error
+	stored := 0
+
+	client := kademlia.client.withSpan(span)
+	for _, node := range nodes {
+		_, err := client.SendAddProviderMessage(&node, kademlia.RT.GetMe(), key, ProviderTTL)
+
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeUnresponsive(node, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			stored++
+		}
+	}
+
+	if stored == 0 && firstErr != nil {
+		span.SetError(firstErr)
+		return firstErr
+	}
+	return nil
+}
+
+// republishProviders announces the node again as a provider of every key it provides
+func (kademlia *Node) republishProviders() {
+	kademlia.contentMutex.RLock()
+	keys := []string{}
+	for key := range kademlia.provided {
+		keys = append(keys, key)
+	}
+	kademlia.contentMutex.RUnlock()
+
+	for _, key := range keys {
+		err := kademlia.announceProvider(key)
+		if err != nil {
+			kademlia.logger.WithField(logger.FieldKey, key).Warn(err)
+		}
+	}
+}
+
+// FindProviders returns the providers of `key` kept locally or by the k closest
+// nodes, ordered by ID. Returns an error if no provider was found.
+func (kademlia *Node) FindProviders(key string) ([]Contact, error) {
+	key = normalizeKey(key)
+	err := validateProviderKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	span := kademlia.tracer.Start("FindProviders", tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, key)
+
+	lookupSpan := span.Start("NodeLookup", tracing.Internal)
+	nodes := kademlia.nodeLookup(kademlia.keyID(key), lookupSpan, nil)
+	lookupSpan.End()
+
+	providers := ContactCandidates{kademlia.localProviders(key)}
+	client := kademlia.client.withSpan(span)
+	for _, node := range nodes {
+		rpc, err := client.SendGetProvidersMessage(&node, kademlia.RT.GetMe(), key)
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeUnresponsive(node, err)
+			continue
+		} else if rpc.Payload != nil {
+			providers.AppendUnique(rpc.Payload.Providers)
+		}
+	}
+
+	if providers.Len() == 0 {
+		err := errors.New(errNoProviders)
+		span.SetError(err)
+		return nil, err
+	}
+
+	sort.Slice(providers.contacts, func(i, j int) bool {
+		return providers.contacts[i].ID.Less(providers.contacts[j].ID)
+	})
+	return providers.contacts, nil
+}
@@ -0,0 +1,125 @@
+package kademlia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalProviders(t *testing.T) {
+	key := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	node := Node{}
+
+	for i := 0; i < MaxProviders; i++ {
+		id := NewRandomNodeID()
+		assert.NoError(t, node.addLocalProvider(key, NewContact(id, "10.0.8.2:8080"), ProviderTTL+int64(i)))
+	}
+	assert.Equal(t, MaxProviders, len(node.localProviders(key)))
+
+	// providers kept are renewed but new providers are refused while the key is full
+	first := node.localProviders(key)[0]
+	assert.NoError(t, node.addLocalProvider(key, first, 1))
+	assert.True(t, node.providers[key][*first.ID].expires.Before(time.Now().Add(2*time.Second)))
+
+	provider := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.3:8080")
+	assert.EqualError(t, node.addLocalProvider(key, provider, ProviderTTL), errTooManyLeases)
+
+	providers := ContactCandidates{node.localProviders(key)}
+	assert.Equal(t, MaxProviders, providers.Len())
+	assert.False(t, providers.Contains(provider))
+	assert.True(t, providers.Contains(first))
+
+	// expired providers make room for new ones
+	node.providers[key][*first.ID] = lease{first, time.Now().Add(-time.Second)}
+	assert.NoError(t, node.addLocalProvider(key, provider, ProviderTTL))
+
+	providers = ContactCandidates{node.localProviders(key)}
+	assert.Equal(t, MaxProviders, providers.Len())
+	assert.True(t, providers.Contains(provider))
+	assert.False(t, providers.Contains(first))
+
+	node.providers.expire(time.Now().Add(time.Duration(ProviderTTL+int64(MaxProviders)) * time.Second))
+	assert.Equal(t, []Contact{}, node.localProviders(key))
+	assert.Empty(t, node.providers)
+}
+
+func TestIncomingProviderRPCS(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	key := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	sender := "1111111100000000000000000000000000000000"
+	provider := NewContact(NewNodeID(sender), "10.0.9.9:8080")
+	ttl := ProviderTTL * 10
+
+	rpc, _ := NewRPC(AddProvider, sender, sender, Payload{Key: &key, TTL: &ttl, Providers: []Contact{provider}})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+
+	// the provider is reached at the address it sent the RPC from
+	providers := node.localProviders(key)
+	assert.Equal(t, 1, len(providers))
+	assert.Equal(t, "10.0.8.2:8080", providers[0].Address)
+	assert.True(t, node.providers[key][*provider.ID].expires.Before(time.Now().Add(time.Duration(ProviderTTL+1)*time.Second)))
+
+	other := NewContact(NewNodeID("2222222200000000000000000000000000000000"), "10.0.8.2:8080")
+	rpc, _ = NewRPC(AddProvider, sender, sender, Payload{Key: &key, TTL: &ttl, Providers: []Contact{other}})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadProvider)
+
+	rpc, _ = NewRPC(AddProvider, sender, sender, Payload{Key: &key, TTL: &ttl})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNoProvider)
+
+	badKey := "not a key"
+	rpc, _ = NewRPC(AddProvider, sender, sender, Payload{Key: &badKey, TTL: &ttl, Providers: []Contact{provider}})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.Error(t, err)
+
+	rpc, _ = NewRPC(GetProviders, sender, sender, Payload{Key: &key})
+	reply, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, providers, reply.Payload.Providers)
+}
+
+func TestProvideAndFindProviders(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2920"), "10.0.8.2:8080")
+	provider := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.3:8080")
+	key := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+
+	announced := []Contact{}
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{})
+		switch *message.rpc.Type {
+		case AddProvider:
+			announced = append(announced, message.rpc.Payload.Providers...)
+		case GetProviders:
+			if len(announced) > 0 {
+				reply.Payload.Providers = []Contact{provider, me}
+			}
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	_, err := node.FindProviders(key)
+	assert.Error(t, err)
+
+	assert.NoError(t, node.Provide(key))
+	assert.Equal(t, []Contact{me}, announced)
+	assert.True(t, node.provided[key])
+
+	node.republishProviders()
+	assert.Equal(t, []Contact{me, me}, announced)
+
+	providers, err := node.FindProviders(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []Contact{me, provider}, providers)
+
+	assert.Error(t, node.Provide("not a key"))
+}
@@ -0,0 +1,299 @@
+package kademlia
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// SubscriptionTTL the number of seconds a node keeps a subscriber of a topic
+// unless the subscriber subscribes again
+const SubscriptionTTL int64 = 60
+
+// MaxSubscribers the largest number of subscribers a node keeps for a topic. A
+// PUBLISH reply carries MaxContacts of them, the others are asked for in pages.
+const MaxSubscribers int = 100
+
+// subscriptionBuffer the number of messages a Subscription buffers before
+// further messages are dropped
+const subscriptionBuffer = 16
+
+// subscriptionRenewal how often a node subscribes again to the topics it has subscriptions for
+const subscriptionRenewal = time.Duration(SubscriptionTTL/2) * time.Second
+
+const (
+	errNoMessage       string = "no message given"
+	errBadTopicKey     string = "topic key is not a hash"
+	errMessageTooLarge string = "message is too large"
+)
+
+// TopicMessage is a message published to the topic stored under `Topic`
+type TopicMessage struct {
+	Topic     string    `json:"topic"`
+	Data      string    `json:"data"`
+	Publisher string    `json:"publisher"`
+	Received  time.Time `json:"received"`
+}
+
+// Subscription receives the messages published to a topic on `Messages` until
+// it is closed. Messages arriving while the buffer of `Messages` is full are dropped.
+type Subscription struct {
+	Messages chan TopicMessage
+	key      string
+	node     *Node
+}
+
+// TopicKey returns the key subscriptions to `topic` are stored under, which is
+// the SHA-1 hash of the topic
+func TopicKey(topic string) string {
+	sha1 := sha1.Sum([]byte(topic))
+	return hex.EncodeToString(sha1[:])
+}
+
+func validateTopicKey(key string) error {
+	_, _, err := ParseHash(key)
+	if err != nil {
+		return errors.New(errBadTopicKey)
+	}
+	return nil
+}
+
+// addLocalSubscriber keeps `contact` as a subscriber of the topic stored under `key` for `ttl` seconds.
+// Returns an error if the topic has MaxSubscribers other subscribers.
+func (kademlia *Node) addLocalSubscriber(key string, contact Contact, ttl int64) error {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.subscribers == nil {
+		kademlia.subscribers = make(leases)
+	}
+	return kademlia.subscribers.add(key, contact, ttl, MaxSubscribers)
+}
+
+// localSubscribers returns the subscribers of the topic stored under `key` which have not expired
+func (kademlia *Node) localSubscribers(key string) []Contact {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	return kademlia.subscribers.list(key)
+}
+
+// subscribersAfter returns up to `limit` of the subscribers of the topic stored under
+// `key` whose IDs come after `after`, ordered by ID, and whether more subscribers follow
+func (kademlia *Node) subscribersAfter(key string, after string, limit int) ([]Contact, bool) {
+	page := []Contact{}
+	for _, subscriber := range kademlia.localSubscribers(key) {
+		if after != "" && subscriber.ID.String() <= strings.ToLower(after) {
+			continue
+		} else if len(page) == limit {
+			return page, true
+		}
+		page = append(page, subscriber)
+	}
+	return page, false
+}
+
+// deliver passes `message` to every Subscription of the node to its topic
+func (kademlia *Node) deliver(message TopicMessage) {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	for subscription := range kademlia.subscribed[message.Topic] {
+		select {
+		case subscription.Messages <- message:
+		default:
+			kademlia.logger.WithField(logger.FieldKey, message.Topic).Warn("subscription buffer is full, message dropped")
+		}
+	}
+}
+
+// Subscribe subscribes the node to `topic` on the k closest nodes to TopicKey(topic)
+// and keeps subscribing again every SubscriptionTTL/2 seconds until the returned
+// Subscription is closed. Returns the first error a node replied with if no node
+// stored the subscription.
+func (kademlia *Node) Subscribe(topic string) (*Subscription, error) {
+	key := TopicKey(topic)
+	subscription := &Subscription{make(chan TopicMessage, subscriptionBuffer), key, kademlia}
+
+	kademlia.contentMutex.Lock()
+	if kademlia.subscribed == nil {
+		kademlia.subscribed = make(map[string]map[*Subscription]bool)
+	}
+	if kademlia.subscribed[key] == nil {
+		kademlia.subscribed[key] = make(map[*Subscription]bool)
+	}
+	kademlia.subscribed[key][subscription] = true
+	kademlia.contentMutex.Unlock()
+
+	err := kademlia.announceSubscription(key)
+	if err != nil {
+		subscription.Close()
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// Close stops the subscription from receiving messages and closes `Messages`.
+// The node stops subscribing again once it has no subscriptions to the topic,
+// its subscriber records then expire after SubscriptionTTL seconds.
+func (subscription *Subscription) Close() {
+	kademlia := subscription.node
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if !kademlia.subscribed[subscription.key][subscription] {
+		return
+	}
+
+	delete(kademlia.subscribed[subscription.key], subscription)
+	if len(kademlia.subscribed[subscription.key]) == 0 {
+		delete(kademlia.subscribed, subscription.key)
+	}
+	close(subscription.Messages)
+}
+
+// announceSubscription stores the node as a subscriber of the topic stored under
+// `key` locally and on the k closest nodes
+func (kademlia *Node) announceSubscription(key string) error {
+	span := kademlia.tracer.Start("Subscribe", tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, key)
+
+	err := kademlia.addLocalSubscriber(key, *kademlia.RT.GetMe(), SubscriptionTTL)
+	if err != nil {
+		kademlia.logger.WithField(logger.FieldKey, key).Warn(err)
+	}
+
+	lookupSpan := span.Start("NodeLookup", tracing.Internal)
+	nodes := kademlia.nodeLookup(kademlia.keyID(key), lookupSpan, nil)
+	lookupSpan.End()
+
+	var firstErr error
+	stored := 0
+
+	client := kademlia.client.withSpan(span)
+	for _, node := range nodes {
+		_, err := client.SendSubscribeMessage(&node, kademlia.RT.GetMe(), key, SubscriptionTTL)
+
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeUnresponsive(node, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			stored++
+		}
+	}
+
+	if stored == 0 && firstErr != nil {
+		span.SetError(firstErr)
+		return firstErr
+	}
+	return nil
+}
+
+// renewSubscriptions subscribes the node again to every topic it has subscriptions for
+func (kademlia *Node) renewSubscriptions() {
+	kademlia.contentMutex.RLock()
+	keys := []string{}
+	for key := range kademlia.subscribed {
+		keys = append(keys, key)
+	}
+	kademlia.contentMutex.RUnlock()
+
+	for _, key := range keys {
+		err := kademlia.announceSubscription(key)
+		if err != nil {
+			kademlia.logger.WithField(logger.FieldKey, key).Warn(err)
+		}
+	}
+}
+
+// IsMessageTooLarge returns true if `err` means that a message larger than
+// MaxValueSize was published
+func IsMessageTooLarge(err error) bool {
+	return err != nil && err.Error() == errMessageTooLarge
+}
+
+// Publish sends `data` to the subscribers of `topic`. The k closest nodes to
+// TopicKey(topic) are sent a PUBLISH RPC and reply with the subscribers they
+// keep, a page at a time, which are then sent the message. Returns the number
+// of subscribers the message was delivered to.
+func (kademlia *Node) Publish(topic string, data string) (int, error) {
+	if len(data) > MaxValueSize {
+		return 0, errors.New(errMessageTooLarge)
+	}
+
+	key := TopicKey(topic)
+	span := kademlia.tracer.Start("Publish", tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, key)
+
+	lookupSpan := span.Start("NodeLookup", tracing.Internal)
+	nodes := kademlia.nodeLookup(kademlia.keyID(key), lookupSpan, nil)
+	lookupSpan.End()
+
+	me := kademlia.RT.GetMe()
+	subscribers := ContactCandidates{kademlia.localSubscribers(key)}
+	reached := map[NodeID]bool{}
+
+	client := kademlia.client.withSpan(span)
+	send := func(node Contact) *RPC {
+		rpc, err := client.SendPublishMessage(&node, me, key, data)
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeUnresponsive(node, err)
+			return nil
+		}
+		reached[*node.ID] = true
+		return rpc
+	}
+
+	for _, node := range nodes {
+		rpc := send(node)
+
+		// the pages of subscribers after the first are asked for until the last one
+		for pages := 1; rpc != nil && rpc.Payload != nil; pages++ {
+			subscribers.AppendUnique(rpc.Payload.Providers)
+
+			page := rpc.Payload.Range
+			if page == nil || !page.More || len(rpc.Payload.Providers) == 0 || pages > MaxSubscribers/MaxContacts {
+				break
+			}
+
+			after := rpc.Payload.Providers[len(rpc.Payload.Providers)-1].ID.String()
+			var err error
+			rpc, err = client.SendFindSubscribersMessage(&node, me, key, after)
+			if err != nil {
+				kademlia.logger.WithFields(logger.Fields{
+					logger.FieldPeerID: node.ID.String(),
+					logger.FieldKey:    key,
+				}).Warn(err)
+			}
+		}
+	}
+
+	delivered := 0
+	for _, subscriber := range subscribers.contacts {
+		if subscriber.ID.Equals(me.ID) {
+			kademlia.deliver(TopicMessage{key, data, me.ID.String(), time.Now()})
+			delivered++
+		} else if reached[*subscriber.ID] || send(subscriber) != nil {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
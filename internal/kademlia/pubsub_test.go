@@ -0,0 +1,192 @@
+package kademlia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicKey(t *testing.T) {
+	assert.Equal(t, "3c6bdcddc94f64bf77deb306aae490a90a6fc300", TopicKey("news"))
+	assert.NoError(t, validateTopicKey(TopicKey("news")))
+	assert.EqualError(t, validateTopicKey("news"), errBadTopicKey)
+}
+
+func TestIncomingPubSubRPCS(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	key := TopicKey("news")
+	sender := "1111111100000000000000000000000000000000"
+	ttl := SubscriptionTTL
+
+	rpc, _ := NewRPC(Subscribe, sender, sender, Payload{Key: &key, TTL: &ttl})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, []Contact{NewContact(NewNodeID(sender), "10.0.8.2:8080")}, node.localSubscribers(key))
+
+	badKey := "news"
+	rpc, _ = NewRPC(Subscribe, sender, sender, Payload{Key: &badKey, TTL: &ttl})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadTopicKey)
+
+	subscription := &Subscription{make(chan TopicMessage, 1), key, &node}
+	node.subscribed = map[string]map[*Subscription]bool{key: {subscription: true}}
+
+	message := "hello"
+	rpc, _ = NewRPC(Publish, sender, sender, Payload{Key: &key, Value: &message})
+	reply, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, node.localSubscribers(key), reply.Payload.Providers)
+	assert.Nil(t, reply.Payload.Value)
+
+	received := <-subscription.Messages
+	assert.Equal(t, key, received.Topic)
+	assert.Equal(t, "hello", received.Data)
+	assert.Equal(t, sender, received.Publisher)
+
+	// messages arriving while the buffer is full are dropped
+	node.deliver(TopicMessage{Topic: key, Data: "first"})
+	node.deliver(TopicMessage{Topic: key, Data: "second"})
+	assert.Equal(t, "first", (<-subscription.Messages).Data)
+	assert.Empty(t, subscription.Messages)
+
+	rpc, _ = NewRPC(Publish, sender, sender, Payload{Key: &key})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNoMessage)
+}
+
+func TestSubscribeAndPublish(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("3c6bdcddc94f64bf77deb306aae490a90a6fc301"), "10.0.8.2:8080")
+	subscriber := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.3:8080")
+
+	sent := map[string][]RPCType{}
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		sent[message.receiver.Address] = append(sent[message.receiver.Address], *message.rpc.Type)
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{})
+		if *message.rpc.Type == Publish && message.receiver.Address == peer.Address {
+			reply.Payload.Providers = []Contact{subscriber, me}
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	subscription, err := node.Subscribe("news")
+	assert.NoError(t, err)
+	assert.Equal(t, []RPCType{FindNode, Subscribe}, sent[peer.Address])
+
+	delivered, err := node.Publish("news", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []RPCType{Publish}, sent[subscriber.Address])
+	assert.Equal(t, "hello", (<-subscription.Messages).Data)
+
+	_, err = node.Publish("news", string(make([]byte, MaxValueSize+1)))
+	assert.EqualError(t, err, errMessageTooLarge)
+	assert.True(t, IsMessageTooLarge(err))
+
+	subscription.Close()
+	subscription.Close()
+	_, open := <-subscription.Messages
+	assert.False(t, open)
+
+	// closed subscriptions are not renewed
+	sent = map[string][]RPCType{}
+	node.renewSubscriptions()
+	assert.Empty(t, sent)
+}
+
+func TestIncomingPublishPagesSubscribers(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	key := TopicKey("news")
+	ttl := SubscriptionTTL
+	for i := 0; i < MaxSubscribers; i++ {
+		sender := NewRandomNodeID().String()
+		rpc, _ := NewRPC(Subscribe, sender, sender, Payload{Key: &key, TTL: &ttl})
+		_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+		assert.NoError(t, err)
+	}
+
+	// subscribers over MaxSubscribers are refused but the subscribers kept may renew
+	sender := NewRandomNodeID().String()
+	rpc, _ := NewRPC(Subscribe, sender, sender, Payload{Key: &key, TTL: &ttl})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errTooManyLeases)
+
+	kept := node.localSubscribers(key)
+	assert.Equal(t, MaxSubscribers, len(kept))
+	renewed := kept[0].ID.String()
+	rpc, _ = NewRPC(Subscribe, renewed, renewed, Payload{Key: &key, TTL: &ttl})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+
+	// the PUBLISH reply carries the first page and the others are asked for after it
+	message := "hello"
+	rpc, _ = NewRPC(Publish, sender, sender, Payload{Key: &key, Value: &message})
+	reply, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, kept[:MaxContacts], reply.Payload.Providers)
+	assert.True(t, reply.Payload.Range.More)
+
+	received := []Contact{}
+	for reply.Payload.Range.More {
+		received = append(received, reply.Payload.Providers...)
+		after := received[len(received)-1].ID.String()
+		rpc, _ = NewRPC(Publish, sender, sender, Payload{Key: &key, Range: &RangeQuery{After: after, Limit: MaxContacts}})
+		reply, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+		assert.NoError(t, err)
+	}
+	received = append(received, reply.Payload.Providers...)
+	assert.Equal(t, kept, received)
+}
+
+func TestPublishPagesSubscribers(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("3c6bdcddc94f64bf77deb306aae490a90a6fc301"), "10.0.8.2:8080")
+
+	peerNode := Node{content: make(map[string]string), deadline: 10}
+	peerNode.RT = NewRoutingTable(peer)
+	server := InitServer(&peerNode)
+
+	key := TopicKey("news")
+	subscribers := MaxContacts*2 + 1
+	for i := 0; i < subscribers; i++ {
+		assert.NoError(t, peerNode.addLocalSubscriber(key, NewContact(NewRandomNodeID(), "10.0.9.1:8080"), SubscriptionTTL))
+	}
+
+	published := map[string]int{}
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		rpc := message.rpc
+		if message.receiver.Address != peer.Address {
+			published[message.receiver.ID.String()]++
+			reply, _ := NewRPC(OK, message.receiver.ID.String(), me.ID.String(), Payload{})
+			return Message{message.receiver, *reply, nil}
+		}
+
+		reply, err := server.handleIncomingRPCS(&rpc, "10.0.8.1")
+		if err != nil {
+			reply = NewErrorRPC(&rpc, peer.ID.String(), errorCode(err), err.Error())
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	delivered, err := node.Publish("news", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, subscribers, delivered)
+
+	// every subscriber is sent the message once
+	assert.Equal(t, subscribers, len(published))
+	for _, count := range published {
+		assert.Equal(t, 1, count)
+	}
+}
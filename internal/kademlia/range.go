@@ -0,0 +1,236 @@
+package kademlia
+
+import (
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// MaxRangeKeys the largest number of keys asked for or returned in a FIND_RANGE
+// RPC, so that a reply of MaxKeySize keys fits in the UDP read buffer
+const MaxRangeKeys int = 50
+
+const (
+	errNoRange       string = "no range given"
+	errBadPrefix     string = "range prefix is not a hex ID prefix"
+	errBadRangeLimit string = "range limit must be between 1 and 50"
+	errTooManyKeys   string = "too many keys given"
+)
+
+// RangeQuery asks a node for up to `Limit` of the keys it stores whose IDs start
+// with the hex `Prefix`, ordered by ID and coming after the key `After`. The reply
+// carries the `Keys` and whether the node holds `More` keys in the range.
+type RangeQuery struct {
+	Prefix string   `json:"prefix"`
+	After  string   `json:"after,omitempty"`
+	Limit  int      `json:"limit"`
+	Keys   []string `json:"keys,omitempty"`
+	More   bool     `json:"more,omitempty"`
+}
+
+// KeyPage is a page of the keys in a range. `Next` is passed as `after` to
+// FindKeysInRangeAfter to get the next page and is empty on the last page.
+type KeyPage struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next,omitempty"`
+}
+
+func validateRange(query *RangeQuery) error {
+	if len(query.Prefix) > MaxIDLength*2 || strings.Trim(strings.ToLower(query.Prefix), "0123456789abcdef") != "" {
+		return errors.New(errBadPrefix)
+	}
+
+	if query.Limit < 1 || query.Limit > MaxRangeKeys {
+		return errors.New(errBadRangeLimit)
+	}
+
+	if len(query.Keys) > MaxRangeKeys {
+		return errors.New(errTooManyKeys)
+	}
+
+	if len(query.After) > MaxKeySize {
+		return errors.New(errKeyTooLarge)
+	}
+	for _, key := range query.Keys {
+		if len(key) > MaxKeySize {
+			return errors.New(errKeyTooLarge)
+		}
+	}
+	return nil
+}
+
+// rangeBound returns the ID `bits` wide starting with `prefix` with the
+// remaining digits set to `digit`
+func rangeBound(prefix string, digit string, bits int) *NodeID {
+	if len(prefix) > bits/4 {
+		prefix = prefix[:bits/4]
+	}
+
+	padded := prefix + strings.Repeat(digit, bits/4-len(prefix))
+	decoded, _ := hex.DecodeString(padded)
+	return newNodeIDFromBytes(decoded, bits/8)
+}
+
+// rangePosition returns the position of `key` in the order keys are listed in,
+// by the ID the key is looked up at and then by the key itself
+func (kademlia *Node) rangePosition(key string) string {
+	return kademlia.keyID(key).String() + key
+}
+
+// inRange returns true if `key` is listed by `query`
+func (kademlia *Node) inRange(key string, query *RangeQuery) bool {
+	if !strings.HasPrefix(kademlia.keyID(key).String(), strings.ToLower(query.Prefix)) {
+		return false
+	}
+	return query.After == "" || kademlia.rangePosition(key) > kademlia.rangePosition(query.After)
+}
+
+// sortKeys sorts `keys` in range order and removes duplicates. Keys over `limit`
+// are dropped and reported as more keys.
+func (kademlia *Node) sortKeys(keys []string, limit int) ([]string, bool) {
+	sort.Slice(keys, func(i, j int) bool {
+		return kademlia.rangePosition(keys[i]) < kademlia.rangePosition(keys[j])
+	})
+
+	unique := []string{}
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+
+	if len(unique) > limit {
+		return unique[:limit], true
+	}
+	return unique, false
+}
+
+// localKeysInRange returns the keys of the values and records in the store of the
+// node listed by `query`, and whether the node holds more than `query.Limit`.
+// Tombstones and cached values are not listed.
+func (kademlia *Node) localKeysInRange(query *RangeQuery) ([]string, bool) {
+	kademlia.contentMutex.RLock()
+	keys := []string{}
+	for key := range kademlia.content {
+		if kademlia.inRange(key, query) {
+			keys = append(keys, key)
+		}
+	}
+	for key, record := range kademlia.records {
+		if !record.Deleted && kademlia.inRange(key, query) {
+			keys = append(keys, key)
+		}
+	}
+	kademlia.contentMutex.RUnlock()
+
+	return kademlia.sortKeys(keys, query.Limit)
+}
+
+// FindKeysInRange returns the first page of up to `limit` keys whose IDs start
+// with the hex `prefix`
+func (kademlia *Node) FindKeysInRange(prefix string, limit int) (*KeyPage, error) {
+	return kademlia.FindKeysInRangeAfter(prefix, "", limit)
+}
+
+// FindKeysInRangeAfter returns the page of up to `limit` keys whose IDs start with
+// the hex `prefix` coming after the key `after`, in order of their IDs. The range
+// is walked from `after`, or from the start of the range, by asking the nodes found
+// by a lookup of the target for their keys and advancing the target to the next
+// node known in the range, until the page is full or the end of the range is reached.
+// `Next` is set on every page but the one reaching the end of the range.
+func (kademlia *Node) FindKeysInRangeAfter(prefix string, after string, limit int) (*KeyPage, error) {
+	query := RangeQuery{Prefix: strings.ToLower(prefix), After: after, Limit: limit}
+	if query.Limit > MaxRangeKeys {
+		query.Limit = MaxRangeKeys
+	}
+
+	err := validateRange(&query)
+	if err != nil {
+		return nil, err
+	}
+
+	span := kademlia.tracer.Start("FindKeysInRange", tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, query.Prefix)
+
+	end := rangeBound(query.Prefix, "f", kademlia.IDWidth())
+	target := rangeBound(query.Prefix, "0", kademlia.IDWidth())
+	if after != "" {
+		target = kademlia.keyID(after)
+	}
+
+	keys, more := kademlia.localKeysInRange(&query)
+	client := kademlia.client.withSpan(span)
+	var asked ContactCandidates
+	for target != nil {
+		lookupSpan := span.Start("NodeLookup", tracing.Internal)
+		nodes := kademlia.nodeLookup(target, lookupSpan, nil)
+		lookupSpan.End()
+
+		for _, node := range nodes {
+			if asked.Contains(node) {
+				continue
+			}
+			asked.Append([]Contact{node})
+
+			found, nodeMore := kademlia.askKeysInRange(client, node, &query)
+			keys = append(keys, found...)
+			more = more || nodeMore
+		}
+
+		var truncated bool
+		keys, truncated = kademlia.sortKeys(keys, query.Limit)
+		if (more || truncated || len(keys) == query.Limit) && len(keys) > 0 {
+			// the next page walks on from the last key of this one
+			return &KeyPage{Keys: keys, Next: keys[len(keys)-1]}, nil
+		}
+
+		candidates := append(nodes, kademlia.RT.FindClosestContacts(target, BucketSize)...)
+		target = nextInRange(target, end, candidates, &asked)
+	}
+	return &KeyPage{Keys: keys}, nil
+}
+
+// nextInRange returns the smallest ID of the `candidates` not `asked` yet coming
+// after `target` and up to `end`, or nil once the end of the range is reached
+func nextInRange(target *NodeID, end *NodeID, candidates []Contact, asked *ContactCandidates) *NodeID {
+	var next *NodeID
+	for _, candidate := range candidates {
+		if asked.Contains(candidate) || !target.Less(candidate.ID) || end.Less(candidate.ID) {
+			continue
+		}
+		if next == nil || candidate.ID.Less(next) {
+			next = candidate.ID
+		}
+	}
+	return next
+}
+
+// askKeysInRange sends `query` to `node` and returns the keys it replied with which
+// are in the range, and whether it holds more
+func (kademlia *Node) askKeysInRange(client *Client, node Contact, query *RangeQuery) ([]string, bool) {
+	rpc, err := client.SendFindRangeMessage(&node, kademlia.RT.GetMe(), *query)
+	if err != nil {
+		kademlia.logger.WithFields(logger.Fields{
+			logger.FieldPeerID: node.ID.String(),
+			logger.FieldKey:    query.Prefix,
+		}).Warn(err)
+		kademlia.removeUnresponsive(node, err)
+		return nil, false
+	} else if rpc.Payload == nil || rpc.Payload.Range == nil {
+		return nil, false
+	}
+
+	// keys outside of the range are ignored
+	keys := []string{}
+	for _, key := range rpc.Payload.Range.Keys {
+		if kademlia.inRange(key, query) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rpc.Payload.Range.More
+}
@@ -0,0 +1,159 @@
+package kademlia
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRange(t *testing.T) {
+	assert.NoError(t, validateRange(&RangeQuery{Prefix: "aB", Limit: 1}))
+	assert.NoError(t, validateRange(&RangeQuery{Prefix: "", Limit: MaxRangeKeys}))
+	assert.EqualError(t, validateRange(&RangeQuery{Prefix: "zz", Limit: 1}), errBadPrefix)
+	assert.EqualError(t, validateRange(&RangeQuery{Prefix: "aa", Limit: 0}), errBadRangeLimit)
+	assert.EqualError(t, validateRange(&RangeQuery{Prefix: "aa", Limit: MaxRangeKeys + 1}), errBadRangeLimit)
+	assert.EqualError(t, validateRange(&RangeQuery{Prefix: "aa", Limit: 1, Keys: make([]string, MaxRangeKeys+1)}), errTooManyKeys)
+}
+
+func TestLocalKeysInRange(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.insertLocalStore("aa00000000000000000000000000000000000002", "1600000000:b")
+	node.insertLocalStore("aa00000000000000000000000000000000000001", "1600000000:a")
+	node.insertLocalStore(ContentNamespace+"aa00000000000000000000000000000000000001", "1600000000:a")
+	node.insertLocalStore("ab00000000000000000000000000000000000001", "1600000000:c")
+	node.insertCache("aa00000000000000000000000000000000000003", "1600000000:d", 10)
+	owner := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.2:8080")
+	node.insertLocalStore("aa00000000000000000000000000000000000004", "1:e")
+	node.setValueOwner("aa00000000000000000000000000000000000004", owner)
+	_ = node.putLocalRecord("aa00000000000000000000000000000000000004", Record{Publisher: owner.ID.String(), Deleted: true, Timestamp: 2e9, Resolution: LastWriterWins})
+
+	keys, more := node.localKeysInRange(&RangeQuery{Prefix: "AA", Limit: 10})
+	assert.Equal(t, []string{
+		ContentNamespace + "aa00000000000000000000000000000000000001",
+		"aa00000000000000000000000000000000000001",
+		"aa00000000000000000000000000000000000002",
+	}, keys)
+	assert.False(t, more)
+
+	keys, more = node.localKeysInRange(&RangeQuery{Prefix: "aa", Limit: 1, After: ContentNamespace + "aa00000000000000000000000000000000000001"})
+	assert.Equal(t, []string{"aa00000000000000000000000000000000000001"}, keys)
+	assert.True(t, more)
+}
+
+func TestIncomingFindRange(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	node.insertLocalStore("aa00000000000000000000000000000000000001", "1600000000:a")
+	server := InitServer(&node)
+
+	sender := "1111111100000000000000000000000000000000"
+	rpc, _ := NewRPC(FindRange, sender, sender, Payload{Range: &RangeQuery{Prefix: "aa", Limit: 5}})
+	reply, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aa00000000000000000000000000000000000001"}, reply.Payload.Range.Keys)
+
+	rpc, _ = NewRPC(FindRange, sender, sender, Payload{})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNoRange)
+}
+
+func TestFindKeysInRange(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("aa00000000000000000000000000000000000000"), "10.0.8.2:8080")
+	stored := []string{
+		"aa00000000000000000000000000000000000001",
+		"aa00000000000000000000000000000000000003",
+		"bb00000000000000000000000000000000000001",
+	}
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.insertLocalStore("aa00000000000000000000000000000000000002", "1600000000:a")
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{})
+		if *message.rpc.Type == FindRange {
+			query := *message.rpc.Payload.Range
+
+			// the peer returns a key outside of the range too
+			for _, key := range stored {
+				if len(query.Keys) < query.Limit && (query.After == "" || key > query.After) {
+					query.Keys = append(query.Keys, key)
+				}
+			}
+			reply.Payload.Range = &query
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	page, err := node.FindKeysInRange("aa", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aa00000000000000000000000000000000000001", "aa00000000000000000000000000000000000002"}, page.Keys)
+	assert.Equal(t, "aa00000000000000000000000000000000000002", page.Next)
+
+	page, err = node.FindKeysInRangeAfter("aa", page.Next, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aa00000000000000000000000000000000000003"}, page.Keys)
+	assert.Equal(t, "", page.Next)
+
+	_, err = node.FindKeysInRange("not hex", 2)
+	assert.EqualError(t, err, errBadPrefix)
+}
+
+func TestFindKeysInRangeWalksPeers(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+
+	// every peer in the range stores the key just after its ID
+	stored := map[string][]string{}
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	for i, prefix := range []string{"aa10", "aa40", "aa70", "aaa0", "aad0"} {
+		peer := NewContact(NewNodeID(prefix+"000000000000000000000000000000000000"), fmt.Sprintf("10.0.8.%d:8080", i+2))
+		node.RT.AddContact(peer)
+		stored[peer.Address] = []string{prefix + "000000000000000000000000000000000001", "bb00000000000000000000000000000000000001"}
+	}
+	node.insertLocalStore("aa50000000000000000000000000000000000001", "1600000000:a")
+
+	asked := map[string]int{}
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, message.receiver.ID.String(), me.ID.String(), Payload{})
+		if *message.rpc.Type == FindRange {
+			asked[message.receiver.Address]++
+			query := *message.rpc.Payload.Range
+			for _, key := range stored[message.receiver.Address] {
+				if query.After == "" || key > query.After {
+					query.Keys = append(query.Keys, key)
+				}
+			}
+			reply.Payload.Range = &query
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	page, err := node.FindKeysInRange("aa", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"aa10000000000000000000000000000000000001",
+		"aa40000000000000000000000000000000000001",
+		"aa50000000000000000000000000000000000001",
+	}, page.Keys)
+	assert.Equal(t, "aa50000000000000000000000000000000000001", page.Next)
+
+	// the walk stops once the page is full
+	assert.Equal(t, 0, asked["10.0.8.4:8080"]+asked["10.0.8.5:8080"]+asked["10.0.8.6:8080"])
+
+	page, err = node.FindKeysInRangeAfter("aa", page.Next, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"aa70000000000000000000000000000000000001",
+		"aaa0000000000000000000000000000000000001",
+		"aad0000000000000000000000000000000000001",
+	}, page.Keys)
+	assert.Equal(t, "aad0000000000000000000000000000000000001", page.Next)
+
+	page, err = node.FindKeysInRangeAfter("aa", page.Next, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, page.Keys)
+	assert.Equal(t, "", page.Next)
+}
@@ -0,0 +1,155 @@
+package kademlia
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTrackedPeers is the number of per peer buckets kept before idle ones are pruned
+	maxTrackedPeers int = 4096
+)
+
+const (
+	errBanned      string = "sender is banned"
+	errRateLimited string = "rate limit exceeded"
+)
+
+// tokenBucket definition
+// holds up to `burst` tokens that are refilled at `rate` tokens per second
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a new instance of a full tokenBucket
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate, float64(burst), float64(burst), now}
+}
+
+// take refills the bucket with the tokens gained since the last call and
+// consumes one token. Returns false if the bucket was empty.
+func (tokenBucket *tokenBucket) take(now time.Time) bool {
+	tokenBucket.refill(now)
+
+	if tokenBucket.tokens < 1 {
+		return false
+	}
+
+	tokenBucket.tokens--
+	return true
+}
+
+func (tokenBucket *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(tokenBucket.last).Seconds()
+	if elapsed > 0 {
+		tokenBucket.tokens += elapsed * tokenBucket.rate
+		if tokenBucket.tokens > tokenBucket.burst {
+			tokenBucket.tokens = tokenBucket.burst
+		}
+		tokenBucket.last = now
+	}
+}
+
+// full returns true if the bucket would be full at the time `now`
+func (tokenBucket *tokenBucket) full(now time.Time) bool {
+	tokenBucket.refill(now)
+	return tokenBucket.tokens >= tokenBucket.burst
+}
+
+// rateLimiter definition
+// limits the number of packets accepted per sender IP and in total,
+// and rejects every packet from a banned IP
+type rateLimiter struct {
+	mutex     sync.Mutex
+	global    *tokenBucket
+	peers     map[string]*tokenBucket
+	banned    map[string]bool
+	peerRate  float64
+	peerBurst int
+	now       func() time.Time
+}
+
+// newRateLimiter returns a new instance of a rateLimiter using the rates and
+// ban list in `config`
+func newRateLimiter(config ServerConfig) *rateLimiter {
+	limiter := &rateLimiter{}
+	limiter.now = time.Now
+	limiter.global = newTokenBucket(config.GlobalRate, config.GlobalBurst, limiter.now())
+	limiter.peers = make(map[string]*tokenBucket)
+	limiter.banned = make(map[string]bool)
+	limiter.peerRate = config.PeerRate
+	limiter.peerBurst = config.PeerBurst
+
+	for _, ip := range config.BanList {
+		limiter.banned[ip] = true
+	}
+
+	return limiter
+}
+
+// allow returns nil if a packet from `ip` should be handled. The per peer
+// limit is checked before the global one so that a single flooding peer
+// does not use up the tokens of everyone else.
+func (limiter *rateLimiter) allow(ip string) error {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if limiter.banned[ip] {
+		return errors.New(errBanned)
+	}
+
+	now := limiter.now()
+	peer, exists := limiter.peers[ip]
+	if !exists {
+		if len(limiter.peers) >= maxTrackedPeers {
+			limiter.prune(now)
+		}
+		peer = newTokenBucket(limiter.peerRate, limiter.peerBurst, now)
+		limiter.peers[ip] = peer
+	}
+
+	if !peer.take(now) || !limiter.global.take(now) {
+		return errors.New(errRateLimited)
+	}
+
+	return nil
+}
+
+// prune removes the buckets of peers that have been idle long enough for
+// their bucket to be refilled, they would start out full anyway
+func (limiter *rateLimiter) prune(now time.Time) {
+	for ip, peer := range limiter.peers {
+		if peer.full(now) {
+			delete(limiter.peers, ip)
+		}
+	}
+}
+
+// ban adds `ip` to the ban list
+func (limiter *rateLimiter) ban(ip string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.banned[ip] = true
+	delete(limiter.peers, ip)
+}
+
+// unban removes `ip` from the ban list
+func (limiter *rateLimiter) unban(ip string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	delete(limiter.banned, ip)
+}
+
+// isBanned returns true if `ip` is in the ban list
+func (limiter *rateLimiter) isBanned(ip string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.banned[ip]
+}
@@ -0,0 +1,96 @@
+package kademlia
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestLimiter returns a rateLimiter whose clock only moves when `clock` is changed
+func newTestLimiter(config ServerConfig, clock *time.Time) *rateLimiter {
+	limiter := newRateLimiter(config)
+	limiter.now = func() time.Time { return *clock }
+	limiter.global.last = *clock
+	return limiter
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	bucket := newTokenBucket(2, 2, now)
+
+	assert.True(t, bucket.take(now))
+	assert.True(t, bucket.take(now))
+	assert.False(t, bucket.take(now))
+
+	// half a second at 2 tokens per second gives one new token
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, bucket.take(now))
+	assert.False(t, bucket.take(now))
+
+	// never refill above the burst size
+	now = now.Add(time.Hour)
+	assert.True(t, bucket.full(now))
+	assert.Equal(t, float64(2), bucket.tokens)
+}
+
+func TestRateLimiterPerPeer(t *testing.T) {
+	now := time.Unix(0, 0)
+	config := ServerConfig{GlobalRate: 100, GlobalBurst: 100, PeerRate: 1, PeerBurst: 3}
+	limiter := newTestLimiter(config, &now)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, limiter.allow("10.0.8.1"))
+	}
+	assert.Equal(t, errors.New(errRateLimited), limiter.allow("10.0.8.1"))
+
+	// other peers are not affected by the flooding peer
+	assert.NoError(t, limiter.allow("10.0.8.2"))
+
+	now = now.Add(time.Second)
+	assert.NoError(t, limiter.allow("10.0.8.1"))
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+	now := time.Unix(0, 0)
+	config := ServerConfig{GlobalRate: 1, GlobalBurst: 2, PeerRate: 100, PeerBurst: 100}
+	limiter := newTestLimiter(config, &now)
+
+	assert.NoError(t, limiter.allow("10.0.8.1"))
+	assert.NoError(t, limiter.allow("10.0.8.2"))
+	assert.Equal(t, errors.New(errRateLimited), limiter.allow("10.0.8.3"))
+}
+
+func TestRateLimiterBanList(t *testing.T) {
+	now := time.Unix(0, 0)
+	config := DefaultServerConfig()
+	config.BanList = []string{"10.0.8.1"}
+	limiter := newTestLimiter(config, &now)
+
+	assert.Equal(t, errors.New(errBanned), limiter.allow("10.0.8.1"))
+	assert.True(t, limiter.isBanned("10.0.8.1"))
+
+	limiter.unban("10.0.8.1")
+	assert.NoError(t, limiter.allow("10.0.8.1"))
+
+	limiter.ban("10.0.8.2")
+	assert.Equal(t, errors.New(errBanned), limiter.allow("10.0.8.2"))
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	now := time.Unix(0, 0)
+	config := ServerConfig{GlobalRate: 1, GlobalBurst: maxTrackedPeers * 2, PeerRate: 1, PeerBurst: 1}
+	limiter := newTestLimiter(config, &now)
+
+	for i := 0; i < maxTrackedPeers; i++ {
+		limiter.allow(strconv.Itoa(i))
+	}
+	assert.Equal(t, maxTrackedPeers, len(limiter.peers))
+
+	// every old peer has been idle long enough to have a full bucket again
+	now = now.Add(time.Second)
+	limiter.allow("10.0.8.1")
+	assert.Equal(t, 1, len(limiter.peers))
+}
@@ -0,0 +1,365 @@
+package kademlia
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// Resolution decides which of two versions of a Record is kept
+type Resolution string
+
+// Resolution declaration
+const (
+	// LastWriterWins keeps the record with the latest timestamp
+	LastWriterWins = Resolution("lww")
+	// HigherVersionWins keeps the record with the highest version, using
+	// the timestamp to break ties
+	HigherVersionWins = Resolution("version")
+)
+
+const (
+	errStaleRecord   string = "record is older than the stored record"
+	errDeletedValue  string = "value was deleted"
+	errBadRecordKey  string = "key does not belong to the publisher and name of the record"
+	errBadResolution string = "unknown record resolution"
+	errNoPublisher   string = "record has no publisher"
+	errNotARecord    string = "key holds an immutable value"
+	errNoValue       string = "no value stored under the key"
+	errNotOwner      string = "sender does not own the value or record"
+	errFutureRecord  string = "record timestamp is in the future"
+)
+
+// maxClockSkew how far in the future the timestamp of a record may be
+const maxClockSkew = time.Minute
+
+// Record is a versioned value. Mutable records are stored under the key
+// RecordKey(Publisher, Name) owned by their publisher. A Record with `Deleted`
+// set is a tombstone, it replaces a record or the immutable value stored under
+// its key. Tombstones of immutable values are published by the node which stored
+// the value and have no name.
+//
+// Signed records (names) carry the `PublicKey` of their publisher and a
+// `Signature`. They are stored under NameKey(PublicKey), which is also their
+// `Publisher`, and their `Version` is the sequence number of the name.
+type Record struct {
+	Publisher  string     `json:"publisher,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Value      string     `json:"value,omitempty"`
+	Version    uint64     `json:"version"`
+	Timestamp  int64      `json:"timestamp"`
+	Deleted    bool       `json:"deleted,omitempty"`
+	Resolution Resolution `json:"resolution"`
+	PublicKey  []byte     `json:"publicKey,omitempty"`
+	Signature  []byte     `json:"signature,omitempty"`
+}
+
+// RecordKey returns the key of the record `name` owned by `publisher`
+func RecordKey(publisher string, name string) string {
+	sha1 := sha1.Sum([]byte(publisher + "/" + name))
+	return hex.EncodeToString(sha1[:])
+}
+
+// wins returns true if `record` should replace the `stored` record
+func (record *Record) wins(stored *Record) bool {
+	if record.Resolution == HigherVersionWins && record.Version != stored.Version {
+		return record.Version > stored.Version
+	}
+	return record.Timestamp > stored.Timestamp
+}
+
+// deletesValue returns true if the record is a tombstone of the immutable value
+// stored under `key` rather than of a record
+func (record *Record) deletesValue(key string) bool {
+	return record.Deleted && record.PublicKey == nil && record.Name == "" &&
+		RecordKey(record.Publisher, record.Name) != key
+}
+
+// expired returns true if the record was written more than `deadline` seconds before `now`
+func (record *Record) expired(deadline int64, now time.Time) bool {
+	return time.Unix(0, record.Timestamp).Add(time.Duration(deadline) * time.Second).Before(now)
+}
+
+func validateRecord(record *Record) error {
+	if len(record.Name) > MaxKeySize {
+		return errors.New(errKeyTooLarge)
+	}
+
+	if len(record.Value) > MaxValueSize {
+		return errors.New(errValueTooLarge)
+	}
+
+	if record.Resolution != LastWriterWins && record.Resolution != HigherVersionWins {
+		return errors.New(errBadResolution)
+	}
+
+	if record.PublicKey != nil || record.Signature != nil {
+		err := validateSignedRecord(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	if time.Unix(0, record.Timestamp).After(time.Now().Add(maxClockSkew)) {
+		return errors.New(errFutureRecord)
+	}
+
+	if record.Publisher == "" {
+		return errors.New(errNoPublisher)
+	}
+
+	_, err := ParseNodeID(record.Publisher)
+	return err
+}
+
+// checkRecordKey returns an error if `record` may not be stored under `key`.
+// Signed records must also carry a valid signature.
+func checkRecordKey(key string, record *Record) error {
+	if record.PublicKey != nil {
+		return verifySignedRecord(key, record)
+	}
+
+	if !record.deletesValue(key) && RecordKey(record.Publisher, record.Name) != key {
+		return errors.New(errBadRecordKey)
+	}
+	return nil
+}
+
+// putLocalRecord stores `record` under `key` unless the stored record wins over it.
+// A tombstone of an immutable value also removes the value, unless the value was
+// stored after the tombstone was written. Only the node which stored the value may
+// delete it and a tombstone is not stored under a key holding nothing to delete.
+func (kademlia *Node) putLocalRecord(key string, record Record) error {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.records == nil {
+		kademlia.records = make(map[string]Record)
+	}
+
+	stored, exists := kademlia.records[key]
+	if exists {
+		if stored.Publisher != record.Publisher {
+			return errors.New(errBadRecordKey)
+		} else if !record.wins(&stored) {
+			return errors.New(errStaleRecord)
+		}
+	}
+
+	if record.deletesValue(key) {
+		value, hasValue := kademlia.content[key]
+		owner, hasOwner := kademlia.owners[key]
+		if !hasValue && !exists {
+			return errors.New(errNoValue)
+		} else if hasValue && (!hasOwner || !strings.EqualFold(owner.ID.String(), record.Publisher)) {
+			return errors.New(errNotOwner)
+		} else if hasValue && valueTimestamp(value) > record.Timestamp {
+			return errors.New(errStaleRecord)
+		}
+		delete(kademlia.content, key)
+		delete(kademlia.owners, key)
+	}
+
+	kademlia.records[key] = record
+	return nil
+}
+
+// setValueOwner keeps `owner` as the node which first stored the immutable value
+// or unsigned record under `key`, unless the key already has an owner
+func (kademlia *Node) setValueOwner(key string, owner Contact) {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.owners == nil {
+		kademlia.owners = make(map[string]Contact)
+	}
+	if _, exists := kademlia.owners[key]; !exists {
+		kademlia.owners[key] = owner
+	}
+}
+
+// ownedBy returns true if `key` has no owner or is owned by `contact`, the same
+// node sending from the same address. The ID of a sender is not enough since any
+// node may claim it.
+func (kademlia *Node) ownedBy(key string, contact Contact) bool {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	owner, exists := kademlia.owners[key]
+	return !exists || (owner.ID.Equals(contact.ID) && owner.Address == contact.Address)
+}
+
+// getLocalRecord returns the record stored under `key` or nil
+func (kademlia *Node) getLocalRecord(key string) *Record {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	record, exists := kademlia.records[key]
+	if !exists {
+		return nil
+	}
+	return &record
+}
+
+// deletedBefore returns true if a tombstone for `key` was written after
+// the immutable `value` was stored
+func (kademlia *Node) deletedBefore(key string, value string) bool {
+	record := kademlia.getLocalRecord(key)
+	return record != nil && record.Deleted && record.Timestamp >= valueTimestamp(value)
+}
+
+// valueTimestamp returns the time an immutable "timestamp:data" value
+// was stored in nanoseconds
+func valueTimestamp(value string) int64 {
+	seconds, _ := strconv.ParseInt(strings.SplitN(value, ":", 2)[0], 10, 64)
+	return time.Unix(seconds, 0).UnixNano()
+}
+
+// DeleteValue stores a tombstone for `hash` on the k closest nodes, removing the
+// immutable value stored under it. Returns an *RPCError with the Conflict code
+// if a node stored the value after the tombstone was written.
+func (kademlia *Node) DeleteValue(hash string) error {
+	publisher := kademlia.RT.GetMeID().String()
+	record := Record{Publisher: publisher, Timestamp: time.Now().UnixNano(), Deleted: true, Resolution: LastWriterWins}
+	return kademlia.storeRecord("DeleteValue", normalizeKey(hash), record)
+}
+
+// PutRecord publishes `value` as the next version of the record `name` owned by
+// the node. Returns the key the record is stored under.
+func (kademlia *Node) PutRecord(name string, value string, resolution Resolution) (string, *Record, error) {
+	publisher := kademlia.RT.GetMeID().String()
+	key := RecordKey(publisher, name)
+
+	record := Record{
+		Publisher:  publisher,
+		Name:       name,
+		Value:      value,
+		Version:    1,
+		Timestamp:  time.Now().UnixNano(),
+		Resolution: resolution,
+	}
+	if latest := kademlia.latestRecord(key); latest != nil {
+		record.Version = latest.Version + 1
+	}
+
+	err := validateRecord(&record)
+	if err != nil {
+		return key, nil, err
+	}
+
+	return key, &record, kademlia.storeRecord("PutRecord", key, record)
+}
+
+// DeleteRecord stores a tombstone replacing the record `name` owned by the node
+func (kademlia *Node) DeleteRecord(name string) error {
+	publisher := kademlia.RT.GetMeID().String()
+	key := RecordKey(publisher, name)
+
+	record := Record{
+		Publisher:  publisher,
+		Name:       name,
+		Version:    1,
+		Timestamp:  time.Now().UnixNano(),
+		Deleted:    true,
+		Resolution: HigherVersionWins,
+	}
+	if latest := kademlia.latestRecord(key); latest != nil {
+		record.Version = latest.Version + 1
+		record.Resolution = latest.Resolution
+	}
+
+	return kademlia.storeRecord("DeleteRecord", key, record)
+}
+
+// FindRecord finds the record stored under `key`. Returns an error if the record was deleted.
+func (kademlia *Node) FindRecord(key string) (*Record, error) {
+	_, record, err := kademlia.findValue(key, 1, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, errors.New(errNotARecord)
+	} else if record.Deleted {
+		return nil, errors.New(errDeletedValue)
+	}
+	return record, nil
+}
+
+// latestRecord returns the record stored under `key`, tombstones included, or nil
+func (kademlia *Node) latestRecord(key string) *Record {
+	_, record, _ := kademlia.findValue(key, 1, nil)
+	return record
+}
+
+// storeRecord stores `record` locally and on the k closest nodes to `key`. Returns
+// the first error a node replied with if no node stored the record.
+func (kademlia *Node) storeRecord(operation string, key string, record Record) error {
+	span := kademlia.tracer.Start(operation, tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, key)
+
+	// a node may delete values it does not store itself
+	err := kademlia.putLocalRecord(key, record)
+	if err != nil && err.Error() != errNoValue {
+		span.SetError(err)
+		return err
+	}
+
+	lookupSpan := span.Start("NodeLookup", tracing.Internal)
+	nodes := kademlia.nodeLookup(kademlia.keyID(key), lookupSpan, nil)
+	lookupSpan.End()
+
+	var firstErr error
+	stored := 0
+
+	client := kademlia.client.withSpan(span)
+	for _, node := range nodes {
+		_, err := client.SendStoreRecordMessage(&node, kademlia.RT.GetMe(), key, record)
+
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeUnresponsive(node, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			stored++
+		}
+	}
+
+	if stored == 0 && firstErr != nil {
+		span.SetError(firstErr)
+		return firstErr
+	}
+	return nil
+}
+
+// IsConflict returns true if `err` means that a newer record or value is stored,
+// either locally or on the node that replied with an *RPCError
+func IsConflict(err error) bool {
+	var rpcError *RPCError
+	if errors.As(err, &rpcError) {
+		return rpcError.Code == Conflict
+	}
+	return err != nil && errorCode(err) == Conflict
+}
+
+// IsNotFound returns true if `err` means that nothing is stored under the key,
+// either locally or on the node that replied with an *RPCError
+func IsNotFound(err error) bool {
+	var rpcError *RPCError
+	if errors.As(err, &rpcError) {
+		return rpcError.Code == NotFound
+	}
+	return err != nil && errorCode(err) == NotFound
+}
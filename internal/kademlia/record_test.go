@@ -0,0 +1,233 @@
+package kademlia
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordWins(t *testing.T) {
+	stored := Record{Version: 2, Timestamp: 100, Resolution: HigherVersionWins}
+
+	older := Record{Version: 1, Timestamp: 200, Resolution: HigherVersionWins}
+	assert.False(t, older.wins(&stored))
+
+	newer := Record{Version: 3, Timestamp: 50, Resolution: HigherVersionWins}
+	assert.True(t, newer.wins(&stored))
+
+	tie := Record{Version: 2, Timestamp: 101, Resolution: HigherVersionWins}
+	assert.True(t, tie.wins(&stored))
+
+	lww := Record{Version: 1, Timestamp: 200, Resolution: LastWriterWins}
+	assert.True(t, lww.wins(&stored))
+
+	same := stored
+	assert.False(t, same.wins(&stored))
+}
+
+func TestValidateRecord(t *testing.T) {
+	publisher := "00000000000000000000000000000000FFFFFFFF"
+
+	assert.NoError(t, validateRecord(&Record{Publisher: publisher, Name: "name", Resolution: LastWriterWins}))
+	assert.NoError(t, validateRecord(&Record{Publisher: publisher, Deleted: true, Resolution: LastWriterWins}))
+	assert.EqualError(t, validateRecord(&Record{Deleted: true, Resolution: LastWriterWins}), errNoPublisher)
+
+	future := time.Now().Add(maxClockSkew * 2).UnixNano()
+	assert.EqualError(t, validateRecord(&Record{Publisher: publisher, Timestamp: future, Resolution: LastWriterWins}), errFutureRecord)
+
+	assert.EqualError(t, validateRecord(&Record{Publisher: publisher}), errBadResolution)
+	assert.EqualError(t, validateRecord(&Record{Resolution: LastWriterWins}), errNoPublisher)
+	assert.Error(t, validateRecord(&Record{Publisher: "abcd", Resolution: LastWriterWins}))
+
+	largeValue := string(make([]byte, MaxValueSize+1))
+	assert.EqualError(t, validateRecord(&Record{Publisher: publisher, Value: largeValue, Resolution: LastWriterWins}), errValueTooLarge)
+
+	key := RecordKey(publisher, "name")
+	assert.NoError(t, checkRecordKey(key, &Record{Publisher: publisher, Name: "name"}))
+	assert.EqualError(t, checkRecordKey(key, &Record{Publisher: publisher, Name: "other"}), errBadRecordKey)
+
+	// tombstones of immutable values are not stored under the key of a record
+	assert.NoError(t, checkRecordKey("hash", &Record{Publisher: publisher, Deleted: true}))
+	assert.EqualError(t, checkRecordKey(RecordKey(publisher, ""), &Record{Publisher: publisher, Name: "other", Deleted: true}), errBadRecordKey)
+}
+
+func TestPutLocalRecord(t *testing.T) {
+	publisher := "00000000000000000000000000000000FFFFFFFF"
+	key := RecordKey(publisher, "name")
+	node := Node{content: make(map[string]string), deadline: 10}
+
+	assert.NoError(t, node.putLocalRecord(key, Record{Publisher: publisher, Name: "name", Value: "a", Version: 2, Resolution: HigherVersionWins}))
+	assert.EqualError(t, node.putLocalRecord(key, Record{Publisher: publisher, Name: "name", Value: "b", Version: 1, Resolution: HigherVersionWins}), errStaleRecord)
+	assert.Equal(t, "a", node.getLocalRecord(key).Value)
+
+	// only the publisher may replace its record
+	assert.EqualError(t, node.putLocalRecord(key, Record{Version: 3, Timestamp: 1, Deleted: true, Resolution: LastWriterWins}), errBadRecordKey)
+
+	// a tombstone removes an immutable value stored before it by its publisher
+	now := time.Now()
+	owner := "1111111100000000000000000000000000000000"
+	tombstone := Record{Publisher: owner, Timestamp: now.UnixNano(), Deleted: true, Resolution: LastWriterWins}
+	node.insertLocalStore("hash", strconv.FormatInt(now.Unix()-1, 10)+":there")
+	node.setValueOwner("hash", NewContact(NewNodeID(owner), "10.0.8.2:8080"))
+	node.setValueOwner("hash", NewContact(NewNodeID(publisher), "10.0.8.3:8080"))
+	other := tombstone
+	other.Publisher = publisher
+	assert.EqualError(t, node.putLocalRecord("hash", other), errNotOwner)
+	assert.NotNil(t, node.searchLocalStore("hash"))
+
+	assert.NoError(t, node.putLocalRecord("hash", tombstone))
+	assert.Nil(t, node.searchLocalStore("hash"))
+	assert.True(t, node.deletedBefore("hash", strconv.FormatInt(now.Unix()-1, 10)+":there"))
+	assert.False(t, node.deletedBefore("hash", strconv.FormatInt(now.Unix()+1, 10)+":there"))
+
+	// but not a value stored after it
+	node.insertLocalStore("other", strconv.FormatInt(now.Unix()+1, 10)+":there")
+	node.setValueOwner("other", NewContact(NewNodeID(owner), "10.0.8.2:8080"))
+	assert.EqualError(t, node.putLocalRecord("other", tombstone), errStaleRecord)
+
+	// keys holding nothing are not taken by tombstones
+	assert.EqualError(t, node.putLocalRecord("missing", tombstone), errNoValue)
+	assert.Nil(t, node.getLocalRecord("missing"))
+}
+
+func TestIncomingStoreRecord(t *testing.T) {
+	publisher := "1111111100000000000000000000000000000000"
+	key := RecordKey(publisher, "name")
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	record := Record{Publisher: publisher, Name: "name", Value: "a", Version: 1, Resolution: HigherVersionWins}
+	badKey := "abcd"
+	rpc, _ := NewRPC(Store, publisher, publisher, Payload{Key: &badKey, Record: &record})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadRecordKey)
+
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &key, Record: &record})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &key, Record: &record})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errStaleRecord)
+	assert.Equal(t, Conflict, errorCode(err))
+
+	// unsigned records are only accepted from their publisher
+	newer := record
+	newer.Version = 2
+	other := "2222222200000000000000000000000000000000"
+	rpc, _ = NewRPC(Store, other, other, Payload{Key: &key, Record: &newer})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.3")
+	assert.EqualError(t, err, errNotOwner)
+
+	// a node claiming the ID of the publisher from another address is rejected
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &key, Record: &newer})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.3")
+	assert.EqualError(t, err, errNotOwner)
+	assert.Equal(t, uint64(1), node.getLocalRecord(key).Version)
+
+	rpc, _ = NewRPC(FindValue, publisher, key, Payload{Key: &key})
+	reply, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, &record, reply.Payload.Record)
+
+	// only the node which stored a value may delete it
+	hash := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	value := "1000:there"
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &hash, Value: &value})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+
+	tombstone := Record{Publisher: other, Timestamp: time.Now().UnixNano(), Deleted: true, Resolution: LastWriterWins}
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &hash, Record: &tombstone})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNotOwner)
+
+	rpc, _ = NewRPC(Store, other, other, Payload{Key: &hash, Record: &tombstone})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNotOwner)
+	assert.Equal(t, &value, node.searchLocalStore(hash))
+
+	tombstone.Publisher = publisher
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &hash, Record: &tombstone})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.3")
+	assert.EqualError(t, err, errNotOwner)
+	assert.Equal(t, &value, node.searchLocalStore(hash))
+
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &hash, Record: &tombstone})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Nil(t, node.searchLocalStore(hash))
+
+	// values older than a tombstone are not stored again
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &hash, Value: &value})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errDeletedValue)
+
+	// tombstones without publisher are rejected
+	tombstone.Publisher = ""
+	rpc, _ = NewRPC(Store, publisher, publisher, Payload{Key: &hash, Record: &tombstone})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNoPublisher)
+}
+
+func TestDeleteValueConflict(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080")
+	stores := make(chan Record, 1)
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		if *message.rpc.Type == Store {
+			stores <- *message.rpc.Payload.Record
+			return Message{message.receiver, RPC{}, &RPCError{Conflict, errStaleRecord}}
+		}
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{Contacts: []Contact{}})
+		return Message{message.receiver, *reply, nil}
+	})
+
+	err := node.DeleteValue(peer.ID.String())
+	assert.True(t, IsConflict(err))
+	assert.True(t, (<-stores).Deleted)
+
+	assert.False(t, IsConflict(errors.New(errNoReply)))
+	assert.False(t, IsConflict(nil))
+
+	assert.True(t, IsNotFound(&RPCError{NotFound, errNoValue}))
+	assert.False(t, IsNotFound(err))
+}
+
+func TestPutRecordVersions(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+
+	key, record, err := node.PutRecord("name", "a", HigherVersionWins)
+	assert.NoError(t, err)
+	assert.Equal(t, RecordKey(me.ID.String(), "name"), key)
+	assert.Equal(t, uint64(1), record.Version)
+
+	_, record, err = node.PutRecord("name", "b", HigherVersionWins)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), record.Version)
+
+	found, err := node.FindRecord(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", found.Value)
+
+	value, err := node.FindValue(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", value)
+
+	assert.NoError(t, node.DeleteRecord("name"))
+	_, err = node.FindRecord(key)
+	assert.EqualError(t, err, errDeletedValue)
+	_, err = node.FindValue(key)
+	assert.EqualError(t, err, errDeletedValue)
+}
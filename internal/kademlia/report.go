@@ -0,0 +1,93 @@
+package kademlia
+
+import (
+	"time"
+)
+
+// Reasons a lookup terminated, given in the `Termination` of a LookupReport
+const (
+	TerminationLocal     string = "value found in local store"
+	TerminationValue     string = "value found"
+	TerminationNoCloser  string = "no closer contacts found"
+	TerminationKQueried  string = "k contacts queried"
+	TerminationExhausted string = "no contacts left to query"
+)
+
+// LookupReport describes every contact queried by a NodeLookup or FindValue
+// and why the lookup terminated. `Replicas` is the number of values a FindValue
+// compared and `Disagreement` is set if they were not all the same.
+type LookupReport struct {
+	Target       string        `json:"target"`
+	Queries      []LookupQuery `json:"queries"`
+	Rounds       int           `json:"rounds"`
+	Termination  string        `json:"termination"`
+	Duration     time.Duration `json:"duration"`
+	Replicas     int           `json:"replicas,omitempty"`
+	Disagreement bool          `json:"disagreement,omitempty"`
+	start        time.Time
+}
+
+// LookupQuery is a single RPC sent during a lookup to the contact with `ID` and
+// `Address`. `Distance` is the distance from the contact to the target, `RTT`
+// the time until the contact replied and `Result` what the contact returned or
+// the error it failed with.
+type LookupQuery struct {
+	Round    int           `json:"round"`
+	ID       string        `json:"id"`
+	Address  string        `json:"address"`
+	Distance string        `json:"distance"`
+	RTT      time.Duration `json:"rtt"`
+	Result   string        `json:"result"`
+}
+
+func newLookupReport(target *NodeID) *LookupReport {
+	return &LookupReport{Target: target.String(), Queries: []LookupQuery{}, start: time.Now()}
+}
+
+// add records a query to `contact` in the current round. Does nothing on a nil report.
+func (report *LookupReport) add(contact Contact, target *NodeID, rtt time.Duration, rpc *RPC, err error) {
+	if report == nil {
+		return
+	}
+
+	query := LookupQuery{
+		Round:    report.Rounds,
+		ID:       contact.ID.String(),
+		Address:  contact.Address,
+		Distance: contact.ID.CalcDistance(target).String(),
+		RTT:      rtt,
+	}
+
+	if err != nil {
+		query.Result = err.Error()
+	} else {
+		query.Result = rpc.describe()
+	}
+
+	report.Queries = append(report.Queries, query)
+}
+
+// nextRound starts a new round of queries
+func (report *LookupReport) nextRound() {
+	if report != nil {
+		report.Rounds++
+	}
+}
+
+// compare records how many replicas were compared and whether they disagreed
+func (report *LookupReport) compare(replicas int, disagreement bool) {
+	if report == nil {
+		return
+	}
+	report.Replicas = replicas
+	report.Disagreement = disagreement
+}
+
+// terminate records why the lookup terminated and how long it took
+func (report *LookupReport) terminate(reason string) {
+	if report == nil {
+		return
+	}
+	report.Termination = reason
+	report.Duration = time.Since(report.start)
+}
@@ -0,0 +1,189 @@
+package kademlia
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// newFakeClient returns a client answering every RPC with `reply` instead of sending it
+func newFakeClient(reply func(message Message) Message) Client {
+	client := Client{send: make(chan Message), resp: make(chan Message)}
+	go func() {
+		for message := range client.send {
+			client.resp <- reply(message)
+		}
+	}()
+	return client
+}
+
+func TestFindValueWithReport(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2920"), "10.0.8.2:8080")
+	key := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	value := "1600000000:there"
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{})
+		if *message.rpc.Type == FindValue {
+			reply.Payload.Value = &value
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+
+	found, report, err := node.FindValueWithReport(key)
+	assert.NoError(t, err)
+	assert.Equal(t, value, found)
+
+	assert.Equal(t, key, report.Target)
+	assert.Equal(t, TerminationValue, report.Termination)
+	assert.Equal(t, 1, report.Rounds)
+	assert.Equal(t, 1, len(report.Queries))
+	assert.Equal(t, 1, report.Queries[0].Round)
+	assert.Equal(t, peer.ID.String(), report.Queries[0].ID)
+	assert.Equal(t, "0000000000000000000000000000000000000001", report.Queries[0].Distance)
+	assert.Equal(t, "value", report.Queries[0].Result)
+
+	node.insertLocalStore(key, value)
+	_, report, err = node.FindValueWithReport(key)
+	assert.NoError(t, err)
+	assert.Equal(t, TerminationLocal, report.Termination)
+	assert.Equal(t, 0, len(report.Queries))
+}
+
+func TestNodeLookupWithReportUnresponsive(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080")
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		return Message{message.receiver, RPC{}, errors.New(errNoReply)}
+	})
+
+	contacts, report := node.NodeLookupWithReport(peer.ID)
+	assert.Equal(t, 0, len(contacts))
+	assert.Equal(t, TerminationExhausted, report.Termination)
+	assert.Equal(t, 1, len(report.Queries))
+	assert.Equal(t, errNoReply, report.Queries[0].Result)
+	assert.Equal(t, "0000000000000000000000000000000000000000", report.Queries[0].Distance)
+}
+
+func TestNilLookupReport(t *testing.T) {
+	var report *LookupReport
+
+	assert.NotPanics(t, func() {
+		report.nextRound()
+		report.add(NewContact(NewRandomNodeID(), ""), NewRandomNodeID(), 0, nil, errors.New(errNoReply))
+		report.terminate(TerminationNoCloser)
+	})
+}
+
+func TestFindValueQuorum(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	publisher := "1111111100000000000000000000000000000000"
+	key := RecordKey(publisher, "name")
+	versions := map[string]uint64{"10.0.8.2:8080": 1, "10.0.8.3:8080": 2, "10.0.8.4:8080": 2}
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(NewContact(NewNodeID("1111111100000000000000000000000000000002"), "10.0.8.2:8080"))
+	node.RT.AddContact(NewContact(NewNodeID("1111111100000000000000000000000000000003"), "10.0.8.3:8080"))
+	node.RT.AddContact(NewContact(NewNodeID("1111111100000000000000000000000000000004"), "10.0.8.4:8080"))
+	node.client = newFakeClient(func(message Message) Message {
+		record := Record{Publisher: publisher, Name: "name", Value: "v", Resolution: HigherVersionWins}
+		record.Version = versions[message.receiver.Address]
+		reply, _ := NewRPC(OK, message.receiver.ID.String(), me.ID.String(), Payload{Record: &record})
+		return Message{message.receiver, *reply, nil}
+	})
+
+	_, report, err := node.FindValueQuorum(key, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(report.Queries))
+	assert.Equal(t, 3, report.Replicas)
+	assert.True(t, report.Disagreement)
+
+	// the record with the highest version is returned
+	_, found, _ := node.findValue(key, 3, nil)
+	assert.Equal(t, uint64(2), found.Version)
+
+	versions["10.0.8.2:8080"] = 2
+	_, report, err = node.FindValueQuorum(key, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Replicas)
+	assert.False(t, report.Disagreement)
+
+	// a quorum which cannot be met returns the best of the replicas found
+	_, report, err = node.FindValueQuorum(key, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Replicas)
+	assert.NotEqual(t, TerminationValue, report.Termination)
+}
+
+// newMultiHopNode returns a node knowing only the first of four peers, each of
+// which knows the next ones closer to key 490528f36debf7c15cea5e9a9d1ea024cf6b2921.
+// The two closest peers store `value` under the key.
+func newMultiHopNode(value string) (*Node, []Contact) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peers := []Contact{
+		NewContact(NewNodeID("c90528f36debf7c15cea5e9a9d1ea024cf6b2921"), "10.0.8.2:8080"),
+		NewContact(NewNodeID("090528f36debf7c15cea5e9a9d1ea024cf6b2921"), "10.0.8.3:8080"),
+		NewContact(NewNodeID("410528f36debf7c15cea5e9a9d1ea024cf6b2921"), "10.0.8.4:8080"),
+		NewContact(NewNodeID("480528f36debf7c15cea5e9a9d1ea024cf6b2921"), "10.0.8.5:8080"),
+	}
+	known := map[string][]Contact{
+		peers[0].Address: {me, peers[1]},
+		peers[1].Address: {peers[2], peers[3]},
+	}
+
+	node := &Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peers[0])
+	node.client = newFakeClient(func(message Message) Message {
+		reply, _ := NewRPC(OK, message.receiver.ID.String(), me.ID.String(), Payload{Contacts: known[message.receiver.Address]})
+		if *message.rpc.Type == FindValue && known[message.receiver.Address] == nil {
+			reply.Payload.Value = &value
+		}
+		return Message{message.receiver, *reply, nil}
+	})
+	return node, peers
+}
+
+func TestNodeLookupWithReportRounds(t *testing.T) {
+	node, peers := newMultiHopNode("1600000000:there")
+	exporter := &recordingExporter{}
+	node.SetTracer(tracing.NewTracer("kademlia", "node1", exporter))
+
+	contacts, report := node.NodeLookupWithReport(NewNodeID("490528f36debf7c15cea5e9a9d1ea024cf6b2921"))
+	assert.Equal(t, 4, len(contacts))
+	assert.Equal(t, peers[3].ID, contacts[0].ID)
+	assert.Equal(t, 3, report.Rounds)
+	assert.Equal(t, 3, len(report.Queries))
+	assert.Equal(t, 3, report.Queries[2].Round)
+	assert.Equal(t, TerminationNoCloser, report.Termination)
+
+	// the lookup counts its rounds as hops
+	lookup := exporter.spans[len(exporter.spans)-1]
+	assert.Equal(t, "NodeLookup", lookup.Name)
+	assert.Equal(t, "3", lookup.Attributes[attrHops])
+}
+
+func TestFindValueQuorumBeyondFirstRound(t *testing.T) {
+	value := "1600000000:there"
+	node, peers := newMultiHopNode(value)
+
+	found, report, err := node.FindValueQuorum("490528f36debf7c15cea5e9a9d1ea024cf6b2921", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, value, found)
+	assert.Equal(t, 2, report.Replicas)
+	assert.Equal(t, 3, report.Rounds)
+	assert.Equal(t, TerminationValue, report.Termination)
+	assert.Equal(t, peers[2].ID.String(), report.Queries[2].ID)
+	assert.Equal(t, peers[3].ID.String(), report.Queries[3].ID)
+}
@@ -1,82 +1,290 @@
 package kademlia
 
-// RoutingTable definition
-// keeps a refrence contact of me and an array of buckets
-type RoutingTable struct {
-	me      Contact
-	buckets [IDLength * 8]*bucket
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Routing table kinds
+const (
+	BucketRoutingTable string = "buckets"
+	TreeRoutingTable   string = "tree"
+)
+
+// EnvRoutingTable is the environment variable choosing the kind of routing
+// table of the node, either "buckets" or "tree"
+const EnvRoutingTable string = "KADEMLIA_ROUTING_TABLE"
+
+const errUnknownRoutingTable string = "unknown routing table kind"
+
+// RoutingTable keeps the contacts a node knows of, in k-buckets covering
+// ranges of the ID space
+type RoutingTable interface {
+	// AddContact adds `contact` to its bucket if there is space for it
+	AddContact(contact Contact)
+	// RemoveContact removes a dead contact from its bucket
+	RemoveContact(contact Contact)
+	// Penalize removes a misbehaving contact and keeps it from being added again for `duration`
+	Penalize(contact Contact, duration time.Duration)
+	// Contains returns true if `contact` is in its bucket
+	Contains(contact Contact) bool
+	// FindClosestContacts finds the `count` closest contacts to `target`
+	FindClosestContacts(target *NodeID, count int) []Contact
+	// Buckets returns the contacts of every non empty bucket
+	Buckets() []BucketInfo
+	// BucketSizes returns the number of contacts in each bucket
+	BucketSizes() []int
+	GetMe() *Contact
+	GetMeID() *NodeID
+	// Bits returns the number of bits in the IDs of the routing table
+	Bits() int
+
+	// evictionCandidate returns the contact to ping before `contact` can be
+	// added, or nil if there is space for it
+	evictionCandidate(contact Contact) *Contact
+}
+
+// NewRoutingTableOfKind returns a new instance of the routing table `kind` for `me`
+func NewRoutingTableOfKind(kind string, me Contact) (RoutingTable, error) {
+	switch kind {
+	case "", BucketRoutingTable:
+		return NewRoutingTable(me), nil
+	case TreeRoutingTable:
+		return NewTreeRoutingTable(me), nil
+	}
+	return nil, errors.New(errUnknownRoutingTable)
+}
+
+// SetRoutingTable sets the kind of routing table the node gets when it is
+// initialized. Returns an error unless `kind` is "buckets" or "tree".
+func (kademlia *Node) SetRoutingTable(kind string) error {
+	_, err := NewRoutingTableOfKind(kind, NewContact(NewRandomNodeID(), ""))
+	if err != nil {
+		return err
+	}
+
+	kademlia.routingTable = kind
+	return nil
+}
+
+// RoutingTableKind returns the kind of routing table of the node, "buckets" by default
+func (kademlia *Node) RoutingTableKind() string {
+	if kademlia.routingTable == "" {
+		return BucketRoutingTable
+	}
+	return kademlia.routingTable
+}
+
+// BucketTable definition
+// keeps a refrence contact of me and a bucket for every bit of its ID
+// and the time until which penalized contacts are not added again
+type BucketTable struct {
+	me        Contact
+	buckets   []*bucket
+	penalties penalties
+	mutex     sync.RWMutex
 }
 
-// NewRoutingTable returns a new instance of a RoutingTable
-func NewRoutingTable(me Contact) *RoutingTable {
-	routingTable := &RoutingTable{}
-	for i := 0; i < IDLength*8; i++ {
+// NewRoutingTable returns a new instance of a BucketTable for IDs as wide as the ID of `me`
+func NewRoutingTable(me Contact) *BucketTable {
+	routingTable := &BucketTable{buckets: make([]*bucket, me.ID.Bits())}
+	for i := range routingTable.buckets {
 		routingTable.buckets[i] = newBucket()
 	}
 	routingTable.me = me
+	routingTable.penalties = make(penalties)
 	return routingTable
 }
 
 // AddContact add a new contact to the correct Bucket
-func (routingTable *RoutingTable) AddContact(contact Contact) {
+// unless the contact is penalized or its ID has another width
+func (routingTable *BucketTable) AddContact(contact Contact) {
+	routingTable.mutex.Lock()
+	defer routingTable.mutex.Unlock()
+
+	if contact.ID.Len() != routingTable.me.ID.Len() || routingTable.penalties.blocks(contact.ID) {
+		return
+	}
+
 	bucketIndex := routingTable.getBucketIndex(contact.ID)
 	bucket := routingTable.buckets[bucketIndex]
 	bucket.AddContact(contact)
 }
 
 // RemoveContact remove a dead contact from its Bucket
-func (routingTable *RoutingTable) RemoveContact(contact Contact) {
+func (routingTable *BucketTable) RemoveContact(contact Contact) {
+	routingTable.mutex.Lock()
+	defer routingTable.mutex.Unlock()
+
 	bucketIndex := routingTable.getBucketIndex(contact.ID)
 	bucket := routingTable.buckets[bucketIndex]
 	bucket.RemoveContact(contact)
 }
 
-// FindClosestContacts finds the count closest Contacts to the target in the RoutingTable
-func (routingTable *RoutingTable) FindClosestContacts(target *NodeID, count int) []Contact {
-	var candidates ContactCandidates
-	bucketIndex := routingTable.getBucketIndex(target)
-	bucket := routingTable.buckets[bucketIndex]
+// Penalize removes a misbehaving contact from its Bucket and keeps
+// it from being added again for `duration`
+func (routingTable *BucketTable) Penalize(contact Contact, duration time.Duration) {
+	routingTable.mutex.Lock()
+	defer routingTable.mutex.Unlock()
+
+	routingTable.penalties[*contact.ID] = time.Now().Add(duration)
+	bucketIndex := routingTable.getBucketIndex(contact.ID)
+	routingTable.buckets[bucketIndex].RemoveContact(contact)
+}
 
-	candidates.Append(bucket.GetContactAndCalcDistance(target))
+// Contains returns true if the contact is in its Bucket
+func (routingTable *BucketTable) Contains(contact Contact) bool {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
 
-	for i := 1; (bucketIndex-i >= 0 || bucketIndex+i < IDLength*8) && candidates.Len() < count; i++ {
-		if bucketIndex-i >= 0 {
-			bucket = routingTable.buckets[bucketIndex-i]
-			candidates.Append(bucket.GetContactAndCalcDistance(target))
-		}
-		if bucketIndex+i < IDLength*8 {
-			bucket = routingTable.buckets[bucketIndex+i]
-			candidates.Append(bucket.GetContactAndCalcDistance(target))
+	return routingTable.buckets[routingTable.getBucketIndex(contact.ID)].Contains(contact)
+}
+
+func (routingTable *BucketTable) evictionCandidate(contact Contact) *Contact {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	bucket := routingTable.buckets[routingTable.getBucketIndex(contact.ID)]
+	if bucket.Len() < BucketSize || bucket.Contains(contact) {
+		return nil
+	}
+	return bucket.GetFirst()
+}
+
+// FindClosestContacts finds the count closest Contacts to the target in the RoutingTable.
+// A contact in bucket i differs from the node in bit i, so if the target first
+// differs from the node in bit j, the contacts of bucket j are closest, followed
+// by those of every bucket after j, which first differ from the target in bit j,
+// and then by the buckets before j in decreasing order.
+func (routingTable *BucketTable) FindClosestContacts(target *NodeID, count int) []Contact {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	var contacts []Contact
+	targetIndex := routingTable.me.ID.CalcDistance(target).leadingZeros()
+
+	var candidates ContactCandidates
+	if targetIndex < len(routingTable.buckets) {
+		candidates.Append(routingTable.buckets[targetIndex].GetContactAndCalcDistance(target))
+		contacts = appendClosest(contacts, candidates, count)
+
+		candidates = ContactCandidates{}
+		for i := targetIndex + 1; i < len(routingTable.buckets) && len(contacts) < count; i++ {
+			candidates.Append(routingTable.buckets[i].GetContactAndCalcDistance(target))
 		}
+		contacts = appendClosest(contacts, candidates, count)
 	}
 
-	candidates.Sort()
+	for i := targetIndex - 1; i >= 0 && len(contacts) < count; i-- {
+		candidates = ContactCandidates{routingTable.buckets[i].GetContactAndCalcDistance(target)}
+		contacts = appendClosest(contacts, candidates, count)
+	}
+
+	return contacts
+}
 
-	if count > candidates.Len() {
-		count = candidates.Len()
+// appendClosest sorts `candidates` and appends them to `contacts` until there are `count` contacts
+func appendClosest(contacts []Contact, candidates ContactCandidates, count int) []Contact {
+	if len(contacts) >= count {
+		return contacts
 	}
 
-	return candidates.GetContacts(count)
+	candidates.Sort()
+	if count-len(contacts) < candidates.Len() {
+		return append(contacts, candidates.GetContacts(count-len(contacts))...)
+	}
+	return append(contacts, candidates.contacts...)
 }
 
 // getBucketIndex get the correct Bucket index for the KademliaID
-func (routingTable *RoutingTable) getBucketIndex(id *NodeID) int {
-	distance := id.CalcDistance(routingTable.me.ID)
-	for i := 0; i < IDLength; i++ {
-		for j := 0; j < 8; j++ {
-			if (distance[i]>>uint8(7-j))&0x1 != 0 {
-				return i*8 + j
-			}
+func (routingTable *BucketTable) getBucketIndex(id *NodeID) int {
+	index := routingTable.me.ID.CalcDistance(id).leadingZeros()
+	if index >= len(routingTable.buckets) {
+		return len(routingTable.buckets) - 1
+	}
+	return index
+}
+
+// BucketInfo describes a non empty bucket of the routing table. `Prefix` is
+// set by tree routing tables to the bits shared by the IDs in the bucket.
+type BucketInfo struct {
+	Index    int           `json:"index"`
+	Contacts []ContactInfo `json:"contacts"`
+	Prefix   string        `json:"prefix,omitempty"`
+}
+
+// ContactInfo describes a contact in a bucket and when it was last seen
+type ContactInfo struct {
+	ID       string    `json:"id"`
+	Address  string    `json:"address"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// newBucketInfo describes the contacts of `bucket` in the order they are kept in the bucket
+func newBucketInfo(index int, prefix string, bucket *bucket) BucketInfo {
+	info := BucketInfo{index, []ContactInfo{}, prefix}
+	for e := bucket.list.Front(); e != nil; e = e.Next() {
+		contact := e.Value.(Contact)
+		info.Contacts = append(info.Contacts, ContactInfo{contact.ID.String(), contact.Address, bucket.LastSeen(contact.ID)})
+	}
+	return info
+}
+
+// Buckets returns the contacts of every non empty bucket in the order
+// they are kept in the bucket
+func (routingTable *BucketTable) Buckets() []BucketInfo {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	buckets := []BucketInfo{}
+	for i, bucket := range routingTable.buckets {
+		if bucket.Len() == 0 {
+			continue
 		}
+		buckets = append(buckets, newBucketInfo(i, "", bucket))
 	}
+	return buckets
+}
+
+// BucketSizes returns the number of contacts in each bucket
+func (routingTable *BucketTable) BucketSizes() []int {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
 
-	return IDLength*8 - 1
+	sizes := make([]int, len(routingTable.buckets))
+	for i, bucket := range routingTable.buckets {
+		sizes[i] = bucket.Len()
+	}
+	return sizes
 }
 
-func (routingTable *RoutingTable) GetMe() *Contact {
+func (routingTable *BucketTable) GetMe() *Contact {
 	return &routingTable.me
 }
 
-func (routingTable *RoutingTable) GetMeID() *NodeID {
+func (routingTable *BucketTable) GetMeID() *NodeID {
 	return routingTable.me.ID
 }
+
+// Bits returns the number of bits in the IDs of the routing table
+func (routingTable *BucketTable) Bits() int {
+	return routingTable.me.ID.Bits()
+}
+
+// penalties keeps the time until which penalized contacts are not added again
+type penalties map[NodeID]time.Time
+
+// blocks returns true if the contact with `id` is still penalized, forgetting
+// penalties which are over
+func (penalties penalties) blocks(id *NodeID) bool {
+	until, exists := penalties[*id]
+	if !exists {
+		return false
+	} else if time.Now().Before(until) {
+		return true
+	}
+
+	delete(penalties, *id)
+	return false
+}
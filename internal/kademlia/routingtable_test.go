@@ -1,6 +1,9 @@
 package kademlia
 
 import (
+	"math/rand"
+	"runtime"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -104,3 +107,208 @@ func TestGetMe(t *testing.T) {
 	assert.Equal(t, c1, *rt.GetMe())
 	assert.Equal(t, c1.ID, rt.GetMeID())
 }
+
+func TestWideRoutingTable(t *testing.T) {
+	me := NewContact(NewNodeIDWithWidth("FFFFFFFF", MaxIDLength*8), "localhost:8000")
+	rt := NewRoutingTable(me)
+	assert.Equal(t, MaxIDLength*8, len(rt.buckets))
+	assert.Equal(t, MaxIDLength*8, rt.Bits())
+
+	far := NewContact(NewNodeIDWithWidth("0F", MaxIDLength*8), "localhost:8001")
+	near := NewContact(NewNodeIDWithWidth("FFFFFFFF00000000000000000000000000000000000000000000000000000001", MaxIDLength*8), "localhost:8002")
+	rt.AddContact(far)
+	rt.AddContact(near)
+	assert.Equal(t, 0, rt.getBucketIndex(far.ID))
+	assert.Equal(t, MaxIDLength*8-1, rt.getBucketIndex(near.ID))
+
+	// contacts with IDs of another width are not added
+	rt.AddContact(NewContact(NewNodeID("1111111100000000000000000000000000000000"), "localhost:8003"))
+
+	contacts := rt.FindClosestContacts(NewRandomNodeIDWithWidth(MaxIDLength*8), 10)
+	assert.Equal(t, 2, len(contacts))
+}
+
+// randomContact returns a contact with an ID `bits` wide drawn from `random`
+func randomContact(random *rand.Rand, bits int) Contact {
+	id := NodeID{length: uint8(bits / 8)}
+	random.Read(id.bytes[:id.Len()])
+	return NewContact(&id, "localhost:8001")
+}
+
+// bruteForceClosest returns the `count` contacts of `routingTable` closest to
+// `target` by sorting every contact in the table
+func bruteForceClosest(routingTable RoutingTable, target *NodeID, count int) []Contact {
+	contacts := []Contact{}
+	for _, bucket := range routingTable.Buckets() {
+		for _, info := range bucket.Contacts {
+			contact := NewContact(NewNodeID(info.ID), info.Address)
+			contact.CalcDistance(target)
+			contacts = append(contacts, contact)
+		}
+	}
+
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].Less(&contacts[j]) })
+	if count < len(contacts) {
+		contacts = contacts[:count]
+	}
+	return contacts
+}
+
+// fullContacts returns BucketSize random contacts for each bucket of a table of
+// the node `me`, the contacts of bucket i differing from `me` first in bit i
+func fullContacts(random *rand.Rand, me *NodeID) []Contact {
+	contacts := []Contact{}
+	for i := 0; i < me.Bits(); i++ {
+		for j := 0; j < BucketSize; j++ {
+			contact := randomContact(random, me.Bits())
+			for bit := 0; bit <= i; bit++ {
+				contact.ID.setBit(bit, me.bit(bit))
+			}
+			contact.ID.setBit(i, 1-me.bit(i))
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts
+}
+
+func TestFindClosestContactsProperty(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tables := map[string]func(me Contact) RoutingTable{BucketRoutingTable: newBucketTable, TreeRoutingTable: newTreeTable}
+
+	for kind, newTable := range tables {
+		for _, bits := range []int{IDLength * 8, MaxIDLength * 8} {
+			for round := 0; round < 10; round++ {
+				rt := newTable(randomContact(random, bits))
+
+				// random tables of random contacts, and of contacts filling every bucket
+				if round%2 == 0 {
+					for i := 0; i < random.Intn(2000); i++ {
+						rt.AddContact(randomContact(random, bits))
+					}
+				} else {
+					for _, contact := range fullContacts(random, rt.GetMeID()) {
+						rt.AddContact(contact)
+					}
+				}
+
+				targets := []*NodeID{rt.GetMeID()}
+				for i := 0; i < 50; i++ {
+					targets = append(targets, randomContact(random, bits).ID)
+				}
+				if buckets := rt.Buckets(); len(buckets) > 0 {
+					targets = append(targets, NewNodeID(buckets[0].Contacts[0].ID))
+				}
+
+				for _, target := range targets {
+					count := 1 + random.Intn(4*BucketSize)
+					expected := bruteForceClosest(rt, target, count)
+					found := rt.FindClosestContacts(target, count)
+
+					assert.Equal(t, len(expected), len(found), kind)
+					for i := range expected {
+						assert.True(t, expected[i].ID.Equals(found[i].ID), "%s table of %d bits: contact %d of %d closest to %s", kind, bits, i, count, target)
+					}
+				}
+			}
+		}
+	}
+}
+
+func benchmarkAddContacts(b *testing.B, newTable func(me Contact) RoutingTable, count int) {
+	random := rand.New(rand.NewSource(1))
+	contacts := make([]Contact, count)
+	for i := range contacts {
+		contacts[i] = randomContact(random, IDLength*8)
+	}
+	me := randomContact(random, IDLength*8)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rt := newTable(me)
+		for _, contact := range contacts {
+			rt.AddContact(contact)
+		}
+	}
+	b.StopTimer()
+
+	// the heap kept by a full table, without the garbage made while filling it
+	var before, after runtime.MemStats
+	tables := make([]RoutingTable, 10)
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := range tables {
+		tables[i] = newTable(me)
+		for _, contact := range contacts {
+			tables[i].AddContact(contact)
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(len(tables)), "B/table")
+	runtime.KeepAlive(tables)
+}
+
+func benchmarkFindClosestContacts(b *testing.B, newTable func(me Contact) RoutingTable, count int) {
+	random := rand.New(rand.NewSource(1))
+	rt := newTable(randomContact(random, IDLength*8))
+	for i := 0; i < count; i++ {
+		rt.AddContact(randomContact(random, IDLength*8))
+	}
+	benchmarkQueries(b, rt, random)
+}
+
+// benchmarkFullFindClosestContacts queries a table with a full bucket for every bit of its IDs
+func benchmarkFullFindClosestContacts(b *testing.B, newTable func(me Contact) RoutingTable, bits int) {
+	random := rand.New(rand.NewSource(1))
+	rt := newTable(randomContact(random, bits))
+	for _, contact := range fullContacts(random, rt.GetMeID()) {
+		rt.AddContact(contact)
+	}
+	benchmarkQueries(b, rt, random)
+}
+
+func benchmarkQueries(b *testing.B, rt RoutingTable, random *rand.Rand) {
+	targets := make([]*NodeID, 1000)
+	for i := range targets {
+		targets[i] = randomContact(random, rt.Bits()).ID
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rt.FindClosestContacts(targets[i%len(targets)], BucketSize)
+	}
+}
+
+func newBucketTable(me Contact) RoutingTable { return NewRoutingTable(me) }
+func newTreeTable(me Contact) RoutingTable   { return NewTreeRoutingTable(me) }
+
+func BenchmarkBucketTableAdd(b *testing.B) { benchmarkAddContacts(b, newBucketTable, 1000) }
+func BenchmarkTreeTableAdd(b *testing.B)   { benchmarkAddContacts(b, newTreeTable, 1000) }
+
+func BenchmarkBucketTableFindClosestContacts(b *testing.B) {
+	benchmarkFindClosestContacts(b, newBucketTable, 1000)
+}
+
+func BenchmarkTreeTableFindClosestContacts(b *testing.B) {
+	benchmarkFindClosestContacts(b, newTreeTable, 1000)
+}
+
+// 800 contacts
+func BenchmarkBucketTableFull160(b *testing.B) {
+	benchmarkFullFindClosestContacts(b, newBucketTable, IDLength*8)
+}
+
+func BenchmarkTreeTableFull160(b *testing.B) {
+	benchmarkFullFindClosestContacts(b, newTreeTable, IDLength*8)
+}
+
+// 1280 contacts
+func BenchmarkBucketTableFull256(b *testing.B) {
+	benchmarkFullFindClosestContacts(b, newBucketTable, MaxIDLength*8)
+}
+
+func BenchmarkTreeTableFull256(b *testing.B) {
+	benchmarkFullFindClosestContacts(b, newTreeTable, MaxIDLength*8)
+}
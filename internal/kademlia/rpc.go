@@ -1,9 +1,14 @@
 package kademlia
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
 	"github.com/viktorfrom/d7024e-kademlia/pkg/randarr"
 )
 
@@ -12,35 +17,109 @@ type RPCType string
 
 // RPC type declaration
 const (
-	Ping      = RPCType("PING")
-	Store     = RPCType("STORE")
-	FindValue = RPCType("FIND_VALUE")
-	FindNode  = RPCType("FIND_NODE")
-	OK        = RPCType("OK")
+	Ping         = RPCType("PING")
+	Store        = RPCType("STORE")
+	FindValue    = RPCType("FIND_VALUE")
+	FindNode     = RPCType("FIND_NODE")
+	FindRange    = RPCType("FIND_RANGE")
+	AddProvider  = RPCType("ADD_PROVIDER")
+	GetProviders = RPCType("GET_PROVIDERS")
+	Subscribe    = RPCType("SUBSCRIBE")
+	Publish      = RPCType("PUBLISH")
+	AddWatcher   = RPCType("ADD_WATCHER")
+	Notify       = RPCType("NOTIFY")
+	OK           = RPCType("OK")
+	Error        = RPCType("ERROR")
+)
+
+// ErrorCode type definition
+type ErrorCode string
+
+// ErrorCode declaration, sent in the `Error` of an ERROR RPC
+const (
+	BadRequest    = ErrorCode("BAD_REQUEST")
+	ValueTooLarge = ErrorCode("VALUE_TOO_LARGE")
+	NotFound      = ErrorCode("NOT_FOUND")
+	Conflict      = ErrorCode("CONFLICT")
+	Unsupported   = ErrorCode("UNSUPPORTED")
 )
 
 const (
-	errWrongType = "unexpected rpc type given"
+	// RPCIDLength the number of bytes in the random ID of an RPC
+	RPCIDLength int = 20
+	// MaxKeySize the largest key in bytes accepted in an RPC
+	MaxKeySize int = 128
+	// MaxValueSize the largest value in bytes accepted in an RPC
+	MaxValueSize int = 512
+	// MaxContacts the largest number of contacts accepted in an RPC
+	MaxContacts int = BucketSize
 )
 
-var rpcTypes = []RPCType{Ping, Store, FindValue, FindNode, OK}
+const (
+	errWrongType       = "unexpected rpc type given"
+	errNoRPCType       = "no RPC type given"
+	errNoRPCID         = "no RPC ID given"
+	errBadRPCID        = "RPC ID is not a valid hex ID"
+	errKeyTooLarge     = "key is too large"
+	errValueTooLarge   = "value is too large"
+	errTooManyContacts = "too many contacts given"
+	errBadContact      = "contact has no ID or a bad address"
+	errNoRPCError      = "no error given in ERROR RPC"
+	errBadTrace        = "trace context is not valid"
+	errBadTTL          = "cache TTL must be positive"
+)
+
+var rpcTypes = []RPCType{Ping, Store, FindValue, FindNode, FindRange, AddProvider, GetProviders, Subscribe, Publish, AddWatcher, Notify, OK, Error}
 
 // RPC contains the `Type` of the RPC, the `Payload` (data). A quasi random `ID` for
 // that RPC. `SenderID` which is the NodeID of the node who originally sent it.
-// `TargetID` is the NodeID we're looking for.
+// `TargetID` is the NodeID we're looking for. `Error` is only set in ERROR RPCs.
+// `Trace` is set when the RPC is sent as part of a traced operation.
 type RPC struct {
-	Type     *RPCType `json:"type"`
-	Payload  *Payload `json:"payload"`
-	ID       *string  `json:"id"`
-	SenderID *string  `json:"senderID"`
-	TargetID *string  `json:"targetID"`
+	Type     *RPCType             `json:"type"`
+	Payload  *Payload             `json:"payload"`
+	ID       *string              `json:"id"`
+	SenderID *string              `json:"senderID"`
+	TargetID *string              `json:"targetID"`
+	Error    *RPCError            `json:"error,omitempty"`
+	Trace    *tracing.SpanContext `json:"trace,omitempty"`
+}
+
+// RPCError is sent back in an ERROR RPC when a node fails to handle an RPC.
+// It is returned as the error of the Client.Send* methods.
+type RPCError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// Error returns a simple string representation of an RPCError
+func (rpcError *RPCError) Error() string {
+	return fmt.Sprintf("%s: %s", rpcError.Code, rpcError.Message)
 }
 
 // Payload contains the data sent in RPCs. Can contain a value and/or a list of contacts.
+// `Record` is set instead of `Value` when storing or returning a versioned Record.
+// `TTL` is set in STORE RPCs caching a value found by a lookup for that many seconds.
+// `Range` is set in FIND_RANGE RPCs and their replies.
+// `Providers` is set in ADD_PROVIDER RPCs and replies to GET_PROVIDERS RPCs, in
+// ADD_PROVIDER RPCs `TTL` is the number of seconds the provider is kept. SUBSCRIBE
+// RPCs carry the topic `Key` and the `TTL` of the subscription, PUBLISH RPCs the
+// topic `Key` and the message as `Value` and their replies the subscribers as `Providers`,
+// with `Range.More` set if more follow. PUBLISH RPCs with a `Range` and no message ask
+// for the subscribers after `Range.After`.
+// ADD_WATCHER RPCs carry the watched `Key` and the `TTL` of the watch, NOTIFY RPCs the
+// `Event` which happened to the `Key` and the stored `Value` if there is one.
+// `Entries` is set instead of `Key` in STORE and FIND_VALUE RPCs for several keys.
 type Payload struct {
-	Key      *string   `json:"key"`
-	Value    *string   `json:"value"`
-	Contacts []Contact `json:"contacts"`
+	Key       *string      `json:"key"`
+	Value     *string      `json:"value"`
+	Contacts  []Contact    `json:"contacts"`
+	Record    *Record      `json:"record,omitempty"`
+	TTL       *int64       `json:"ttl,omitempty"`
+	Range     *RangeQuery  `json:"range,omitempty"`
+	Providers []Contact    `json:"providers,omitempty"`
+	Event     *EventKind   `json:"event,omitempty"`
+	Entries   []BatchEntry `json:"entries,omitempty"`
 }
 
 // NewRPC creates a new RPC with a random ID added to it. `rpc` is the type of the RPC,
@@ -52,13 +131,44 @@ func NewRPC(rpc RPCType, senderID string, targetID string, payload Payload) (*RP
 		return nil, err
 	}
 
-	randomStr := randarr.RandomHexString(20)
+	randomStr := randarr.RandomHexString(RPCIDLength)
 	randomID := string(randomStr)
-	newRPC := RPC{&rpc, &payload, &randomID, &senderID, &targetID}
+	newRPC := RPC{&rpc, &payload, &randomID, &senderID, &targetID, nil, nil}
 
 	return &newRPC, nil
 }
 
+// NewErrorRPC creates an ERROR RPC replying to `rpc`. The reply keeps the ID
+// of `rpc` so that the requester can match it. `senderID` is the NodeID of the
+// node who failed to handle `rpc`.
+func NewErrorRPC(rpc *RPC, senderID string, code ErrorCode, message string) *RPC {
+	errorType := Error
+	reply := RPC{&errorType, nil, nil, &senderID, nil, &RPCError{code, message}, nil}
+
+	if rpc != nil {
+		reply.ID = rpc.ID
+		reply.TargetID = rpc.SenderID
+	}
+
+	return &reply
+}
+
+// errorCode returns the ErrorCode describing why an RPC failed with `err`
+func errorCode(err error) ErrorCode {
+	switch err.Error() {
+	case errValueTooLarge:
+		return ValueTooLarge
+	case errInvalidRPCType, errWrongType:
+		return Unsupported
+	case errStaleRecord, errDeletedValue:
+		return Conflict
+	case errNoValue, errValueNotFound, errUnknownNameKey:
+		return NotFound
+	default:
+		return BadRequest
+	}
+}
+
 func validateRPCType(rpc RPCType) error {
 	for _, rpcType := range rpcTypes {
 		if rpcType == rpc {
@@ -68,6 +178,146 @@ func validateRPCType(rpc RPCType) error {
 	return errors.New(errWrongType)
 }
 
+// ValidateRPC checks every field of an RPC received from another node. Returns an
+// error if a required field is missing, an ID is not hex encoded with the correct
+// length or the payload exceeds the size limits.
+func ValidateRPC(rpc *RPC) error {
+	if rpc == nil {
+		return errors.New(errNilRPC)
+	}
+
+	if rpc.Type == nil {
+		return errors.New(errNoRPCType)
+	}
+
+	err := validateRPCType(*rpc.Type)
+	if err != nil {
+		return err
+	}
+
+	if rpc.ID == nil {
+		return errors.New(errNoRPCID)
+	}
+
+	id, err := hex.DecodeString(*rpc.ID)
+	if err != nil || len(id) != RPCIDLength {
+		return errors.New(errBadRPCID)
+	}
+
+	if rpc.SenderID == nil {
+		return errors.New(errNoID)
+	}
+
+	_, err = ParseNodeID(*rpc.SenderID)
+	if err != nil {
+		return err
+	}
+
+	if rpc.TargetID != nil {
+		_, err = ParseNodeID(*rpc.TargetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *rpc.Type == Error && rpc.Error == nil {
+		return errors.New(errNoRPCError)
+	}
+
+	if rpc.Trace != nil && !rpc.Trace.Valid() {
+		return errors.New(errBadTrace)
+	}
+
+	return validatePayload(rpc.Payload)
+}
+
+func validatePayload(payload *Payload) error {
+	if payload == nil {
+		return nil
+	}
+
+	if payload.Key != nil && len(*payload.Key) > MaxKeySize {
+		return errors.New(errKeyTooLarge)
+	}
+
+	if payload.Value != nil && len(*payload.Value) > MaxValueSize {
+		return errors.New(errValueTooLarge)
+	}
+
+	err := validateContacts(payload.Contacts)
+	if err != nil {
+		return err
+	}
+
+	err = validateContacts(payload.Providers)
+	if err != nil {
+		return err
+	}
+
+	if payload.TTL != nil && *payload.TTL <= 0 {
+		return errors.New(errBadTTL)
+	}
+
+	if payload.Event != nil {
+		err := validateEventKind(*payload.Event)
+		if err != nil {
+			return err
+		}
+	}
+
+	if payload.Entries != nil {
+		err := validateBatch(payload.Entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	if payload.Range != nil {
+		err := validateRange(payload.Range)
+		if err != nil {
+			return err
+		}
+	}
+
+	if payload.Record != nil {
+		return validateRecord(payload.Record)
+	}
+
+	return nil
+}
+
+func validateContacts(contacts []Contact) error {
+	if len(contacts) > MaxContacts {
+		return errors.New(errTooManyContacts)
+	}
+
+	for _, contact := range contacts {
+		_, _, err := net.SplitHostPort(contact.Address)
+		if contact.ID == nil || err != nil {
+			return errors.New(errBadContact)
+		}
+	}
+	return nil
+}
+
+// logFields returns the ID, type, key and trace of the RPC as structured log fields
+func (rpc *RPC) logFields() logger.Fields {
+	fields := logger.Fields{}
+	if rpc.ID != nil {
+		fields[logger.FieldRPCID] = *rpc.ID
+	}
+	if rpc.Type != nil {
+		fields[logger.FieldRPCType] = string(*rpc.Type)
+	}
+	if rpc.Payload != nil && rpc.Payload.Key != nil {
+		fields[logger.FieldKey] = *rpc.Payload.Key
+	}
+	if rpc.Trace != nil {
+		fields[logger.FieldTraceID] = rpc.Trace.TraceID
+	}
+	return fields
+}
+
 // MarshalRPC serializes the RPC struct and returns the result as a byte array
 func MarshalRPC(rpc RPC) ([]byte, error) {
 	var data []byte
@@ -1,9 +1,12 @@
 package kademlia
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
 )
 
 func TestRPCUnmarshal(t *testing.T) {
@@ -11,7 +14,7 @@ func TestRPCUnmarshal(t *testing.T) {
 	nodeID := NewRandomNodeID()
 	targetID := NewRandomNodeID()
 	contact := NewContact(nodeID, "10.0.8.2")
-	payload := Payload{nil, &msg, []Contact{contact}}
+	payload := Payload{Value: &msg, Contacts: []Contact{contact}}
 	originalRPC, _ := NewRPC(Ping, nodeID.String(), targetID.String(), payload)
 
 	data, _ := MarshalRPC(*originalRPC)
@@ -30,7 +33,7 @@ func TestRPCWrongDataUnmarshal(t *testing.T) {
 
 func TestRPCValidateID(t *testing.T) {
 	msg := "hello"
-	payload := Payload{nil, &msg, nil}
+	payload := Payload{Value: &msg}
 	originalRPC, _ := NewRPC(Store, "", "", payload)
 	originalID := *originalRPC.ID
 
@@ -55,7 +58,7 @@ func TestEmptyRPC(t *testing.T) {
 
 func TestNewRPCCorrectTypes(t *testing.T) {
 	msg := "good bye"
-	payload := Payload{nil, &msg, nil}
+	payload := Payload{Value: &msg}
 
 	for _, rpcType := range rpcTypes {
 		_, err := NewRPC(rpcType, "", "", payload)
@@ -65,8 +68,110 @@ func TestNewRPCCorrectTypes(t *testing.T) {
 
 func TestNewRPCWrongType(t *testing.T) {
 	msg := "good bye"
-	payload := Payload{nil, &msg, nil}
+	payload := Payload{Value: &msg}
 
 	_, err := NewRPC("wrong type", "", "", payload)
 	assert.Error(t, err)
 }
+
+func TestValidateRPC(t *testing.T) {
+	senderID := "00000000000000000000000000000000FFFFFFFF"
+	key := "1111111100000000000000000000000000000000"
+	contact := NewContact(NewNodeID(key), "10.0.8.2:8080")
+
+	rpc, _ := NewRPC(FindNode, senderID, key, Payload{Key: &key, Contacts: []Contact{contact}})
+	assert.NoError(t, ValidateRPC(rpc))
+
+	assert.Equal(t, errors.New(errNilRPC), ValidateRPC(nil))
+
+	noType := *rpc
+	noType.Type = nil
+	assert.Equal(t, errors.New(errNoRPCType), ValidateRPC(&noType))
+
+	wrongType := *rpc
+	wrong := RPCType("wrong type")
+	wrongType.Type = &wrong
+	assert.Equal(t, errors.New(errWrongType), ValidateRPC(&wrongType))
+
+	noID := *rpc
+	noID.ID = nil
+	assert.Equal(t, errors.New(errNoRPCID), ValidateRPC(&noID))
+
+	badID := *rpc
+	shortID := "abcd"
+	badID.ID = &shortID
+	assert.Equal(t, errors.New(errBadRPCID), ValidateRPC(&badID))
+
+	noSender := *rpc
+	noSender.SenderID = nil
+	assert.Equal(t, errors.New(errNoID), ValidateRPC(&noSender))
+
+	badSender := *rpc
+	badSender.SenderID = &shortID
+	assert.Equal(t, errors.New(errBadIDLength), ValidateRPC(&badSender))
+
+	badTarget := *rpc
+	notHex := "zz"
+	badTarget.TargetID = &notHex
+	assert.Error(t, ValidateRPC(&badTarget))
+
+	badTrace := *rpc
+	badTrace.Trace = &tracing.SpanContext{TraceID: notHex, SpanID: notHex}
+	assert.Equal(t, errors.New(errBadTrace), ValidateRPC(&badTrace))
+}
+
+func TestValidateRPCPayload(t *testing.T) {
+	senderID := "00000000000000000000000000000000FFFFFFFF"
+	contact := NewContact(NewNodeID(senderID), "10.0.8.2:8080")
+
+	largeKey := strings.Repeat("a", MaxKeySize+1)
+	rpc, _ := NewRPC(Store, senderID, senderID, Payload{Key: &largeKey})
+	assert.Equal(t, errors.New(errKeyTooLarge), ValidateRPC(rpc))
+
+	largeValue := strings.Repeat("a", MaxValueSize+1)
+	rpc, _ = NewRPC(Store, senderID, senderID, Payload{Value: &largeValue})
+	assert.Equal(t, errors.New(errValueTooLarge), ValidateRPC(rpc))
+
+	contacts := make([]Contact, MaxContacts+1)
+	for i := range contacts {
+		contacts[i] = contact
+	}
+	rpc, _ = NewRPC(FindNode, senderID, senderID, Payload{Contacts: contacts})
+	assert.Equal(t, errors.New(errTooManyContacts), ValidateRPC(rpc))
+
+	rpc, _ = NewRPC(FindNode, senderID, senderID, Payload{Contacts: []Contact{{Address: "10.0.8.2:8080"}}})
+	assert.Equal(t, errors.New(errBadContact), ValidateRPC(rpc))
+
+	rpc, _ = NewRPC(FindNode, senderID, senderID, Payload{Contacts: []Contact{NewContact(contact.ID, "10.0.8.2")}})
+	assert.Equal(t, errors.New(errBadContact), ValidateRPC(rpc))
+}
+
+func TestNewErrorRPC(t *testing.T) {
+	senderID := "00000000000000000000000000000000FFFFFFFF"
+	replierID := "1111111100000000000000000000000000000000"
+	rpc, _ := NewRPC(Ping, senderID, replierID, Payload{})
+
+	reply := NewErrorRPC(rpc, replierID, ValueTooLarge, errValueTooLarge)
+	assert.NoError(t, ValidateRPC(reply))
+	assert.Equal(t, Error, *reply.Type)
+	assert.Equal(t, *rpc.ID, *reply.ID)
+	assert.Equal(t, senderID, *reply.TargetID)
+	assert.Equal(t, "VALUE_TOO_LARGE: "+errValueTooLarge, reply.Error.Error())
+
+	data, _ := MarshalRPC(*reply)
+	unmarshalled, _ := UnmarshalRPC(data)
+	assert.Equal(t, reply, unmarshalled)
+
+	reply.Error = nil
+	assert.Equal(t, errors.New(errNoRPCError), ValidateRPC(reply))
+}
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, ValueTooLarge, errorCode(errors.New(errValueTooLarge)))
+	assert.Equal(t, Unsupported, errorCode(errors.New(errInvalidRPCType)))
+	assert.Equal(t, Unsupported, errorCode(errors.New(errWrongType)))
+	assert.Equal(t, NotFound, errorCode(errors.New(errNoValue)))
+	assert.Equal(t, NotFound, errorCode(errors.New(errUnknownNameKey)))
+	assert.Equal(t, NotFound, errorCode(errors.New(errValueNotFound)))
+	assert.Equal(t, BadRequest, errorCode(errors.New(errBadKeyValue)))
+}
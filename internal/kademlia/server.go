@@ -5,16 +5,31 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
 )
 
 const (
 	// DefaultPort Default port to listen on
 	DefaultPort string = ":8080"
-	// UDPReadBufferSize Size of the UDP read buffer
-	UDPReadBufferSize int = 1024
+	// UDPReadBufferSize Size of the UDP read buffer, large enough for
+	// a JSON escaped value of MaxValueSize bytes
+	UDPReadBufferSize int = 8192
+	// ServerChannelSize Number of packets that can be queued for the workers
 	ServerChannelSize int = 20
+	// DefaultWorkers Number of goroutines handling incoming RPCs
+	DefaultWorkers int = 4
+	// DefaultGlobalRate Packets per second accepted from all peers combined
+	DefaultGlobalRate float64 = 500
+	// DefaultGlobalBurst Packets accepted from all peers in a single burst
+	DefaultGlobalBurst int = 100
+	// DefaultPeerRate Packets per second accepted from a single peer
+	DefaultPeerRate float64 = 50
+	// DefaultPeerBurst Packets accepted from a single peer in a single burst
+	DefaultPeerBurst int = 20
 )
 
 const (
@@ -34,6 +49,8 @@ const (
 	errNoID           string = "no ID given"
 	errBadKeyValue    string = "bad or no key or value given"
 	errNoRPCPayload   string = "no RPC payload given"
+	errQueueFull      string = "incoming queue is full"
+	errOtherIDWidth   string = "sender ID width differs from the network"
 )
 
 type packet struct {
@@ -42,6 +59,30 @@ type packet struct {
 	addr *net.UDPAddr
 }
 
+// ServerConfig contains the flood protection settings of a Server. `Workers` is the
+// number of goroutines handling RPCs and `QueueSize` the number of packets that can wait
+// for them. Rates are given in packets per second and `BanList` holds IPs that are always dropped.
+type ServerConfig struct {
+	Workers     int
+	QueueSize   int
+	GlobalRate  float64
+	GlobalBurst int
+	PeerRate    float64
+	PeerBurst   int
+	BanList     []string
+}
+
+// ServerStats contains the number of packets the server has received, handled
+// and dropped for each reason
+type ServerStats struct {
+	Received    uint64
+	Handled     uint64
+	Banned      uint64
+	RateLimited uint64
+	QueueFull   uint64
+	Malformed   uint64
+}
+
 // Server handles incoming RPCs from other nodes and returns the
 // correct responses back to the originator nodes
 type Server struct {
@@ -50,18 +91,71 @@ type Server struct {
 	conn     *net.UDPConn
 	incoming chan packet
 	outgoing chan packet
+	config   ServerConfig
+	limiter  *rateLimiter
+	stats    *ServerStats
+	logger   *logger.Logger
+}
+
+// DefaultServerConfig returns the ServerConfig used by InitServer
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Workers:     DefaultWorkers,
+		QueueSize:   ServerChannelSize,
+		GlobalRate:  DefaultGlobalRate,
+		GlobalBurst: DefaultGlobalBurst,
+		PeerRate:    DefaultPeerRate,
+		PeerBurst:   DefaultPeerBurst,
+	}
 }
 
 // InitServer initializes the server and sets the local IP address
 func InitServer(kademlia *Node) Server {
+	return InitServerWithConfig(kademlia, DefaultServerConfig())
+}
+
+// InitServerWithConfig initializes the server with the flood protection
+// settings in `config` and sets the local IP address
+func InitServerWithConfig(kademlia *Node, config ServerConfig) Server {
 	server := Server{}
 	server.kademlia = kademlia
 	server.ip = server.GetLocalIP()
-	server.incoming = make(chan packet, ServerChannelSize)
-	server.outgoing = make(chan packet, ServerChannelSize)
+	server.config = config
+	server.incoming = make(chan packet, config.QueueSize)
+	server.outgoing = make(chan packet, config.QueueSize)
+	server.limiter = newRateLimiter(config)
+	server.stats = &ServerStats{}
+	server.logger = kademlia.logger.Component("server")
 	return server
 }
 
+// Ban drops every future packet sent from `ip`
+func (server *Server) Ban(ip string) {
+	server.limiter.ban(ip)
+}
+
+// Unban removes `ip` from the ban list
+func (server *Server) Unban(ip string) {
+	server.limiter.unban(ip)
+}
+
+// IsBanned returns true if `ip` is in the ban list
+func (server *Server) IsBanned(ip string) bool {
+	return server.limiter.isBanned(ip)
+}
+
+// Stats returns a snapshot of the packet counters of the server
+func (server *Server) Stats() ServerStats {
+	return ServerStats{
+		Received:    atomic.LoadUint64(&server.stats.Received),
+		Handled:     atomic.LoadUint64(&server.stats.Handled),
+		Banned:      atomic.LoadUint64(&server.stats.Banned),
+		RateLimited: atomic.LoadUint64(&server.stats.RateLimited),
+		QueueFull:   atomic.LoadUint64(&server.stats.QueueFull),
+		Malformed:   atomic.LoadUint64(&server.stats.Malformed),
+	}
+}
+
 // GetLocalIP returns the IP of the Node in the Docker Network
 func (server *Server) GetLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
@@ -87,7 +181,7 @@ func (server *Server) Listen(port string) error {
 
 	conn, err := net.ListenUDP(udpNetwork, listenAddr)
 	if err != nil {
-		log.Error(err)
+		server.logger.Error(err)
 		return err
 	}
 	defer conn.Close()
@@ -98,61 +192,155 @@ func (server *Server) Listen(port string) error {
 		for true {
 			err := server.handleOutgoingChannel()
 			if err != nil {
-				log.Warn(err)
+				server.logger.Warn(err)
 			}
 		}
 	}()
 
-	go func() {
-		for true {
-			server.readIncomingChannel()
-		}
-	}()
+	for i := 0; i < server.config.Workers; i++ {
+		go func() {
+			for true {
+				server.readIncomingChannel()
+			}
+		}()
+	}
 
 	for {
 		err := server.readUDP()
 		if err != nil {
-			log.Warn(err)
+			server.logger.Warn(err)
 		}
 	}
 }
 
 func (server *Server) readUDP() error {
-	var udpErr error = nil
-
 	readBuffer := make([]byte, UDPReadBufferSize)
 	bytesRead, receiveAddr, err := server.conn.ReadFromUDP(readBuffer)
-
 	if err != nil {
-		udpErr = err
-	} else if bytesRead == 0 {
-		udpErr = errors.New(errNoBytesRead)
+		return err
 	}
 
 	senderIP := strings.Split(receiveAddr.String(), ":")[0]
+	atomic.AddUint64(&server.stats.Received, 1)
+
+	// drop the packet before spending any time parsing it. Dropped packets are
+	// counted rather than returned, so that a flood does not reach the log.
+	err = server.limiter.allow(senderIP)
+	if err != nil {
+		if err.Error() == errBanned {
+			atomic.AddUint64(&server.stats.Banned, 1)
+			packetsDropped.Inc("banned")
+		} else {
+			atomic.AddUint64(&server.stats.RateLimited, 1)
+			packetsDropped.Inc("rate_limited")
+		}
+		server.logger.Debug(err)
+		return nil
+	}
 
-	rpc, err := UnmarshalRPC(readBuffer[0:bytesRead])
+	rpc, err := server.parsePacket(readBuffer[0:bytesRead])
 	if err != nil {
-		udpErr = err
+		atomic.AddUint64(&server.stats.Malformed, 1)
+		packetsDropped.Inc("malformed")
+		server.replyError(readBuffer[0:bytesRead], senderIP, receiveAddr, err)
+		return err
 	}
 
 	packet := packet{rpc, senderIP, receiveAddr}
-	server.incoming <- packet
 
-	return udpErr
+	// never block the reader, drop the packet if every worker is busy
+	select {
+	case server.incoming <- packet:
+	default:
+		atomic.AddUint64(&server.stats.QueueFull, 1)
+		packetsDropped.Inc("queue_full")
+		server.logger.Debug(errQueueFull)
+	}
+
+	return nil
+}
+
+// parsePacket deserializes and validates the data of a packet
+func (server *Server) parsePacket(data []byte) (*RPC, error) {
+	if len(data) == 0 {
+		return nil, errors.New(errNoBytesRead)
+	}
+
+	rpc, err := UnmarshalRPC(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateRPC(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpc, nil
+}
+
+// replyError sends an ERROR RPC describing `err` back to the sender of `data`.
+// Nothing is sent if `data` is not an RPC with an ID the sender could match it with.
+func (server *Server) replyError(data []byte, ip string, addr *net.UDPAddr, err error) {
+	rpc, unmarshalErr := UnmarshalRPC(data)
+	if unmarshalErr != nil || rpc.ID == nil || isReply(rpc) {
+		return
+	}
+
+	reply := NewErrorRPC(rpc, server.kademlia.RT.GetMeID().String(), errorCode(err), err.Error())
+	rpcErrors.Inc(string(reply.Error.Code))
+
+	// the reply is dropped rather than blocking the reader
+	select {
+	case server.outgoing <- packet{reply, ip, addr}:
+	default:
+	}
 }
 
 func (server *Server) readIncomingChannel() {
 	pkt := <-server.incoming
+
+	// never answer a reply, two servers could otherwise bounce errors between each other
+	if isReply(pkt.rpc) {
+		return
+	}
+
+	rpcsReceived.Inc(string(*pkt.rpc.Type))
+	span := server.startSpan(pkt.rpc)
+
 	rpc, err := server.handleIncomingRPCS(pkt.rpc, pkt.ip)
 	if err != nil {
-		log.Warn(err)
+		server.logger.WithFields(pkt.rpc.logFields()).WithField(logger.FieldPeerID, *pkt.rpc.SenderID).Warn(err)
+		rpc = NewErrorRPC(pkt.rpc, server.kademlia.RT.GetMeID().String(), errorCode(err), err.Error())
+		rpcErrors.Inc(string(rpc.Error.Code))
+		span.SetError(err)
+	} else {
+		span.SetAttribute(attrResult, rpc.describe())
 	}
+	span.End()
+	atomic.AddUint64(&server.stats.Handled, 1)
 
 	fwdPkt := packet{rpc, pkt.ip, pkt.addr}
 	server.outgoing <- fwdPkt
 }
 
+// startSpan starts a span for handling `rpc` if it was sent as part of a trace
+func (server *Server) startSpan(rpc *RPC) *tracing.Span {
+	if rpc.Trace == nil {
+		return nil
+	}
+
+	span := server.kademlia.tracer.Start("handle "+string(*rpc.Type), tracing.Server, rpc.Trace)
+	span.SetAttribute(attrPeerID, *rpc.SenderID)
+	span.SetAttribute(attrRPCID, *rpc.ID)
+	return span
+}
+
+// isReply returns true if the RPC is a reply to another RPC
+func isReply(rpc *RPC) bool {
+	return rpc != nil && rpc.Type != nil && (*rpc.Type == OK || *rpc.Type == Error)
+}
+
 func (server *Server) handleOutgoingChannel() error {
 	packet := <-server.outgoing
 	data, err := MarshalRPC(*packet.rpc)
@@ -169,17 +357,40 @@ func (server *Server) handleOutgoingChannel() error {
 }
 
 func (server *Server) handleIncomingRPCS(rpc *RPC, receiveAddr string) (*RPC, error) {
-	var err error
+	err := ValidateRPC(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	// nodes of networks with other ID widths cannot share a routing table
+	if NewNodeID(*rpc.SenderID).Len() != server.kademlia.RT.GetMeID().Len() {
+		return nil, errors.New(errOtherIDWidth)
+	}
+
 	var retRPC *RPC
 	switch *rpc.Type {
 	case Ping:
 		retRPC, err = server.handleIncomingPingRPC(rpc)
 	case Store:
-		retRPC, err = server.handleIncomingStoreRPC(rpc)
+		retRPC, err = server.handleIncomingStoreRPC(rpc, receiveAddr)
 	case FindNode:
 		retRPC, err = server.handleIncomingFindNodeRPC(rpc)
 	case FindValue:
 		retRPC, err = server.handleIncomingFindValueRPC(rpc)
+	case FindRange:
+		retRPC, err = server.handleIncomingFindRangeRPC(rpc)
+	case AddProvider:
+		retRPC, err = server.handleIncomingAddProviderRPC(rpc, receiveAddr)
+	case GetProviders:
+		retRPC, err = server.handleIncomingGetProvidersRPC(rpc)
+	case Subscribe:
+		retRPC, err = server.handleIncomingSubscribeRPC(rpc, receiveAddr)
+	case Publish:
+		retRPC, err = server.handleIncomingPublishRPC(rpc)
+	case AddWatcher:
+		retRPC, err = server.handleIncomingAddWatcherRPC(rpc, receiveAddr)
+	case Notify:
+		retRPC, err = server.handleIncomingNotifyRPC(rpc, receiveAddr)
 	default:
 		err = errors.New(errInvalidRPCType)
 	}
@@ -209,19 +420,126 @@ func (server *Server) handleIncomingPingRPC(rpc *RPC) (*RPC, error) {
 	return rpc, nil
 }
 
-func (server *Server) handleIncomingStoreRPC(rpc *RPC) (*RPC, error) {
+func (server *Server) handleIncomingStoreRPC(rpc *RPC, senderIP string) (*RPC, error) {
 	err := checkNilRPCPayload(rpc)
 	if err != nil {
 		return nil, err
 	}
 
+	if rpc.Payload.Entries != nil {
+		return server.handleIncomingStoreBatch(rpc, NewContact(NewNodeID(*rpc.SenderID), senderIP+DefaultPort))
+	}
+
 	key := rpc.Payload.Key
 	value := rpc.Payload.Value
-	if key == nil || value == nil {
+	record := rpc.Payload.Record
+	if key == nil || (value == nil && record == nil) {
 		return nil, errors.New(errBadKeyValue)
 	}
 
-	server.kademlia.insertLocalStore(*key, *value)
+	if record != nil {
+		value = nil
+	}
+	sender := NewContact(NewNodeID(*rpc.SenderID), senderIP+DefaultPort)
+
+	// stored and cached values are checked as values returned by a lookup are
+	err = server.kademlia.verifyRetrieved(*key, Entry{value, record})
+	if err != nil {
+		return nil, err
+	}
+
+	if record != nil && rpc.Payload.TTL != nil {
+		return nil, errors.New(errCachedRecord)
+	} else if record != nil {
+		return server.handleIncomingStoreRecord(rpc, sender)
+	} else if rpc.Payload.TTL != nil {
+		server.kademlia.insertCache(*key, *value, *rpc.Payload.TTL)
+		return rpc, nil
+	}
+
+	err = server.storeLocalValue(*key, *value, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpc, nil
+}
+
+// storeLocalValue inserts `value` stored by the node `sender` under `key` unless a
+// tombstone newer than it is stored, and notifies the watchers of `key`
+func (server *Server) storeLocalValue(key string, value string, sender Contact) error {
+	if server.kademlia.deletedBefore(key, value) {
+		return errors.New(errDeletedValue)
+	}
+
+	kind := EventStored
+	if server.kademlia.searchLocalStore(key) != nil {
+		kind = EventRestored
+	}
+
+	server.kademlia.insertLocalStore(key, value)
+	server.kademlia.setValueOwner(key, sender)
+	go server.kademlia.notifyWatchers(key, kind, entryData(value))
+
+	return nil
+}
+
+// handleIncomingStoreBatch stores every entry of a STORE RPC for several keys.
+// Entries which are not valid are skipped, the reply carries the keys stored.
+func (server *Server) handleIncomingStoreBatch(rpc *RPC, sender Contact) (*RPC, error) {
+	stored := []BatchEntry{}
+	for _, entry := range rpc.Payload.Entries {
+		if entry.Value == nil {
+			continue
+		}
+
+		err := server.kademlia.verifyRetrieved(entry.Key, Entry{entry.Value, nil})
+		if err == nil {
+			err = server.storeLocalValue(entry.Key, *entry.Value, sender)
+		}
+		if err != nil {
+			server.kademlia.logger.WithField(logger.FieldKey, entry.Key).Warn(err)
+			continue
+		}
+		stored = append(stored, BatchEntry{Key: entry.Key})
+	}
+
+	rpc.Payload.Entries = stored
+	return rpc, nil
+}
+
+// handleIncomingStoreRecord stores the validated record of a STORE RPC sent by
+// `sender` if it wins over the record already stored and notifies the watchers of
+// its key
+func (server *Server) handleIncomingStoreRecord(rpc *RPC, sender Contact) (*RPC, error) {
+	key := *rpc.Payload.Key
+	record := rpc.Payload.Record
+
+	// signed records are checked against their signature, unsigned records and
+	// tombstones are only accepted from their publisher, sending from the address
+	// the value or record under the key was first stored from
+	unsigned := record.PublicKey == nil
+	if unsigned && (!strings.EqualFold(record.Publisher, *rpc.SenderID) || !server.kademlia.ownedBy(key, sender)) {
+		return nil, errors.New(errNotOwner)
+	}
+
+	kind := EventStored
+	if server.kademlia.getLocalRecord(key) != nil || server.kademlia.searchLocalStore(key) != nil {
+		kind = EventRestored
+	}
+
+	err := server.kademlia.putLocalRecord(key, *record)
+	if err != nil {
+		return nil, err
+	}
+	if unsigned {
+		server.kademlia.setValueOwner(key, sender)
+	}
+
+	if record.Deleted {
+		kind = EventDeleted
+	}
+	go server.kademlia.notifyWatchers(key, kind, record.Value)
 
 	return rpc, nil
 }
@@ -239,7 +557,7 @@ func (server *Server) handleIncomingFindNodeRPC(rpc *RPC) (*RPC, error) {
 	targetID := NewNodeID(*rpc.TargetID)
 	contacts := server.kademlia.RT.FindClosestContacts(targetID, BucketSize)
 
-	payload := Payload{nil, nil, contacts}
+	payload := Payload{Contacts: contacts}
 	rpc.Payload = &payload
 
 	return rpc, nil
@@ -255,12 +573,25 @@ func (server *Server) handleIncomingFindValueRPC(rpc *RPC) (*RPC, error) {
 		return nil, errors.New(errNoTargetID)
 	}
 
+	if rpc.Payload.Entries != nil {
+		return server.handleIncomingFindValues(rpc)
+	}
+
 	key := rpc.Payload.Key
 	if key == nil {
 		return nil, errors.New(errBadKeyValue)
 	}
 
+	// tombstones are returned as well so that the lookup stops
+	if record := server.kademlia.getLocalRecord(*key); record != nil {
+		rpc.Payload.Record = record
+		return rpc, nil
+	}
+
 	value := server.kademlia.searchLocalStore(*key)
+	if value == nil {
+		value = server.kademlia.searchCache(*key)
+	}
 	// If no value is found - return k closest
 	if value == nil {
 		return server.handleIncomingFindNodeRPC(rpc)
@@ -270,6 +601,231 @@ func (server *Server) handleIncomingFindValueRPC(rpc *RPC) (*RPC, error) {
 	return rpc, nil
 }
 
+// handleIncomingFindValues replies to a FIND_VALUE RPC for several keys with the
+// values stored or cached under them. Values which would make the reply larger
+// than MaxBatchSize are left out.
+func (server *Server) handleIncomingFindValues(rpc *RPC) (*RPC, error) {
+	found := []BatchEntry{}
+	size := 0
+	for _, entry := range rpc.Payload.Entries {
+		value := server.kademlia.searchLocalStore(entry.Key)
+		if value == nil {
+			value = server.kademlia.searchCache(entry.Key)
+		}
+		if value == nil || size+len(*value) > MaxBatchSize {
+			continue
+		}
+
+		size += len(*value)
+		found = append(found, BatchEntry{entry.Key, value})
+	}
+
+	rpc.Payload.Entries = found
+	return rpc, nil
+}
+
+// handleIncomingFindRangeRPC replies with the keys the node stores in the range of the RPC
+func (server *Server) handleIncomingFindRangeRPC(rpc *RPC) (*RPC, error) {
+	err := checkNilRPCPayload(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	query := rpc.Payload.Range
+	if query == nil {
+		return nil, errors.New(errNoRange)
+	}
+
+	query.Keys, query.More = server.kademlia.localKeysInRange(query)
+	return rpc, nil
+}
+
+// handleIncomingAddProviderRPC keeps the sender as a provider of the key of the RPC.
+// The provider is reached at the address the RPC was received from.
+func (server *Server) handleIncomingAddProviderRPC(rpc *RPC, senderIP string) (*RPC, error) {
+	err := checkNilRPCPayload(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := rpc.Payload.Key
+	if key == nil {
+		return nil, errors.New(errBadKeyValue)
+	}
+
+	err = validateProviderKey(*key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rpc.Payload.Providers) != 1 {
+		return nil, errors.New(errNoProvider)
+	}
+
+	provider := rpc.Payload.Providers[0]
+	if !provider.ID.Equals(NewNodeID(*rpc.SenderID)) {
+		return nil, errors.New(errBadProvider)
+	}
+
+	ttl := ProviderTTL
+	if rpc.Payload.TTL != nil && *rpc.Payload.TTL < ttl {
+		ttl = *rpc.Payload.TTL
+	}
+
+	err = server.kademlia.addLocalProvider(normalizeKey(*key), NewContact(provider.ID, senderIP+DefaultPort), ttl)
+	if err != nil {
+		return nil, err
+	}
+	return rpc, nil
+}
+
+// handleIncomingGetProvidersRPC replies with the providers the node keeps for the key of the RPC
+func (server *Server) handleIncomingGetProvidersRPC(rpc *RPC) (*RPC, error) {
+	err := checkNilRPCPayload(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := rpc.Payload.Key
+	if key == nil {
+		return nil, errors.New(errBadKeyValue)
+	}
+
+	providers := server.kademlia.localProviders(normalizeKey(*key))
+	if len(providers) > MaxContacts {
+		providers = providers[:MaxContacts]
+	}
+
+	rpc.Payload.Providers = providers
+	return rpc, nil
+}
+
+// handleIncomingSubscribeRPC keeps the sender as a subscriber of the topic of the RPC.
+// The subscriber is reached at the address the RPC was received from.
+func (server *Server) handleIncomingSubscribeRPC(rpc *RPC, senderIP string) (*RPC, error) {
+	err := checkNilRPCPayload(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := rpc.Payload.Key
+	if key == nil {
+		return nil, errors.New(errBadKeyValue)
+	}
+
+	err = validateTopicKey(*key)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := SubscriptionTTL
+	if rpc.Payload.TTL != nil && *rpc.Payload.TTL < ttl {
+		ttl = *rpc.Payload.TTL
+	}
+
+	subscriber := NewContact(NewNodeID(*rpc.SenderID), senderIP+DefaultPort)
+	err = server.kademlia.addLocalSubscriber(*key, subscriber, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return rpc, nil
+}
+
+// handleIncomingPublishRPC delivers the message of the RPC to the subscriptions of the
+// node to its topic and replies with the first page of the subscribers of the topic the
+// node keeps. An RPC with a `Range` instead of a message asks for the page after `Range.After`.
+func (server *Server) handleIncomingPublishRPC(rpc *RPC) (*RPC, error) {
+	err := checkNilRPCPayload(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := rpc.Payload.Key
+	if key == nil {
+		return nil, errors.New(errBadKeyValue)
+	} else if rpc.Payload.Value == nil && rpc.Payload.Range == nil {
+		return nil, errors.New(errNoMessage)
+	}
+
+	err = validateTopicKey(*key)
+	if err != nil {
+		return nil, err
+	}
+
+	page := RangeQuery{Limit: MaxContacts}
+	if rpc.Payload.Range != nil {
+		page.After = rpc.Payload.Range.After
+	} else {
+		server.kademlia.deliver(TopicMessage{*key, *rpc.Payload.Value, *rpc.SenderID, time.Now()})
+	}
+
+	rpc.Payload.Providers, page.More = server.kademlia.subscribersAfter(*key, page.After, page.Limit)
+	rpc.Payload.Value = nil
+	rpc.Payload.Range = &page
+	return rpc, nil
+}
+
+// handleIncomingAddWatcherRPC keeps the sender as a watcher of the key of the RPC.
+// The watcher is reached at the address the RPC was received from.
+func (server *Server) handleIncomingAddWatcherRPC(rpc *RPC, senderIP string) (*RPC, error) {
+	err := checkNilRPCPayload(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := rpc.Payload.Key
+	if key == nil {
+		return nil, errors.New(errBadKeyValue)
+	}
+
+	_, _, err = ParseKey(*key)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := WatchTTL
+	if rpc.Payload.TTL != nil && *rpc.Payload.TTL < ttl {
+		ttl = *rpc.Payload.TTL
+	}
+
+	watcher := NewContact(NewNodeID(*rpc.SenderID), senderIP+DefaultPort)
+	err = server.kademlia.addLocalWatcher(normalizeKey(*key), watcher, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return rpc, nil
+}
+
+// handleIncomingNotifyRPC delivers the event of the RPC to the watches of the node on its key
+func (server *Server) handleIncomingNotifyRPC(rpc *RPC, senderIP string) (*RPC, error) {
+	err := checkNilRPCPayload(rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	if rpc.Payload.Key == nil {
+		return nil, errors.New(errBadKeyValue)
+	} else if rpc.Payload.Event == nil {
+		return nil, errors.New(errNoEvent)
+	}
+
+	// events are only accepted from the nodes the watch of the key registered with,
+	// sending from the address they were registered at
+	key := normalizeKey(*rpc.Payload.Key)
+	sender := NewContact(NewNodeID(*rpc.SenderID), senderIP+DefaultPort)
+	if !server.kademlia.isWatchedOn(key, sender) {
+		return nil, errors.New(errNotWatched)
+	}
+
+	value := ""
+	if rpc.Payload.Value != nil {
+		value = *rpc.Payload.Value
+	}
+
+	server.kademlia.deliverEvent(WatchEvent{key, *rpc.Payload.Event, value, *rpc.SenderID, time.Now()})
+	return rpc, nil
+}
+
 func checkNilRPCPayload(rpc *RPC) error {
 	if rpc == nil {
 		return errors.New(errNilRPC)
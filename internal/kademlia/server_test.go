@@ -3,6 +3,7 @@ package kademlia
 import (
 	"errors"
 	"net"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,12 +14,12 @@ func TestNewNetwork(t *testing.T) {
 	network := InitServer(&node)
 
 	assert.NotNil(t, network)
-	assert.Equal(t, node, *network.kademlia)
+	assert.Equal(t, &node, network.kademlia)
 }
 
 func TestUpdateRoutingTable(t *testing.T) {
 	pingMsg := pingMsg
-	payload := Payload{&pingMsg, nil, nil}
+	payload := Payload{Key: &pingMsg}
 
 	c := NewContact(NewNodeID("1111111400000000000000000000000000000000"), "localhost:8002")
 
@@ -39,7 +40,7 @@ func TestHandleIncomingPing(t *testing.T) {
 	node := Node{}
 	network := InitServer(&node)
 	pingMsg := pingMsg
-	payload := Payload{&pingMsg, nil, nil}
+	payload := Payload{Key: &pingMsg}
 	target := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
 
 	rpc, _ := NewRPC(Ping, target.ID.String(), "", payload)
@@ -59,7 +60,7 @@ func TestHandleIncomingRPCS(t *testing.T) {
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
 	pingMsg := pingMsg
-	payload := Payload{nil, &pingMsg, nil}
+	payload := Payload{Value: &pingMsg}
 
 	orgRPC, _ := NewRPC(Ping, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", payload)
 	rpc, err := network.handleIncomingRPCS(orgRPC, "10.0.8.3:8080")
@@ -68,17 +69,22 @@ func TestHandleIncomingRPCS(t *testing.T) {
 	assert.Equal(t, OK, *rpc.Type)
 	assert.Nil(t, err)
 
-	storeRPC, _ := NewRPC(Store, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{nil, nil, []Contact{}})
+	storeRPC, _ := NewRPC(Store, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{Contacts: []Contact{}})
 	_, err = network.handleIncomingRPCS(storeRPC, "10.0.8.3:8080")
 	assert.Error(t, err)
 
-	valueRPC, _ := NewRPC(FindValue, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{nil, nil, []Contact{}})
+	valueRPC, _ := NewRPC(FindValue, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{Contacts: []Contact{}})
 	_, err = network.handleIncomingRPCS(valueRPC, "10.0.8.3:8080")
 	assert.Error(t, err)
 
-	wrongRPC, _ := NewRPC(OK, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{nil, nil, []Contact{}})
+	wrongRPC, _ := NewRPC(OK, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{Contacts: []Contact{}})
 	_, err = network.handleIncomingRPCS(wrongRPC, "10.0.8.3:8080")
 	assert.Error(t, err)
+
+	widePayload := Payload{Value: &pingMsg}
+	wideRPC, _ := NewRPC(Ping, NewRandomNodeIDWithWidth(MaxIDLength*8).String(), "00000000000000000000000000000000FFFFFFFF", widePayload)
+	_, err = network.handleIncomingRPCS(wideRPC, "10.0.8.3:8080")
+	assert.EqualError(t, err, errOtherIDWidth)
 }
 
 func TestHandleIncomingRPCsFindValue(t *testing.T) {
@@ -87,7 +93,7 @@ func TestHandleIncomingRPCsFindValue(t *testing.T) {
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
 
-	nodeRPC, _ := NewRPC(FindNode, "1111111100000000000000000000000000000000", "00000100000000000000000000000000FFFFFFFF", Payload{nil, nil, []Contact{}})
+	nodeRPC, _ := NewRPC(FindNode, "1111111100000000000000000000000000000000", "00000100000000000000000000000000FFFFFFFF", Payload{Contacts: []Contact{}})
 	_, err := network.handleIncomingRPCS(nodeRPC, "10.0.8.3:8080")
 	assert.Nil(t, err)
 }
@@ -112,7 +118,7 @@ func TestIncomingFindNodeFindsCorrectContact(t *testing.T) {
 	c := NewContact(NewNodeID(senderID), senderAddress)
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
-	payload := Payload{nil, nil, []Contact{}}
+	payload := Payload{Contacts: []Contact{}}
 
 	target := NewContact(NewNodeID(targetID), targetAddress)
 	node.RT.AddContact(target)
@@ -127,7 +133,7 @@ func TestIncomingFindNodeBadInput(t *testing.T) {
 	c := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
-	payload := Payload{nil, nil, []Contact{}}
+	payload := Payload{Contacts: []Contact{}}
 
 	rpc, err := NewRPC(FindNode, "00000000000000000000000000000000FFFFFFFF", "1111111100000000000000000000000000000000", payload)
 
@@ -151,8 +157,8 @@ func TestIncomingFindValueNoKeyInPayload(t *testing.T) {
 	_, err := network.handleIncomingFindValueRPC(nil)
 	assert.Equal(t, errors.New(errNilRPC), err)
 
-	payload := Payload{nil, nil, []Contact{}}
-	rpc := RPC{&findValue, &payload, nil, nil, &targetID}
+	payload := Payload{Contacts: []Contact{}}
+	rpc := RPC{&findValue, &payload, nil, nil, &targetID, nil, nil}
 	_, err = network.handleIncomingFindValueRPC(&rpc)
 	assert.Equal(t, errors.New(errBadKeyValue), err)
 }
@@ -164,7 +170,7 @@ func TestIncomingFindValueReturnClosestContacts(t *testing.T) {
 	network := InitServer(&node)
 
 	key := "1111111100000000000000000000000000000000"
-	payload := Payload{&key, nil, []Contact{}}
+	payload := Payload{Key: &key, Contacts: []Contact{}}
 	rpc, _ := NewRPC(FindValue, "00000000000000000000000000000000FFFFFFFF", "1111111100000000000000000000000000000000", payload)
 	rpc, _ = network.handleIncomingFindValueRPC(rpc)
 
@@ -173,14 +179,14 @@ func TestIncomingFindValueReturnClosestContacts(t *testing.T) {
 }
 
 func TestIncomingFindValueFoundValue(t *testing.T) {
-	node := Node{nil, Client{}, make(map[string]string), 10}
+	node := Node{content: make(map[string]string), deadline: 10}
 	c := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
 
 	key := "1111111100000000000000000000000000000000"
 	value := "hello"
-	payload := Payload{&key, nil, []Contact{}}
+	payload := Payload{Key: &key, Contacts: []Contact{}}
 	node.insertLocalStore(key, value)
 	rpc, _ := NewRPC(FindValue, "00000000000000000000000000000000FFFFFFFF", "1111111100000000000000000000000000000000", payload)
 	rpc, err := network.handleIncomingFindValueRPC(rpc)
@@ -189,12 +195,12 @@ func TestIncomingFindValueFoundValue(t *testing.T) {
 }
 
 func TestIncomingFindValueReturnsEmptyClosestContacts(t *testing.T) {
-	node := Node{nil, Client{}, make(map[string]string), 10}
+	node := Node{content: make(map[string]string), deadline: 10}
 	c := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
 
-	payload := Payload{nil, nil, nil}
+	payload := Payload{}
 	senderID := "00000000000000000000000000000000FFFFFFFF"
 	targetID := "00000000000000000000000000000000FFFFFFFF"
 	rpc, _ := NewRPC(FindValue, senderID, targetID, payload)
@@ -205,17 +211,17 @@ func TestIncomingFindValueReturnsEmptyClosestContacts(t *testing.T) {
 }
 
 func TestIncomingStoreSuccessfullyStoreValue(t *testing.T) {
-	node := Node{nil, Client{}, make(map[string]string), 10}
+	node := Node{content: make(map[string]string), deadline: 10}
 	c := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
 
-	key := "hello"
-	value := "good bye"
-	payload := Payload{&key, &value, []Contact{}}
+	key := "490528f36debf7c15cea5e9a9d1ea024cf6b2921"
+	value := "1600000000:there"
+	payload := Payload{Key: &key, Value: &value, Contacts: []Contact{}}
 
 	rpc, _ := NewRPC(Store, "10000000000000000000000000000000FFFFFFFF", "00000000000000000000000000000000FFFFFFFF", payload)
-	rpc, err := network.handleIncomingStoreRPC(rpc)
+	rpc, err := network.handleIncomingStoreRPC(rpc, "10.0.8.2")
 
 	val := node.searchLocalStore(key)
 
@@ -228,16 +234,16 @@ func TestIncomingStoreBadInput(t *testing.T) {
 	storeType := Store
 
 	network := Server{}
-	_, err := network.handleIncomingStoreRPC(nil)
+	_, err := network.handleIncomingStoreRPC(nil, "10.0.8.2")
 	assert.Error(t, err)
 
-	rpc := RPC{&storeType, nil, nil, nil, nil}
-	_, err = network.handleIncomingStoreRPC(&rpc)
+	rpc := RPC{&storeType, nil, nil, nil, nil, nil, nil}
+	_, err = network.handleIncomingStoreRPC(&rpc, "10.0.8.2")
 	assert.Error(t, err)
 
-	payload := Payload{nil, nil, []Contact{}}
-	rpc = RPC{&storeType, &payload, nil, nil, nil}
-	_, err = network.handleIncomingStoreRPC(&rpc)
+	payload := Payload{Contacts: []Contact{}}
+	rpc = RPC{&storeType, &payload, nil, nil, nil, nil, nil}
+	_, err = network.handleIncomingStoreRPC(&rpc, "10.0.8.2")
 	assert.Error(t, err)
 }
 
@@ -247,7 +253,7 @@ func TestNoTargetID(t *testing.T) {
 	node.RT = NewRoutingTable(c)
 	network := InitServer(&node)
 
-	payload := Payload{nil, nil, []Contact{}}
+	payload := Payload{Contacts: []Contact{}}
 	rpc, _ := NewRPC(Ping, "00000000000000000000000000000000FFFFFFFF", "", payload)
 	rpc.TargetID = nil
 
@@ -262,22 +268,41 @@ func TestNoTargetID(t *testing.T) {
 
 func TestPacketToIncomingChannel(t *testing.T) {
 	node := Node{}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
 	server := InitServer(&node)
-	go server.readIncomingChannel()
 	ip := "127.0.0.1"
 
 	payload := Payload{}
-	rpc, _ := NewRPC(OK, "00000000000000000000000000000000FFFFFFFF", "00000000000000000000000000000000FFFFFFFF", payload)
+	rpc, _ := NewRPC(Store, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", payload)
 	pkt := packet{rpc, ip, nil}
 	server.incoming <- pkt
+	server.readIncomingChannel()
 
 	val := <-server.outgoing
 
 	assert.Equal(t, ip, val.ip)
-	assert.Nil(t, val.rpc)
+	assert.Equal(t, Error, *val.rpc.Type)
+	assert.Equal(t, *rpc.ID, *val.rpc.ID)
+	assert.Equal(t, &RPCError{BadRequest, errBadKeyValue}, val.rpc.Error)
 	assert.Nil(t, val.addr)
 }
 
+func TestReplyIsNeverAnswered(t *testing.T) {
+	node := Node{}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	okRPC, _ := NewRPC(OK, "1111111100000000000000000000000000000000", "00000000000000000000000000000000FFFFFFFF", Payload{})
+	errorRPC := NewErrorRPC(okRPC, "1111111100000000000000000000000000000000", BadRequest, "bad")
+
+	server.incoming <- packet{okRPC, "127.0.0.1", nil}
+	server.readIncomingChannel()
+	server.incoming <- packet{errorRPC, "127.0.0.1", nil}
+	server.readIncomingChannel()
+
+	assert.Equal(t, 0, len(server.outgoing))
+}
+
 func TestHandleOutgoingChannel(t *testing.T) {
 	node := Node{}
 	server := InitServer(&node)
@@ -285,7 +310,7 @@ func TestHandleOutgoingChannel(t *testing.T) {
 	server.conn, _ = net.ListenUDP(udpNetwork, addr)
 	defer server.conn.Close()
 
-	rpc, _ := NewRPC(Ping, "00000000000000000000000000000000FFFFFFFF", "00000000000000000000000000000000FFFFFFFF", Payload{nil, nil, []Contact{}})
+	rpc, _ := NewRPC(Ping, "00000000000000000000000000000000FFFFFFFF", "00000000000000000000000000000000FFFFFFFF", Payload{Contacts: []Contact{}})
 	pkt := packet{rpc, "127.0.0.1", addr}
 	server.outgoing <- pkt
 
@@ -304,6 +329,59 @@ func TestReadUDPBadData(t *testing.T) {
 	defer server.conn.Close()
 
 	assert.Error(t, err)
+	assert.Equal(t, uint64(1), server.Stats().Malformed)
+	assert.Equal(t, 0, len(server.incoming))
+}
+
+func TestReadUDPInvalidRPC(t *testing.T) {
+	node := Node{}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+	addr, _ := net.ResolveUDPAddr(udpNetwork, "127.0.0.1:9093")
+	server.conn, _ = net.ListenUDP(udpNetwork, addr)
+	defer server.conn.Close()
+
+	server.conn.WriteToUDP([]byte(`{"type":"PING","payload":null,"id":null,"senderID":null,"targetID":null}`), addr)
+	err := server.readUDP()
+
+	assert.Equal(t, errors.New(errNoRPCID), err)
+	assert.Equal(t, uint64(1), server.Stats().Malformed)
+	assert.Equal(t, 0, len(server.incoming))
+}
+
+func TestReadUDPValueTooLarge(t *testing.T) {
+	node := Node{}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+	addr, _ := net.ResolveUDPAddr(udpNetwork, "127.0.0.1:9094")
+	server.conn, _ = net.ListenUDP(udpNetwork, addr)
+	defer server.conn.Close()
+
+	key := "1111111100000000000000000000000000000000"
+	value := strings.Repeat("a", MaxValueSize+1)
+	rpc, _ := NewRPC(Store, key, key, Payload{Key: &key, Value: &value})
+	data, _ := MarshalRPC(*rpc)
+	server.conn.WriteToUDP(data, addr)
+
+	err := server.readUDP()
+	assert.Equal(t, errors.New(errValueTooLarge), err)
+
+	reply := <-server.outgoing
+	assert.Equal(t, *rpc.ID, *reply.rpc.ID)
+	assert.Equal(t, ValueTooLarge, reply.rpc.Error.Code)
+}
+
+func TestHandleIncomingRPCSNilFields(t *testing.T) {
+	node := Node{}
+	c := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	node.RT = NewRoutingTable(c)
+	network := InitServer(&node)
+
+	_, err := network.handleIncomingRPCS(nil, "10.0.8.3")
+	assert.Equal(t, errors.New(errNilRPC), err)
+
+	_, err = network.handleIncomingRPCS(&RPC{}, "10.0.8.3")
+	assert.Equal(t, errors.New(errNoRPCType), err)
 }
 
 func TestReadUDPNoData(t *testing.T) {
@@ -318,3 +396,62 @@ func TestReadUDPNoData(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestReadUDPFloodingPeer(t *testing.T) {
+	node := Node{}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	config := DefaultServerConfig()
+	config.QueueSize = 5
+	config.PeerRate = 0.001
+	config.PeerBurst = 10
+	server := InitServerWithConfig(&node, config)
+	addr, _ := net.ResolveUDPAddr(udpNetwork, "127.0.0.1:9091")
+	server.conn, _ = net.ListenUDP(udpNetwork, addr)
+	defer server.conn.Close()
+
+	flooder, _ := net.DialUDP(udpNetwork, nil, addr)
+	defer flooder.Close()
+
+	rpc, _ := NewRPC(Ping, "00000000000000000000000000000000FFFFFFFF", "00000000000000000000000000000000FFFFFFFF", Payload{Contacts: []Contact{}})
+	data, _ := MarshalRPC(*rpc)
+	for i := 0; i < 30; i++ {
+		flooder.Write(data)
+	}
+
+	// no workers are running so only QueueSize packets fit in the queue
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, server.readUDP())
+	}
+
+	stats := server.Stats()
+	assert.Equal(t, uint64(30), stats.Received)
+	assert.Equal(t, uint64(20), stats.RateLimited)
+	assert.Equal(t, uint64(5), stats.QueueFull)
+	assert.Equal(t, 5, len(server.incoming))
+
+	// rate limited packets are dropped without a reply
+	assert.Equal(t, 0, len(server.outgoing))
+}
+
+func TestReadUDPBannedPeer(t *testing.T) {
+	node := Node{}
+	config := DefaultServerConfig()
+	config.BanList = []string{"127.0.0.1"}
+	server := InitServerWithConfig(&node, config)
+	addr, _ := net.ResolveUDPAddr(udpNetwork, "127.0.0.1:9092")
+	server.conn, _ = net.ListenUDP(udpNetwork, addr)
+	defer server.conn.Close()
+
+	server.conn.WriteToUDP([]byte("{}"), addr)
+	err := server.readUDP()
+
+	// dropped packets are only counted
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), server.Stats().Banned)
+	assert.Equal(t, 0, len(server.incoming))
+
+	server.Unban("127.0.0.1")
+	assert.False(t, server.IsBanned("127.0.0.1"))
+	server.Ban("127.0.0.1")
+	assert.True(t, server.IsBanned("127.0.0.1"))
+}
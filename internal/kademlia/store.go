@@ -0,0 +1,68 @@
+package kademlia
+
+import (
+	"errors"
+)
+
+// DefaultWriteQuorum the number of nodes which must acknowledge a StoreValue
+// unless another write quorum is set
+const DefaultWriteQuorum int = 1
+
+// EnvWriteQuorum is the environment variable holding the write quorum of the node
+const EnvWriteQuorum string = "KADEMLIA_WRITE_QUORUM"
+
+const errWriteQuorum string = "write quorum not met"
+
+// StoreAck is a node a STORE RPC was sent to, with the error the node failed with
+type StoreAck struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Error   string `json:"error,omitempty"`
+}
+
+// StoreResult lists the nodes which acknowledged storing the value under `Key`
+// and the nodes which failed to. The store succeeded if at least `Quorum` nodes
+// acknowledged it.
+type StoreResult struct {
+	Key    string     `json:"key"`
+	Quorum int        `json:"quorum"`
+	Acked  []StoreAck `json:"acked"`
+	Failed []StoreAck `json:"failed"`
+}
+
+func newStoreResult(key string, quorum int) *StoreResult {
+	return &StoreResult{Key: key, Quorum: quorum, Acked: []StoreAck{}, Failed: []StoreAck{}}
+}
+
+// add records the reply of `contact` to a STORE RPC
+func (result *StoreResult) add(contact Contact, err error) {
+	ack := StoreAck{ID: contact.ID.String(), Address: contact.Address}
+	if err != nil {
+		ack.Error = err.Error()
+		result.Failed = append(result.Failed, ack)
+	} else {
+		result.Acked = append(result.Acked, ack)
+	}
+}
+
+// check returns an error if fewer nodes than the quorum acknowledged the store
+func (result *StoreResult) check() error {
+	if len(result.Acked) < result.Quorum {
+		return errors.New(errWriteQuorum)
+	}
+	return nil
+}
+
+// SetWriteQuorum sets the number of nodes which must acknowledge a StoreValue.
+// A quorum below 1 restores the DefaultWriteQuorum.
+func (kademlia *Node) SetWriteQuorum(quorum int) {
+	kademlia.writeQuorum = quorum
+}
+
+// WriteQuorum returns the number of nodes which must acknowledge a StoreValue
+func (kademlia *Node) WriteQuorum() int {
+	if kademlia.writeQuorum < 1 {
+		return DefaultWriteQuorum
+	}
+	return kademlia.writeQuorum
+}
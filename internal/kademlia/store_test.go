@@ -0,0 +1,57 @@
+package kademlia
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreValueWithQuorum(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080")
+	storeErr := error(nil)
+
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		if *message.rpc.Type == Store && storeErr != nil {
+			return Message{message.receiver, RPC{}, storeErr}
+		}
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{Contacts: []Contact{}})
+		return Message{message.receiver, *reply, nil}
+	})
+
+	result, err := node.StoreValue("there")
+	assert.NoError(t, err)
+	assert.Equal(t, "490528f36debf7c15cea5e9a9d1ea024cf6b2921", result.Key)
+	assert.Equal(t, DefaultWriteQuorum, result.Quorum)
+	assert.Equal(t, []StoreAck{{ID: peer.ID.String(), Address: peer.Address}}, result.Acked)
+	assert.Empty(t, result.Failed)
+
+	result, err = node.StoreValueWithQuorum("there", 2)
+	assert.EqualError(t, err, errWriteQuorum)
+	assert.Equal(t, 1, len(result.Acked))
+
+	result, err = node.StoreValue(strings.Repeat("a", MaxDataSize+1))
+	assert.EqualError(t, err, errValueTooLarge)
+	assert.Nil(t, result)
+
+	storeErr = &RPCError{Conflict, errDeletedValue}
+	result, err = node.StoreValue("there")
+	assert.EqualError(t, err, errWriteQuorum)
+	assert.Empty(t, result.Acked)
+	assert.Equal(t, []StoreAck{{ID: peer.ID.String(), Address: peer.Address, Error: storeErr.Error()}}, result.Failed)
+}
+
+func TestWriteQuorum(t *testing.T) {
+	node := Node{}
+	assert.Equal(t, DefaultWriteQuorum, node.WriteQuorum())
+
+	node.SetWriteQuorum(3)
+	assert.Equal(t, 3, node.WriteQuorum())
+
+	node.SetWriteQuorum(0)
+	assert.Equal(t, DefaultWriteQuorum, node.WriteQuorum())
+}
@@ -0,0 +1,47 @@
+package kademlia
+
+import (
+	"strconv"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// Span attributes recorded by the node, client and server
+const (
+	attrTarget      string = "kademlia.target"
+	attrKey         string = "kademlia.key"
+	attrPeerID      string = "kademlia.peer.id"
+	attrPeerAddress string = "kademlia.peer.address"
+	attrRPCID       string = "kademlia.rpc.id"
+	attrResult      string = "kademlia.result"
+	attrHops        string = "kademlia.hops"
+	attrContacts    string = "kademlia.contacts"
+)
+
+// SetTracer makes the node record spans of its lookups and of the RPCs
+// it handles with `tracer`. A nil tracer disables tracing.
+func (kademlia *Node) SetTracer(tracer *tracing.Tracer) {
+	kademlia.tracer = tracer
+}
+
+// describe returns a short description of what a reply contains
+func (rpc *RPC) describe() string {
+	switch {
+	case rpc.Type != nil && *rpc.Type == Error && rpc.Error != nil:
+		return rpc.Error.Error()
+	case rpc.Payload == nil:
+		return "empty"
+	case rpc.Payload.Record != nil && rpc.Payload.Record.Deleted:
+		return "tombstone"
+	case rpc.Payload.Record != nil:
+		return "record version " + strconv.FormatUint(rpc.Payload.Record.Version, 10)
+	case rpc.Payload.Value != nil && *rpc.Payload.Value != "":
+		return "value"
+	case rpc.Payload.Entries != nil:
+		return strconv.Itoa(len(rpc.Payload.Entries)) + " entries"
+	case len(rpc.Payload.Providers) > 0:
+		return strconv.Itoa(len(rpc.Payload.Providers)) + " providers"
+	default:
+		return strconv.Itoa(len(rpc.Payload.Contacts)) + " contacts"
+	}
+}
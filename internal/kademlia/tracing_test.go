@@ -0,0 +1,99 @@
+package kademlia
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// recordingExporter keeps every exported span in memory
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []*tracing.Span
+}
+
+func (exporter *recordingExporter) Export(span *tracing.Span) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	exporter.spans = append(exporter.spans, span)
+	return nil
+}
+
+func (exporter *recordingExporter) Close() error {
+	return nil
+}
+
+func TestSendMessageTraced(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := tracing.NewTracer("kademlia", "node1", exporter)
+	lookup := tracer.Start("NodeLookup", tracing.Internal, nil)
+
+	client := Client{send: make(chan Message), resp: make(chan Message)}
+	contact := NewContact(NewNodeID("1111111100000000000000000000000000000000"), "10.0.8.2:8080")
+	sender := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+
+	go func() {
+		message := <-client.send
+		reply, _ := NewRPC(OK, contact.ID.String(), sender.ID.String(), Payload{Contacts: []Contact{sender}})
+		client.resp <- Message{message.receiver, *reply, nil}
+
+		message = <-client.send
+		client.resp <- Message{message.receiver, RPC{}, errors.New(errNoReply)}
+	}()
+
+	_, err := client.withSpan(lookup).SendFindContactMessage(&contact, &sender, contact.ID)
+	assert.NoError(t, err)
+	_, err = client.withSpan(lookup).SendPingMessage(&contact, &sender)
+	assert.Error(t, err)
+
+	assert.Equal(t, 2, len(exporter.spans))
+	found := exporter.spans[0]
+	assert.Equal(t, "FIND_NODE", found.Name)
+	assert.Equal(t, lookup.TraceID(), found.TraceID())
+	assert.Equal(t, lookup.Context.SpanID, found.ParentSpanID)
+	assert.Equal(t, contact.ID.String(), found.Attributes[attrPeerID])
+	assert.Equal(t, "1 contacts", found.Attributes[attrResult])
+
+	ping := exporter.spans[1]
+	assert.Equal(t, "PING", ping.Name)
+	assert.Equal(t, errNoReply, ping.Err)
+
+	// the untraced client never sends a trace
+	assert.Nil(t, client.span)
+}
+
+func TestServerRecordsTracedRPC(t *testing.T) {
+	exporter := &recordingExporter{}
+	node := Node{content: make(map[string]string)}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	node.SetTracer(tracing.NewTracer("kademlia", "node1", exporter))
+	server := InitServer(&node)
+
+	parent := tracing.NewTracer("kademlia", "node2", &recordingExporter{}).Start("FIND_NODE", tracing.Client, nil)
+	rpc, _ := NewRPC(FindNode, "1111111100000000000000000000000000000000", "1111111100000000000000000000000000000000", Payload{})
+	rpc.Trace = parent.SpanContext()
+
+	server.incoming <- packet{rpc, "10.0.8.2", nil}
+	server.readIncomingChannel()
+	<-server.outgoing
+
+	assert.Equal(t, 1, len(exporter.spans))
+	span := exporter.spans[0]
+	assert.Equal(t, "handle FIND_NODE", span.Name)
+	assert.Equal(t, tracing.Server, span.Kind)
+	assert.Equal(t, parent.TraceID(), span.TraceID())
+	assert.Equal(t, parent.Context.SpanID, span.ParentSpanID)
+	assert.Equal(t, "0 contacts", span.Attributes[attrResult])
+
+	// untraced RPCs record no spans
+	rpc, _ = NewRPC(FindNode, "1111111100000000000000000000000000000000", "1111111100000000000000000000000000000000", Payload{})
+	server.incoming <- packet{rpc, "10.0.8.2", nil}
+	server.readIncomingChannel()
+	<-server.outgoing
+
+	assert.Equal(t, 1, len(exporter.spans))
+}
@@ -0,0 +1,223 @@
+package kademlia
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// treeNode is a node of a TreeTable. Leaves hold the bucket of the IDs starting
+// with the first `depth` bits of `prefix`, inner nodes a child for each value
+// of the next bit.
+type treeNode struct {
+	prefix   *NodeID
+	depth    int
+	bucket   *bucket
+	children [2]*treeNode
+}
+
+// TreeTable is a routing table keeping its buckets as the leaves of a binary
+// tree, as in the Kademlia paper. It starts with one bucket covering the whole
+// ID space and splits full buckets whose range covers the ID of the node. A full
+// bucket not covering it is split too if the new contact is among the k closest
+// to the node, so the table keeps the contacts of the smallest subtree around
+// the node holding k contacts even if the tree is unbalanced.
+type TreeTable struct {
+	me        Contact
+	root      *treeNode
+	penalties penalties
+	mutex     sync.RWMutex
+}
+
+// NewTreeRoutingTable returns a new instance of a TreeTable for IDs as wide as the ID of `me`
+func NewTreeRoutingTable(me Contact) *TreeTable {
+	return &TreeTable{
+		me:        me,
+		root:      &treeNode{prefix: &NodeID{length: me.ID.length}, bucket: newBucket()},
+		penalties: make(penalties),
+	}
+}
+
+// leaf returns the leaf whose bucket covers `id`
+func (node *treeNode) leaf(id *NodeID) *treeNode {
+	for node.bucket == nil {
+		node = node.children[id.bit(node.depth)]
+	}
+	return node
+}
+
+// split turns the leaf into an inner node, moving the contacts of its bucket
+// to the buckets of its children without changing their order
+func (node *treeNode) split() {
+	for bit := range node.children {
+		prefix := *node.prefix
+		prefix.setBit(node.depth, bit)
+		node.children[bit] = &treeNode{prefix: &prefix, depth: node.depth + 1, bucket: newBucket()}
+	}
+
+	for e := node.bucket.list.Back(); e != nil; e = e.Prev() {
+		contact := e.Value.(Contact)
+		child := node.children[contact.ID.bit(node.depth)].bucket
+		child.list.PushFront(contact)
+		child.lastSeen[*contact.ID] = node.bucket.lastSeen[*contact.ID]
+	}
+	node.bucket = nil
+}
+
+// closest appends the contacts of the subtree to `contacts` in order of their
+// distance to `target` until there are `count` contacts. Every ID in the child
+// sharing the next bit with the target is closer than the IDs in the other one.
+func (node *treeNode) closest(target *NodeID, count int, contacts []Contact) []Contact {
+	if len(contacts) >= count {
+		return contacts
+	}
+
+	if node.bucket != nil {
+		return appendClosest(contacts, ContactCandidates{node.bucket.GetContactAndCalcDistance(target)}, count)
+	}
+
+	bit := target.bit(node.depth)
+	contacts = node.children[bit].closest(target, count, contacts)
+	return node.children[1-bit].closest(target, count, contacts)
+}
+
+// leaves calls `visit` with every leaf from the lowest to the highest prefix
+func (node *treeNode) leaves(visit func(leaf *treeNode)) {
+	if node.bucket != nil {
+		visit(node)
+		return
+	}
+	node.children[0].leaves(visit)
+	node.children[1].leaves(visit)
+}
+
+// prefixString returns the bits shared by the IDs in the leaf
+func (node *treeNode) prefixString() string {
+	var prefix strings.Builder
+	for i := 0; i < node.depth; i++ {
+		prefix.WriteByte('0' + byte(node.prefix.bit(i)))
+	}
+	return prefix.String()
+}
+
+// splittable returns true if `leaf` may be split to make space for `contact`.
+// The mutex must be held.
+func (routingTable *TreeTable) splittable(leaf *treeNode, contact Contact) bool {
+	if leaf.depth >= routingTable.Bits() {
+		return false
+	} else if routingTable.root.leaf(routingTable.me.ID) == leaf {
+		return true
+	}
+
+	closest := routingTable.root.closest(routingTable.me.ID, BucketSize, nil)
+	return len(closest) < BucketSize ||
+		contact.ID.CalcDistance(routingTable.me.ID).Less(closest[len(closest)-1].distance)
+}
+
+// AddContact adds a new contact to the bucket covering it, splitting the bucket
+// if it is full and may be split, unless the contact is penalized or its ID has
+// another width
+func (routingTable *TreeTable) AddContact(contact Contact) {
+	routingTable.mutex.Lock()
+	defer routingTable.mutex.Unlock()
+
+	if contact.ID.Len() != routingTable.me.ID.Len() || routingTable.penalties.blocks(contact.ID) {
+		return
+	}
+
+	for {
+		leaf := routingTable.root.leaf(contact.ID)
+		if leaf.bucket.Len() < BucketSize || leaf.bucket.Contains(contact) || !routingTable.splittable(leaf, contact) {
+			leaf.bucket.AddContact(contact)
+			return
+		}
+		leaf.split()
+	}
+}
+
+// RemoveContact removes a dead contact from its bucket
+func (routingTable *TreeTable) RemoveContact(contact Contact) {
+	routingTable.mutex.Lock()
+	defer routingTable.mutex.Unlock()
+
+	routingTable.root.leaf(contact.ID).bucket.RemoveContact(contact)
+}
+
+// Penalize removes a misbehaving contact from its bucket and keeps
+// it from being added again for `duration`
+func (routingTable *TreeTable) Penalize(contact Contact, duration time.Duration) {
+	routingTable.mutex.Lock()
+	defer routingTable.mutex.Unlock()
+
+	routingTable.penalties[*contact.ID] = time.Now().Add(duration)
+	routingTable.root.leaf(contact.ID).bucket.RemoveContact(contact)
+}
+
+// Contains returns true if the contact is in its bucket
+func (routingTable *TreeTable) Contains(contact Contact) bool {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	return routingTable.root.leaf(contact.ID).bucket.Contains(contact)
+}
+
+func (routingTable *TreeTable) evictionCandidate(contact Contact) *Contact {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	leaf := routingTable.root.leaf(contact.ID)
+	if leaf.bucket.Len() < BucketSize || leaf.bucket.Contains(contact) || routingTable.splittable(leaf, contact) {
+		return nil
+	}
+	return leaf.bucket.GetFirst()
+}
+
+// FindClosestContacts finds the count closest Contacts to the target in the RoutingTable
+func (routingTable *TreeTable) FindClosestContacts(target *NodeID, count int) []Contact {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	return routingTable.root.closest(target, count, nil)
+}
+
+// Buckets returns the contacts of every non empty bucket from the lowest to the
+// highest prefix, in the order they are kept in the bucket
+func (routingTable *TreeTable) Buckets() []BucketInfo {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	buckets := []BucketInfo{}
+	index := 0
+	routingTable.root.leaves(func(leaf *treeNode) {
+		if leaf.bucket.Len() > 0 {
+			buckets = append(buckets, newBucketInfo(index, leaf.prefixString(), leaf.bucket))
+		}
+		index++
+	})
+	return buckets
+}
+
+// BucketSizes returns the number of contacts in each bucket from the lowest to the highest prefix
+func (routingTable *TreeTable) BucketSizes() []int {
+	routingTable.mutex.RLock()
+	defer routingTable.mutex.RUnlock()
+
+	sizes := []int{}
+	routingTable.root.leaves(func(leaf *treeNode) {
+		sizes = append(sizes, leaf.bucket.Len())
+	})
+	return sizes
+}
+
+func (routingTable *TreeTable) GetMe() *Contact {
+	return &routingTable.me
+}
+
+func (routingTable *TreeTable) GetMeID() *NodeID {
+	return routingTable.me.ID
+}
+
+// Bits returns the number of bits in the IDs of the routing table
+func (routingTable *TreeTable) Bits() int {
+	return routingTable.me.ID.Bits()
+}
@@ -0,0 +1,81 @@
+package kademlia
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeRoutingTableSplits(t *testing.T) {
+	rt := NewTreeRoutingTable(NewContact(NewNodeID("0000000000000000000000000000000000000000"), "localhost:8000"))
+	assert.Equal(t, []int{0}, rt.BucketSizes())
+
+	for _, id := range []string{"90", "91", "92", "93", "94"} {
+		rt.AddContact(NewContact(NewNodeID(id), "localhost:8001"))
+	}
+	assert.Equal(t, []int{5}, rt.BucketSizes())
+
+	// the full bucket covering the own ID is split, the contact further away
+	// than the k closest does not fit in the bucket of the other half
+	far := NewContact(NewNodeID("C0"), "localhost:8001")
+	rt.AddContact(far)
+	assert.False(t, rt.Contains(far))
+	assert.Equal(t, []int{0, 5}, rt.BucketSizes())
+
+	// buckets not covering the own ID are split for contacts among the k closest
+	near := NewContact(NewNodeID("80"), "localhost:8001")
+	assert.Nil(t, rt.evictionCandidate(near))
+	rt.AddContact(near)
+	assert.True(t, rt.Contains(near))
+	assert.Equal(t, []int{0, 1, 5, 0, 0}, rt.BucketSizes())
+
+	buckets := rt.Buckets()
+	assert.Equal(t, "1000", buckets[0].Prefix)
+	assert.Equal(t, "1001", buckets[1].Prefix)
+	assert.NotNil(t, rt.evictionCandidate(NewContact(NewNodeID("95"), "localhost:8001")))
+
+	rt.RemoveContact(near)
+	assert.False(t, rt.Contains(near))
+}
+
+func TestTreeRoutingTableFindClosestContacts(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for _, bits := range []int{IDLength * 8, MaxIDLength * 8} {
+		rt := NewTreeRoutingTable(randomContact(random, bits))
+		for i := 0; i < 1000; i++ {
+			rt.AddContact(randomContact(random, bits))
+		}
+
+		for i := 0; i < 100; i++ {
+			target := randomContact(random, bits).ID
+			assert.Equal(t, bruteForceClosest(rt, target, BucketSize), rt.FindClosestContacts(target, BucketSize))
+		}
+
+		// every contact of the smallest subtree around the node holding k contacts is kept
+		me := rt.GetMeID()
+		assert.Equal(t, BucketSize, len(rt.FindClosestContacts(me, BucketSize)))
+	}
+}
+
+func TestNewRoutingTableOfKind(t *testing.T) {
+	me := NewContact(NewNodeID("FFFFFFFF00000000000000000000000000000000"), "localhost:8000")
+
+	rt, err := NewRoutingTableOfKind(TreeRoutingTable, me)
+	assert.NoError(t, err)
+	assert.IsType(t, &TreeTable{}, rt)
+
+	rt, err = NewRoutingTableOfKind("", me)
+	assert.NoError(t, err)
+	assert.IsType(t, &BucketTable{}, rt)
+
+	_, err = NewRoutingTableOfKind("list", me)
+	assert.EqualError(t, err, errUnknownRoutingTable)
+
+	node := Node{}
+	assert.Equal(t, BucketRoutingTable, node.RoutingTableKind())
+	assert.NoError(t, node.SetRoutingTable(TreeRoutingTable))
+	assert.Equal(t, TreeRoutingTable, node.RoutingTableKind())
+	assert.Error(t, node.SetRoutingTable("list"))
+}
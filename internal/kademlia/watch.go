@@ -0,0 +1,292 @@
+package kademlia
+
+import (
+	"errors"
+	"time"
+
+	"github.com/viktorfrom/d7024e-kademlia/internal/logger"
+	"github.com/viktorfrom/d7024e-kademlia/internal/tracing"
+)
+
+// EventKind type definition
+type EventKind string
+
+// EventKind declaration, what happened to a watched key on a node storing it
+const (
+	// EventStored a value or record was stored under the key for the first time
+	EventStored = EventKind("stored")
+	// EventRestored the value or record under the key was stored again or updated
+	EventRestored = EventKind("restored")
+	// EventDeleted a tombstone was stored under the key
+	EventDeleted = EventKind("deleted")
+	// EventExpired the value or record under the key expired
+	EventExpired = EventKind("expired")
+)
+
+// WatchTTL the number of seconds a node keeps a watcher of a key unless the
+// watcher registers again
+const WatchTTL int64 = 60
+
+// MaxWatchers the largest number of watchers a node keeps for a key
+const MaxWatchers int = 100
+
+// maxWatchedOn the largest number of nodes a watch is kept registered with. A watch
+// registers with the k closest nodes on every renewal and a registration lasts two
+// renewals.
+const maxWatchedOn int = BucketSize * 2
+
+// watchBuffer the number of events a Watch buffers before further events are dropped
+const watchBuffer = 16
+
+// watchRenewal how often a node registers again for the keys it watches
+const watchRenewal = time.Duration(WatchTTL/2) * time.Second
+
+// duplicateWindow how long an event equal to the last event of a Watch is
+// ignored, as every node storing the key sends it
+const duplicateWindow = updateTimer * time.Second
+
+const (
+	errBadEvent   string = "unknown event"
+	errNoEvent    string = "no event given"
+	errNotWatched string = "key is not watched on the sender"
+)
+
+// WatchEvent tells that `Kind` happened to `Key` on the node with the ID `Node`.
+// `Value` is the data stored under the key for stored and restored events.
+type WatchEvent struct {
+	Key      string    `json:"key"`
+	Kind     EventKind `json:"kind"`
+	Value    string    `json:"value,omitempty"`
+	Node     string    `json:"node"`
+	Received time.Time `json:"received"`
+}
+
+// Watch receives the events of a key on `Events` until it is closed. Events
+// arriving while the buffer of `Events` is full are dropped.
+type Watch struct {
+	Events chan WatchEvent
+	key    string
+	node   *Node
+	last   *WatchEvent
+}
+
+func validateEventKind(kind EventKind) error {
+	switch kind {
+	case EventStored, EventRestored, EventDeleted, EventExpired:
+		return nil
+	}
+	return errors.New(errBadEvent)
+}
+
+// addLocalWatcher keeps `contact` as a watcher of `key` for `ttl` seconds. Returns
+// an error if the key has MaxWatchers other watchers.
+func (kademlia *Node) addLocalWatcher(key string, contact Contact, ttl int64) error {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.watchers == nil {
+		kademlia.watchers = make(leases)
+	}
+	return kademlia.watchers.add(key, contact, ttl, MaxWatchers)
+}
+
+// localWatchers returns the watchers of `key` which have not expired
+func (kademlia *Node) localWatchers(key string) []Contact {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	return kademlia.watchers.list(key)
+}
+
+// removeLocalWatcher stops notifying `contact` of the events of `key`
+func (kademlia *Node) removeLocalWatcher(key string, contact Contact) {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	delete(kademlia.watchers[key], *contact.ID)
+}
+
+// addWatchedOn records that the watch of `key` is registered with `contact` for `ttl` seconds
+func (kademlia *Node) addWatchedOn(key string, contact Contact, ttl int64) error {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if kademlia.watchedOn == nil {
+		kademlia.watchedOn = make(leases)
+	}
+	return kademlia.watchedOn.add(key, contact, ttl, maxWatchedOn)
+}
+
+// isWatchedOn returns true if the watch of `key` is registered with `sender`, the
+// node with its ID sending from the address the watch was registered at
+func (kademlia *Node) isWatchedOn(key string, sender Contact) bool {
+	kademlia.contentMutex.RLock()
+	defer kademlia.contentMutex.RUnlock()
+
+	entry, exists := kademlia.watchedOn[key][*sender.ID]
+	return exists && entry.expires.After(time.Now()) && entry.contact.Address == sender.Address
+}
+
+// deliverEvent passes `event` to every Watch of the node on its key, unless
+// it equals the last event the Watch received within the duplicateWindow
+func (kademlia *Node) deliverEvent(event WatchEvent) {
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	for watch := range kademlia.watches[event.Key] {
+		if last := watch.last; last != nil && last.Kind == event.Kind && last.Value == event.Value &&
+			event.Received.Sub(last.Received) < duplicateWindow {
+			continue
+		}
+
+		select {
+		case watch.Events <- event:
+			watch.last = &event
+		default:
+			kademlia.logger.WithField(logger.FieldKey, event.Key).Warn("watch buffer is full, event dropped")
+		}
+	}
+}
+
+// notifyWatchers sends a NOTIFY RPC with `kind` and `value` to every watcher of
+// `key`. Watchers failing to respond are not notified again.
+func (kademlia *Node) notifyWatchers(key string, kind EventKind, value string) {
+	watchers := kademlia.localWatchers(key)
+	if len(watchers) == 0 {
+		return
+	}
+
+	me := kademlia.RT.GetMe()
+	for _, watcher := range watchers {
+		if watcher.ID.Equals(me.ID) {
+			kademlia.deliverEvent(WatchEvent{key, kind, value, me.ID.String(), time.Now()})
+			continue
+		}
+
+		_, err := kademlia.client.SendNotifyMessage(&watcher, me, key, kind, value)
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: watcher.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeLocalWatcher(key, watcher)
+		}
+	}
+}
+
+// Watch registers the node as a watcher of `key` on the k closest nodes and keeps
+// registering again every WatchTTL/2 seconds until the returned Watch is closed.
+// The nodes storing `key` send an event when a value or record is stored under it,
+// stored again, deleted or expires. Returns the first error a node replied with if
+// no node registered the watch.
+func (kademlia *Node) Watch(key string) (*Watch, error) {
+	key = normalizeKey(key)
+	_, _, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	watch := &Watch{make(chan WatchEvent, watchBuffer), key, kademlia, nil}
+
+	kademlia.contentMutex.Lock()
+	if kademlia.watches == nil {
+		kademlia.watches = make(map[string]map[*Watch]bool)
+	}
+	if kademlia.watches[key] == nil {
+		kademlia.watches[key] = make(map[*Watch]bool)
+	}
+	kademlia.watches[key][watch] = true
+	kademlia.contentMutex.Unlock()
+
+	err = kademlia.registerWatch(key)
+	if err != nil {
+		watch.Close()
+		return nil, err
+	}
+	return watch, nil
+}
+
+// Close stops the watch from receiving events and closes `Events`. The node stops
+// registering again once it has no watches on the key, its watcher records then
+// expire after WatchTTL seconds.
+func (watch *Watch) Close() {
+	kademlia := watch.node
+	kademlia.contentMutex.Lock()
+	defer kademlia.contentMutex.Unlock()
+
+	if !kademlia.watches[watch.key][watch] {
+		return
+	}
+
+	delete(kademlia.watches[watch.key], watch)
+	if len(kademlia.watches[watch.key]) == 0 {
+		delete(kademlia.watches, watch.key)
+		delete(kademlia.watchedOn, watch.key)
+	}
+	close(watch.Events)
+}
+
+// registerWatch stores the node as a watcher of `key` locally and on the k closest nodes
+func (kademlia *Node) registerWatch(key string) error {
+	span := kademlia.tracer.Start("Watch", tracing.Internal, nil)
+	defer span.End()
+	span.SetAttribute(attrKey, key)
+
+	err := kademlia.addLocalWatcher(key, *kademlia.RT.GetMe(), WatchTTL)
+	if err != nil {
+		kademlia.logger.WithField(logger.FieldKey, key).Warn(err)
+	}
+
+	lookupSpan := span.Start("NodeLookup", tracing.Internal)
+	nodes := kademlia.nodeLookup(kademlia.keyID(key), lookupSpan, nil)
+	lookupSpan.End()
+
+	var firstErr error
+	registered := 0
+
+	client := kademlia.client.withSpan(span)
+	for _, node := range nodes {
+		_, err := client.SendWatchMessage(&node, kademlia.RT.GetMe(), key, WatchTTL)
+
+		if err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+			kademlia.removeUnresponsive(node, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else if err := kademlia.addWatchedOn(key, node, WatchTTL); err != nil {
+			kademlia.logger.WithFields(logger.Fields{
+				logger.FieldPeerID: node.ID.String(),
+				logger.FieldKey:    key,
+			}).Warn(err)
+		} else {
+			registered++
+		}
+	}
+
+	if registered == 0 && firstErr != nil {
+		span.SetError(firstErr)
+		return firstErr
+	}
+	return nil
+}
+
+// renewWatches registers the node again for every key it has watches on
+func (kademlia *Node) renewWatches() {
+	kademlia.contentMutex.RLock()
+	keys := []string{}
+	for key := range kademlia.watches {
+		keys = append(keys, key)
+	}
+	kademlia.contentMutex.RUnlock()
+
+	for _, key := range keys {
+		err := kademlia.registerWatch(key)
+		if err != nil {
+			kademlia.logger.WithField(logger.FieldKey, key).Warn(err)
+		}
+	}
+}
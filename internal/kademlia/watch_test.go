@@ -0,0 +1,170 @@
+package kademlia
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEventKind(t *testing.T) {
+	for _, kind := range []EventKind{EventStored, EventRestored, EventDeleted, EventExpired} {
+		assert.NoError(t, validateEventKind(kind))
+	}
+	assert.EqualError(t, validateEventKind("moved"), errBadEvent)
+}
+
+func TestWatchersAreNotified(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	sender := "1111111100000000000000000000000000000000"
+
+	notified := make(chan RPC, 10)
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.client = newFakeClient(func(message Message) Message {
+		notified <- message.rpc
+		reply, _ := NewRPC(OK, sender, me.ID.String(), Payload{})
+		return Message{message.receiver, *reply, nil}
+	})
+	server := InitServer(&node)
+
+	key := "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+	ttl := WatchTTL
+	rpc, _ := NewRPC(AddWatcher, sender, sender, Payload{Key: &key, TTL: &ttl})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	assert.Equal(t, []Contact{NewContact(NewNodeID(sender), "10.0.8.2:8080")}, node.localWatchers(key))
+
+	expect := func(kind EventKind, value string) {
+		select {
+		case rpc := <-notified:
+			assert.Equal(t, Notify, *rpc.Type)
+			assert.Equal(t, key, *rpc.Payload.Key)
+			assert.Equal(t, kind, *rpc.Payload.Event)
+			assert.Equal(t, value, *rpc.Payload.Value)
+		case <-time.After(time.Second):
+			t.Fatal("watcher was not notified of", kind)
+		}
+	}
+
+	value := "1600000000:test"
+	for _, kind := range []EventKind{EventStored, EventRestored} {
+		rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Value: &value})
+		_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+		assert.NoError(t, err)
+		expect(kind, "test")
+	}
+
+	node.updateContent()
+	expect(EventExpired, "")
+
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Value: &value})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	expect(EventStored, "test")
+
+	tombstone := Record{Publisher: sender, Timestamp: time.Now().UnixNano(), Deleted: true, Resolution: LastWriterWins}
+	rpc, _ = NewRPC(Store, sender, sender, Payload{Key: &key, Record: &tombstone})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.NoError(t, err)
+	expect(EventDeleted, "")
+
+	// watchers failing to respond are not notified again
+	unresponsive := Node{content: make(map[string]string), deadline: 10}
+	unresponsive.RT = NewRoutingTable(me)
+	unresponsive.client = newFakeClient(func(message Message) Message {
+		return Message{message.receiver, RPC{}, assert.AnError}
+	})
+	unresponsive.addLocalWatcher(key, NewContact(NewNodeID(sender), "10.0.8.2:8080"), WatchTTL)
+	unresponsive.notifyWatchers(key, EventRestored, "")
+	assert.Empty(t, unresponsive.localWatchers(key))
+}
+
+func TestIncomingNotifyRPC(t *testing.T) {
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080"))
+	server := InitServer(&node)
+
+	key := "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+	watch := &Watch{make(chan WatchEvent, 2), key, &node, nil}
+	node.watches = map[string]map[*Watch]bool{key: {watch: true}}
+
+	sender := "1111111100000000000000000000000000000000"
+	value := "test"
+	kind := EventStored
+
+	// events from nodes the watch did not register with are refused
+	rpc, _ := NewRPC(Notify, sender, sender, Payload{Key: &key, Value: &value, Event: &kind})
+	_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNotWatched)
+	assert.Empty(t, watch.Events)
+
+	assert.NoError(t, node.addWatchedOn(key, NewContact(NewNodeID(sender), "10.0.8.2:8080"), WatchTTL))
+
+	// nor from a node claiming the ID of one it registered with
+	rpc, _ = NewRPC(Notify, sender, sender, Payload{Key: &key, Value: &value, Event: &kind})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.9")
+	assert.EqualError(t, err, errNotWatched)
+	assert.Empty(t, watch.Events)
+
+	upper := strings.ToUpper(key)
+	for i := 0; i < 2; i++ {
+		rpc, _ := NewRPC(Notify, sender, sender, Payload{Key: &upper, Value: &value, Event: &kind})
+		_, err := server.handleIncomingRPCS(rpc, "10.0.8.2")
+		assert.NoError(t, err)
+	}
+
+	// the second node storing the key sends the same event
+	event := <-watch.Events
+	assert.Equal(t, WatchEvent{key, EventStored, "test", sender, event.Received}, event)
+	assert.Empty(t, watch.Events)
+
+	bad := EventKind("moved")
+	rpc, _ = NewRPC(Notify, sender, sender, Payload{Key: &key, Value: &value, Event: &bad})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errBadEvent)
+
+	rpc, _ = NewRPC(Notify, sender, sender, Payload{Key: &key, Value: &value})
+	_, err = server.handleIncomingRPCS(rpc, "10.0.8.2")
+	assert.EqualError(t, err, errNoEvent)
+}
+
+func TestWatch(t *testing.T) {
+	me := NewContact(NewNodeID("00000000000000000000000000000000FFFFFFFF"), "10.0.8.1:8080")
+	peer := NewContact(NewNodeID("a94a8fe5ccb19ba61c4c0873d391e987982fbbd2"), "10.0.8.2:8080")
+	key := "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+
+	sent := []RPCType{}
+	node := Node{content: make(map[string]string), deadline: 10}
+	node.RT = NewRoutingTable(me)
+	node.RT.AddContact(peer)
+	node.client = newFakeClient(func(message Message) Message {
+		sent = append(sent, *message.rpc.Type)
+		reply, _ := NewRPC(OK, peer.ID.String(), me.ID.String(), Payload{})
+		return Message{message.receiver, *reply, nil}
+	})
+
+	watch, err := node.Watch(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []RPCType{FindNode, AddWatcher}, sent)
+	assert.True(t, node.isWatchedOn(key, peer))
+	assert.False(t, node.isWatchedOn(key, NewContact(NewNodeID("1111111100000000000000000000000000000000"), peer.Address)))
+	assert.False(t, node.isWatchedOn(key, NewContact(peer.ID, "10.0.8.9:8080")))
+
+	// the node notifies itself if it stores the key
+	node.notifyWatchers(key, EventStored, "test")
+	assert.Equal(t, "test", (<-watch.Events).Value)
+
+	watch.Close()
+	_, open := <-watch.Events
+	assert.False(t, open)
+	assert.False(t, node.isWatchedOn(key, peer))
+
+	sent = []RPCType{}
+	node.renewWatches()
+	assert.Empty(t, sent)
+
+	_, err = node.Watch("/bad")
+	assert.Error(t, err)
+}
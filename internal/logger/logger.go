@@ -1,7 +1,10 @@
 package logger
 
 import (
+	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -9,45 +12,177 @@ import (
 // DefaultLogFilename is the default filename for the logger
 const DefaultLogFilename string = "kademlia.log"
 
-// Logger is a wrapper around the logrus logger
+// Field names used by the node components
+const (
+	FieldComponent string = "component"
+	FieldNodeID    string = "node"
+	FieldPeerID    string = "peer"
+	FieldRPCID     string = "rpc_id"
+	FieldRPCType   string = "rpc_type"
+	FieldKey       string = "key"
+	FieldTraceID   string = "trace_id"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	EnvLogLevel      string = "KADEMLIA_LOG_LEVEL"
+	EnvLogLevels     string = "KADEMLIA_LOG_LEVELS"
+	EnvLogFile       string = "KADEMLIA_LOG_FILE"
+	EnvLogJSON       string = "KADEMLIA_LOG_JSON"
+	EnvLogMaxSize    string = "KADEMLIA_LOG_MAX_SIZE"
+	EnvLogMaxBackups string = "KADEMLIA_LOG_MAX_BACKUPS"
+)
+
+// Fields is a set of structured fields added to every log entry
+type Fields = log.Fields
+
+// Config contains the settings of a Logger. `ComponentLevels` overrides `Level`
+// for the loggers returned by Component. If `MaxSize` is above zero the log file is
+// rotated when it grows above `MaxSize` bytes, keeping `MaxBackups` old files.
+type Config struct {
+	Level           log.Level
+	FileName        *string
+	Detailed        bool
+	JSON            bool
+	ComponentLevels map[string]log.Level
+	MaxSize         int64
+	MaxBackups      int
+}
+
+// Logger is a wrapper around the logrus logger. A nil Logger logs
+// to the standard logrus logger. `logger` is the root logger shared with
+// every child logger, `entry` carries the fields and level of this logger.
 type Logger struct {
 	logger *log.Logger
+	entry  *log.Entry
+	config Config
 }
 
 // New creates a new logger at the given `logLevel`. If `fileName` is
 // given it will output logs to file. Enable `detailed` for method origin in output.
 func New(logLevel log.Level, fileName *string, detailed bool) *Logger {
+	return NewWithConfig(Config{Level: logLevel, FileName: fileName, Detailed: detailed})
+}
+
+// NewWithConfig creates a new logger with the settings in `config`
+func NewWithConfig(config Config) *Logger {
 	baseLogger := log.New()
 
-	baseLogger.SetFormatter(&log.TextFormatter{})
-	baseLogger.SetLevel(logLevel)
-	baseLogger.SetReportCaller(detailed)
+	if config.JSON {
+		baseLogger.SetFormatter(&log.JSONFormatter{})
+	} else {
+		baseLogger.SetFormatter(&log.TextFormatter{})
+	}
+	baseLogger.SetLevel(config.Level)
+	baseLogger.SetReportCaller(config.Detailed)
 
-	if fileName != nil {
-		file, err := os.OpenFile(*fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if config.FileName != nil {
+		output, err := openOutput(*config.FileName, config.MaxSize, config.MaxBackups)
 		if err == nil {
-			baseLogger.SetOutput(file)
+			baseLogger.SetOutput(output)
 		} else {
 			baseLogger.Info("Failed to log to file, using default stderr")
 		}
 	}
 
-	logger := &Logger{baseLogger}
+	logger := &Logger{baseLogger, log.NewEntry(baseLogger), config}
 
 	return logger
 }
 
+func openOutput(fileName string, maxSize int64, maxBackups int) (io.Writer, error) {
+	if maxSize > 0 {
+		return newRotatingFile(fileName, maxSize, maxBackups)
+	}
+	return os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+}
+
+// ConfigFromEnv returns a Config read from the KADEMLIA_LOG_* environment variables.
+// KADEMLIA_LOG_LEVELS is a comma separated list of component=level pairs.
+func ConfigFromEnv() Config {
+	config := Config{Level: log.InfoLevel, ComponentLevels: make(map[string]log.Level)}
+
+	if level, err := log.ParseLevel(os.Getenv(EnvLogLevel)); err == nil {
+		config.Level = level
+	}
+
+	for _, pair := range strings.Split(os.Getenv(EnvLogLevels), ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if level, err := log.ParseLevel(parts[1]); err == nil {
+			config.ComponentLevels[strings.TrimSpace(parts[0])] = level
+		}
+	}
+
+	if fileName := os.Getenv(EnvLogFile); fileName != "" {
+		config.FileName = &fileName
+	}
+
+	config.JSON, _ = strconv.ParseBool(os.Getenv(EnvLogJSON))
+	config.MaxSize, _ = strconv.ParseInt(os.Getenv(EnvLogMaxSize), 10, 64)
+	config.MaxBackups, _ = strconv.Atoi(os.Getenv(EnvLogMaxBackups))
+
+	return config
+}
+
+func (logger *Logger) get() *log.Entry {
+	if logger == nil {
+		return log.NewEntry(log.StandardLogger())
+	}
+	return logger.entry
+}
+
+// WithField returns a child logger adding `key` with `value` to every entry
+func (logger *Logger) WithField(key string, value interface{}) *Logger {
+	return logger.WithFields(Fields{key: value})
+}
+
+// WithFields returns a child logger adding `fields` to every entry
+func (logger *Logger) WithFields(fields Fields) *Logger {
+	if logger == nil {
+		return &Logger{log.StandardLogger(), log.WithFields(fields), Config{}}
+	}
+	return &Logger{logger.logger, logger.entry.WithFields(fields), logger.config}
+}
+
+// Component returns a child logger for the component `name`. The child logs at
+// the level given for `name` in the ComponentLevels of the config if there is one.
+func (logger *Logger) Component(name string) *Logger {
+	if logger == nil {
+		return logger.WithField(FieldComponent, name)
+	}
+
+	base := logger.logger
+	if level, exists := logger.config.ComponentLevels[name]; exists {
+		base = log.New()
+		base.SetFormatter(logger.logger.Formatter)
+		base.SetOutput(logger.logger.Out)
+		base.SetReportCaller(logger.logger.ReportCaller)
+		base.SetLevel(level)
+	}
+
+	entry := log.NewEntry(base).WithFields(logger.entry.Data).WithField(FieldComponent, name)
+	return &Logger{logger.logger, entry, logger.config}
+}
+
+// Debug log debug level information
+func (logger *Logger) Debug(args ...interface{}) {
+	logger.get().Debug(args...)
+}
+
 // Info log info level information
 func (logger *Logger) Info(args ...interface{}) {
-	logger.logger.Info(args...)
+	logger.get().Info(args...)
 }
 
-// Warning log warning level information
+// Warn log warning level information
 func (logger *Logger) Warn(args ...interface{}) {
-	logger.logger.Warning(args...)
+	logger.get().Warning(args...)
 }
 
-// Error log warning level information
+// Error log error level information
 func (logger *Logger) Error(args ...interface{}) {
-	logger.logger.Error(args...)
+	logger.get().Error(args...)
 }
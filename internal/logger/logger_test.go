@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -57,3 +59,95 @@ func TestLogError(t *testing.T) {
 
 	os.Remove(filename)
 }
+
+func TestLogJSONWithFields(t *testing.T) {
+	filename := "json.log"
+	logger := NewWithConfig(Config{Level: log.InfoLevel, FileName: &filename, JSON: true})
+	logger.WithField(FieldNodeID, "ffff").WithFields(Fields{FieldRPCType: "PING"}).Info("json text here")
+
+	data, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, "json text here", entry["msg"])
+	assert.Equal(t, "ffff", entry[FieldNodeID])
+	assert.Equal(t, "PING", entry[FieldRPCType])
+
+	os.Remove(filename)
+}
+
+func TestComponentLevels(t *testing.T) {
+	filename := "component.log"
+	levels := map[string]log.Level{"server": log.ErrorLevel}
+	logger := NewWithConfig(Config{Level: log.InfoLevel, FileName: &filename, JSON: true, ComponentLevels: levels})
+	nodeLogger := logger.WithField(FieldNodeID, "ffff")
+
+	nodeLogger.Component("server").Warn("should not be logged")
+	nodeLogger.Component("client").Info("client text here")
+
+	data, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, "client text here", entry["msg"])
+	assert.Equal(t, "client", entry[FieldComponent])
+	assert.Equal(t, "ffff", entry[FieldNodeID])
+
+	os.Remove(filename)
+}
+
+func TestRotateLogFile(t *testing.T) {
+	filename := "rotate.log"
+	logger := NewWithConfig(Config{Level: log.InfoLevel, FileName: &filename, MaxSize: 100, MaxBackups: 2})
+
+	for i := 0; i < 10; i++ {
+		logger.Info("rotate text here")
+	}
+
+	for _, name := range []string{filename, filename + ".1", filename + ".2"} {
+		file, err := os.Stat(name)
+		assert.NoError(t, err)
+		assert.True(t, file.Size() <= 100)
+	}
+
+	_, err := os.Stat(filename + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	os.Remove(filename)
+	os.Remove(filename + ".1")
+	os.Remove(filename + ".2")
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	os.Setenv(EnvLogLevel, "debug")
+	os.Setenv(EnvLogLevels, "server=error, client=warn,broken")
+	os.Setenv(EnvLogFile, "env.log")
+	os.Setenv(EnvLogJSON, "true")
+	os.Setenv(EnvLogMaxSize, "1024")
+	os.Setenv(EnvLogMaxBackups, "3")
+	defer func() {
+		for _, env := range []string{EnvLogLevel, EnvLogLevels, EnvLogFile, EnvLogJSON, EnvLogMaxSize, EnvLogMaxBackups} {
+			os.Unsetenv(env)
+		}
+	}()
+
+	config := ConfigFromEnv()
+	assert.Equal(t, log.DebugLevel, config.Level)
+	assert.Equal(t, map[string]log.Level{"server": log.ErrorLevel, "client": log.WarnLevel}, config.ComponentLevels)
+	assert.Equal(t, "env.log", *config.FileName)
+	assert.True(t, config.JSON)
+	assert.Equal(t, int64(1024), config.MaxSize)
+	assert.Equal(t, 3, config.MaxBackups)
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+
+	assert.NotPanics(t, func() {
+		logger.Info("nil info")
+		logger.WithField(FieldKey, "key").Debug("nil debug")
+		logger.Component("node").Warn("nil warning")
+	})
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an io.Writer appending to a file that is renamed to
+// `fileName.1` once it grows above `maxSize` bytes. Older files are shifted
+// to `fileName.2` and so on, keeping at most `maxBackups` of them.
+type rotatingFile struct {
+	mutex      sync.Mutex
+	fileName   string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// newRotatingFile opens `fileName` for appending
+func newRotatingFile(fileName string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rotatingFile := &rotatingFile{fileName: fileName, maxSize: maxSize, maxBackups: maxBackups}
+
+	err := rotatingFile.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return rotatingFile, nil
+}
+
+func (rotatingFile *rotatingFile) open() error {
+	file, err := os.OpenFile(rotatingFile.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rotatingFile.file = file
+	rotatingFile.size = info.Size()
+	return nil
+}
+
+// Write appends `data` to the file, rotating it first if `data` would
+// make it grow above the max size
+func (rotatingFile *rotatingFile) Write(data []byte) (int, error) {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+
+	if rotatingFile.size > 0 && rotatingFile.size+int64(len(data)) > rotatingFile.maxSize {
+		err := rotatingFile.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rotatingFile.file.Write(data)
+	rotatingFile.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts the backups and opens a new empty file
+func (rotatingFile *rotatingFile) rotate() error {
+	err := rotatingFile.file.Close()
+	if err != nil {
+		return err
+	}
+
+	if rotatingFile.maxBackups > 0 {
+		for i := rotatingFile.maxBackups - 1; i > 0; i-- {
+			os.Rename(rotatingFile.backupName(i), rotatingFile.backupName(i+1))
+		}
+		os.Rename(rotatingFile.fileName, rotatingFile.backupName(1))
+	} else {
+		os.Remove(rotatingFile.fileName)
+	}
+
+	return rotatingFile.open()
+}
+
+func (rotatingFile *rotatingFile) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", rotatingFile.fileName, i)
+}
@@ -0,0 +1,313 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	counterType   string = "counter"
+	gaugeType     string = "gauge"
+	histogramType string = "histogram"
+)
+
+// DefaultRegistry is the registry the kademlia metrics are registered in
+var DefaultRegistry = NewRegistry()
+
+// collector is implemented by every metric that can be written in the
+// Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry keeps a set of metrics and writes them in the Prometheus text format
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry returns a new instance of an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register adds the metric to the registry, replacing any metric with the same name
+func (registry *Registry) register(metric collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.collectors[metric.name()] = metric
+}
+
+// Write writes every metric in the registry sorted by name
+func (registry *Registry) Write(w io.Writer) {
+	registry.mutex.RLock()
+	names := make([]string, 0, len(registry.collectors))
+	for name := range registry.collectors {
+		names = append(names, name)
+	}
+	registry.mutex.RUnlock()
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		registry.mutex.RLock()
+		metric, exists := registry.collectors[name]
+		registry.mutex.RUnlock()
+
+		if exists {
+			metric.write(w)
+		}
+	}
+}
+
+// Handler returns an http.Handler serving the metrics of the registry
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		registry.Write(w)
+	})
+}
+
+// desc contains what every metric has in common
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (desc *desc) name() string {
+	return desc.metricName
+}
+
+func (desc *desc) writeHeader(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", desc.metricName, desc.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", desc.metricName, metricType)
+}
+
+// formatLabels returns the label pairs in the Prometheus text format
+func (desc *desc) formatLabels(labelValues []string, extra ...string) string {
+	pairs := []string{}
+	for i, label := range desc.labels {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		pairs = append(pairs, label+"="+strconv.Quote(value))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// key joins label values to a single map key
+func key(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// sortedKeys returns the keys of the map in a stable order
+func sortedKeys(values map[string][]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a value that can only increase, one for each combination of label values
+type Counter struct {
+	desc
+	mutex       sync.Mutex
+	values      map[string]float64
+	labelValues map[string][]string
+}
+
+// NewCounter creates a Counter and registers it in the registry
+func (registry *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	counter := &Counter{}
+	counter.desc = desc{name, help, labels}
+	counter.values = make(map[string]float64)
+	counter.labelValues = make(map[string][]string)
+	registry.register(counter)
+	return counter
+}
+
+// Inc increments the counter with the given label values by one
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add increases the counter with the given label values by `value`.
+// Negative values are ignored.
+func (counter *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	k := key(labelValues)
+	counter.values[k] += value
+	counter.labelValues[k] = labelValues
+}
+
+// Value returns the current value of the counter with the given label values
+func (counter *Counter) Value(labelValues ...string) float64 {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	return counter.values[key(labelValues)]
+}
+
+func (counter *Counter) write(w io.Writer) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	counter.writeHeader(w, counterType)
+	for _, k := range sortedKeys(counter.labelValues) {
+		fmt.Fprintf(w, "%s%s %s\n", counter.metricName, counter.formatLabels(counter.labelValues[k]), formatValue(counter.values[k]))
+	}
+}
+
+// Sample is a single value of a GaugeFunc with its label values
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// GaugeFunc is a value that can go up and down and is collected by calling
+// a function every time the metrics are written
+type GaugeFunc struct {
+	desc
+	collect func() []Sample
+}
+
+// NewGaugeFunc creates a GaugeFunc and registers it in the registry. `collect`
+// should return one Sample for each combination of label values.
+func (registry *Registry) NewGaugeFunc(name, help string, collect func() []Sample, labels ...string) *GaugeFunc {
+	gauge := &GaugeFunc{desc{name, help, labels}, collect}
+	registry.register(gauge)
+	return gauge
+}
+
+func (gauge *GaugeFunc) write(w io.Writer) {
+	gauge.writeHeader(w, gaugeType)
+	for _, sample := range gauge.collect() {
+		fmt.Fprintf(w, "%s%s %s\n", gauge.metricName, gauge.formatLabels(sample.LabelValues), formatValue(sample.Value))
+	}
+}
+
+// histogramValue contains the observations of a single combination of label values
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations in configurable buckets, one for each
+// combination of label values
+type Histogram struct {
+	desc
+	mutex       sync.Mutex
+	buckets     []float64
+	values      map[string]*histogramValue
+	labelValues map[string][]string
+}
+
+// DefaultBuckets are the default upper bounds of the buckets of a Histogram,
+// suitable for latencies in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NewHistogram creates a Histogram with the given bucket upper bounds and
+// registers it in the registry. DefaultBuckets are used if `buckets` is nil.
+func (registry *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	histogram := &Histogram{}
+	histogram.desc = desc{name, help, labels}
+	histogram.buckets = sorted
+	histogram.values = make(map[string]*histogramValue)
+	histogram.labelValues = make(map[string][]string)
+	registry.register(histogram)
+	return histogram
+}
+
+// Observe adds a single observation to the histogram with the given label values
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	k := key(labelValues)
+	observed, exists := histogram.values[k]
+	if !exists {
+		observed = &histogramValue{counts: make([]uint64, len(histogram.buckets))}
+		histogram.values[k] = observed
+		histogram.labelValues[k] = labelValues
+	}
+
+	for i, upperBound := range histogram.buckets {
+		if value <= upperBound {
+			observed.counts[i]++
+		}
+	}
+	observed.sum += value
+	observed.count++
+}
+
+// Count returns the number of observations with the given label values
+func (histogram *Histogram) Count(labelValues ...string) uint64 {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	observed, exists := histogram.values[key(labelValues)]
+	if !exists {
+		return 0
+	}
+	return observed.count
+}
+
+func (histogram *Histogram) write(w io.Writer) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	histogram.writeHeader(w, histogramType)
+	for _, k := range sortedKeys(histogram.labelValues) {
+		labelValues := histogram.labelValues[k]
+		observed := histogram.values[k]
+
+		for i, upperBound := range histogram.buckets {
+			labels := histogram.formatLabels(labelValues, "le", formatValue(upperBound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", histogram.metricName, labels, observed.counts[i])
+		}
+		labels := histogram.formatLabels(labelValues, "le", "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", histogram.metricName, labels, observed.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", histogram.metricName, histogram.formatLabels(labelValues), formatValue(observed.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", histogram.metricName, histogram.formatLabels(labelValues), observed.count)
+	}
+}
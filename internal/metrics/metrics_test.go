@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("rpcs_total", "Number of RPCs.", "type")
+
+	counter.Inc("PING")
+	counter.Inc("PING")
+	counter.Add(3, "STORE")
+	counter.Add(-1, "STORE")
+
+	assert.Equal(t, float64(2), counter.Value("PING"))
+	assert.Equal(t, float64(3), counter.Value("STORE"))
+	assert.Equal(t, float64(0), counter.Value("FIND_NODE"))
+
+	out := bytes.NewBuffer(nil)
+	registry.Write(out)
+	assert.Equal(t, `# HELP rpcs_total Number of RPCs.
+# TYPE rpcs_total counter
+rpcs_total{type="PING"} 2
+rpcs_total{type="STORE"} 3
+`, out.String())
+}
+
+func TestGaugeFunc(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGaugeFunc("keys", "Number of keys.", func() []Sample {
+		return []Sample{{nil, 4}}
+	})
+	registry.NewGaugeFunc("bucket_size", "Contacts in each bucket.", func() []Sample {
+		return []Sample{{[]string{"0"}, 1}, {[]string{"159"}, 5}}
+	}, "bucket")
+
+	out := bytes.NewBuffer(nil)
+	registry.Write(out)
+	assert.Equal(t, `# HELP bucket_size Contacts in each bucket.
+# TYPE bucket_size gauge
+bucket_size{bucket="0"} 1
+bucket_size{bucket="159"} 5
+# HELP keys Number of keys.
+# TYPE keys gauge
+keys 4
+`, out.String())
+}
+
+func TestHistogram(t *testing.T) {
+	registry := NewRegistry()
+	histogram := registry.NewHistogram("hops", "Hops of a lookup.", []float64{5, 1}, "lookup")
+
+	histogram.Observe(1, "node")
+	histogram.Observe(3, "node")
+	histogram.Observe(8, "node")
+
+	assert.Equal(t, uint64(3), histogram.Count("node"))
+	assert.Equal(t, uint64(0), histogram.Count("value"))
+
+	out := bytes.NewBuffer(nil)
+	registry.Write(out)
+	assert.Equal(t, `# HELP hops Hops of a lookup.
+# TYPE hops histogram
+hops_bucket{lookup="node",le="1"} 1
+hops_bucket{lookup="node",le="5"} 2
+hops_bucket{lookup="node",le="+Inf"} 3
+hops_sum{lookup="node"} 12
+hops_count{lookup="node"} 3
+`, out.String())
+}
+
+func TestRegisterReplacesMetric(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("total", "First.")
+	registry.NewCounter("total", "Second.")
+
+	out := bytes.NewBuffer(nil)
+	registry.Write(out)
+	assert.Equal(t, "# HELP total Second.\n# TYPE total counter\n", out.String())
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("total", "Total.").Inc()
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "text/plain; version=0.0.4", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "total 1\n")
+}
@@ -0,0 +1,323 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTraceFilename is the default filename of the file exporter
+	DefaultTraceFilename string = "kademlia-traces.json"
+	// DefaultOTLPEndpoint is the default OTLP/HTTP endpoint of a local collector
+	DefaultOTLPEndpoint string = "http://localhost:4318/v1/traces"
+	// BatchSize the largest number of spans sent in one OTLP request
+	BatchSize int = 64
+	// BatchInterval the longest time a span waits before it is sent
+	BatchInterval = time.Second
+)
+
+// Environment variables read by ExporterFromEnv
+const (
+	EnvTraceExporter string = "KADEMLIA_TRACE_EXPORTER"
+	EnvTraceFile     string = "KADEMLIA_TRACE_FILE"
+	EnvTraceEndpoint string = "KADEMLIA_TRACE_ENDPOINT"
+)
+
+const (
+	errUnknownExporter = "unknown trace exporter"
+	errQueueFull       = "span queue is full"
+	errExporterClosed  = "exporter is closed"
+)
+
+// WriterExporter writes every span as a line of OTLP JSON, the format read
+// by the OpenTelemetry collector's otlpjsonfile receiver
+type WriterExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewWriterExporter creates an exporter writing to `writer`
+func NewWriterExporter(writer io.Writer) *WriterExporter {
+	return &WriterExporter{writer: writer}
+}
+
+// NewFileExporter creates an exporter appending to the file `fileName`
+func NewFileExporter(fileName string) (*WriterExporter, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterExporter(file), nil
+}
+
+// Export writes `span` to the writer
+func (exporter *WriterExporter) Export(span *Span) error {
+	data, err := json.Marshal(newExportRequest([]*Span{span}))
+	if err != nil {
+		return err
+	}
+
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	_, err = exporter.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the writer if it is a closer other than stdout or stderr
+func (exporter *WriterExporter) Close() error {
+	if closer, ok := exporter.writer.(io.Closer); ok && closer != os.Stdout && closer != os.Stderr {
+		return closer.Close()
+	}
+	return nil
+}
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector
+// using the OTLP/HTTP JSON protocol
+type OTLPExporter struct {
+	mutex    sync.Mutex
+	endpoint string
+	client   *http.Client
+	spans    chan *Span
+	done     chan struct{}
+	closed   bool
+}
+
+// NewOTLPExporter creates an exporter posting spans to `endpoint`
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	exporter := &OTLPExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		spans:    make(chan *Span, BatchSize*16),
+		done:     make(chan struct{}),
+	}
+	go exporter.run()
+
+	return exporter
+}
+
+// Export queues `span` to be sent in the next batch. Returns an error if the queue is full.
+func (exporter *OTLPExporter) Export(span *Span) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	if exporter.closed {
+		return errors.New(errExporterClosed)
+	}
+
+	select {
+	case exporter.spans <- span:
+		return nil
+	default:
+		return errors.New(errQueueFull)
+	}
+}
+
+// Close sends the queued spans and stops the exporter
+func (exporter *OTLPExporter) Close() error {
+	exporter.mutex.Lock()
+	if !exporter.closed {
+		exporter.closed = true
+		close(exporter.spans)
+	}
+	exporter.mutex.Unlock()
+
+	<-exporter.done
+	return nil
+}
+
+func (exporter *OTLPExporter) run() {
+	defer close(exporter.done)
+
+	ticker := time.NewTicker(BatchInterval)
+	defer ticker.Stop()
+
+	batch := []*Span{}
+	for {
+		select {
+		case span, ok := <-exporter.spans:
+			if !ok {
+				exporter.send(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= BatchSize {
+				exporter.send(batch)
+				batch = []*Span{}
+			}
+		case <-ticker.C:
+			exporter.send(batch)
+			batch = []*Span{}
+		}
+	}
+}
+
+// send posts `batch` to the collector, dropping it if the collector fails
+func (exporter *OTLPExporter) send(batch []*Span) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(newExportRequest(batch))
+	if err != nil {
+		return err
+	}
+
+	resp, err := exporter.client.Post(exporter.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector replied %s", resp.Status)
+	}
+	return nil
+}
+
+// ExporterFromEnv returns the exporter chosen by KADEMLIA_TRACE_EXPORTER, one of
+// "stdout", "file" or "otlp". Returns nil if tracing is not enabled.
+func ExporterFromEnv() (Exporter, error) {
+	switch os.Getenv(EnvTraceExporter) {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return NewWriterExporter(os.Stdout), nil
+	case "file":
+		fileName := os.Getenv(EnvTraceFile)
+		if fileName == "" {
+			fileName = DefaultTraceFilename
+		}
+		return NewFileExporter(fileName)
+	case "otlp":
+		endpoint := os.Getenv(EnvTraceEndpoint)
+		if endpoint == "" {
+			endpoint = DefaultOTLPEndpoint
+		}
+		return NewOTLPExporter(endpoint), nil
+	default:
+		return nil, errors.New(errUnknownExporter)
+	}
+}
+
+// The types below follow the JSON encoding of the OTLP
+// ExportTraceServiceRequest message
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes"`
+	Status            status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// OTLP status codes
+const (
+	statusOK    int = 1
+	statusError int = 2
+)
+
+// newExportRequest groups `spans` by their tracer
+func newExportRequest(spans []*Span) exportRequest {
+	request := exportRequest{[]resourceSpans{}}
+	tracers := make(map[*Tracer]int)
+
+	for _, span := range spans {
+		i, exists := tracers[span.tracer]
+		if !exists {
+			i = len(request.ResourceSpans)
+			tracers[span.tracer] = i
+			request.ResourceSpans = append(request.ResourceSpans, resourceSpans{
+				Resource: resource{[]keyValue{
+					{"service.name", anyValue{span.tracer.service}},
+					{"service.instance.id", anyValue{span.tracer.instance}},
+				}},
+				ScopeSpans: []scopeSpans{{scope{"kademlia"}, []otlpSpan{}}},
+			})
+		}
+
+		scopeSpans := &request.ResourceSpans[i].ScopeSpans[0]
+		scopeSpans.Spans = append(scopeSpans.Spans, newOTLPSpan(span))
+	}
+
+	return request
+}
+
+func newOTLPSpan(span *Span) otlpSpan {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	otlpSpan := otlpSpan{
+		TraceID:           span.Context.TraceID,
+		SpanID:            span.Context.SpanID,
+		ParentSpanID:      span.ParentSpanID,
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		Attributes:        []keyValue{},
+		Status:            status{Code: statusOK},
+	}
+
+	for key, value := range span.Attributes {
+		otlpSpan.Attributes = append(otlpSpan.Attributes, keyValue{key, anyValue{value}})
+	}
+	sort.Slice(otlpSpan.Attributes, func(i, j int) bool {
+		return otlpSpan.Attributes[i].Key < otlpSpan.Attributes[j].Key
+	})
+
+	if span.Err != "" {
+		otlpSpan.Status = status{statusError, span.Err}
+	}
+
+	return otlpSpan
+}
@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// TraceIDLength the number of bytes in a trace ID
+	TraceIDLength int = 16
+	// SpanIDLength the number of bytes in a span ID
+	SpanIDLength int = 8
+)
+
+// SpanKind describes the relationship between a span and its parent,
+// using the values of the OpenTelemetry protocol
+type SpanKind int
+
+// SpanKind declaration
+const (
+	Internal = SpanKind(1)
+	Server   = SpanKind(2)
+	Client   = SpanKind(3)
+)
+
+// SpanContext identifies a span across nodes. It is sent in RPCs so that the
+// receiving node can record its spans as children of the sending span.
+type SpanContext struct {
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+// Valid returns true if the IDs of the SpanContext are hex strings of the right length
+func (spanContext *SpanContext) Valid() bool {
+	return spanContext != nil &&
+		validID(spanContext.TraceID, TraceIDLength) &&
+		validID(spanContext.SpanID, SpanIDLength)
+}
+
+func validID(id string, length int) bool {
+	bytes, err := hex.DecodeString(id)
+	return err == nil && len(bytes) == length
+}
+
+// Exporter sends finished spans somewhere they can be inspected
+type Exporter interface {
+	Export(span *Span) error
+	Close() error
+}
+
+// Tracer creates spans and hands them to its exporter when they end.
+// A nil Tracer creates nil spans which record nothing.
+type Tracer struct {
+	service  string
+	instance string
+	exporter Exporter
+}
+
+// NewTracer creates a tracer for the node `instance` running `service`
+func NewTracer(service string, instance string, exporter Exporter) *Tracer {
+	return &Tracer{service, instance, exporter}
+}
+
+// Start starts a span called `name`. If `parent` is nil the span starts a new trace.
+func (tracer *Tracer) Start(name string, kind SpanKind, parent *SpanContext) *Span {
+	if tracer == nil {
+		return nil
+	}
+
+	span := &Span{
+		tracer:     tracer,
+		Name:       name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]string),
+	}
+
+	if parent.Valid() {
+		span.Context.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.Context.TraceID = randomID(TraceIDLength)
+	}
+	span.Context.SpanID = randomID(SpanIDLength)
+
+	return span
+}
+
+// Close closes the exporter of the tracer, flushing any spans it holds
+func (tracer *Tracer) Close() error {
+	if tracer == nil {
+		return nil
+	}
+	return tracer.exporter.Close()
+}
+
+// Span is a single timed operation of a trace. All methods are safe
+// to call on a nil Span.
+type Span struct {
+	tracer       *Tracer
+	mutex        sync.Mutex
+	Name         string
+	Kind         SpanKind
+	Context      SpanContext
+	ParentSpanID string
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]string
+	Err          string
+}
+
+// Start starts a child span of `span` called `name`
+func (span *Span) Start(name string, kind SpanKind) *Span {
+	if span == nil {
+		return nil
+	}
+	return span.tracer.Start(name, kind, &span.Context)
+}
+
+// SpanContext returns the context to send to other nodes, or nil for a nil span
+func (span *Span) SpanContext() *SpanContext {
+	if span == nil {
+		return nil
+	}
+	spanContext := span.Context
+	return &spanContext
+}
+
+// TraceID returns the ID of the trace the span belongs to
+func (span *Span) TraceID() string {
+	if span == nil {
+		return ""
+	}
+	return span.Context.TraceID
+}
+
+// SetAttribute sets the attribute `key` of the span to `value`
+func (span *Span) SetAttribute(key string, value string) {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	span.Attributes[key] = value
+}
+
+// SetError marks the span as failed with `err`. A nil `err` is ignored.
+func (span *Span) SetError(err error) {
+	if span == nil || err == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	span.Err = err.Error()
+}
+
+// End ends the span and exports it
+func (span *Span) End() {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	span.EndTime = time.Now()
+	span.mutex.Unlock()
+
+	span.tracer.exporter.Export(span)
+}
+
+func randomID(length int) string {
+	bytes := make([]byte, length)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,159 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartSpans(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	tracer := NewTracer("kademlia", "node1", NewWriterExporter(buffer))
+
+	root := tracer.Start("FindValue", Internal, nil)
+	child := root.Start("FIND_VALUE", Client)
+
+	assert.True(t, root.SpanContext().Valid())
+	assert.Equal(t, "", root.ParentSpanID)
+	assert.Equal(t, root.TraceID(), child.TraceID())
+	assert.Equal(t, root.Context.SpanID, child.ParentSpanID)
+	assert.NotEqual(t, root.Context.SpanID, child.Context.SpanID)
+
+	remote := tracer.Start("handle FIND_VALUE", Server, child.SpanContext())
+	assert.Equal(t, root.TraceID(), remote.TraceID())
+	assert.Equal(t, child.Context.SpanID, remote.ParentSpanID)
+
+	other := tracer.Start("FindValue", Internal, nil)
+	assert.NotEqual(t, root.TraceID(), other.TraceID())
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+
+	span := tracer.Start("NodeLookup", Internal, nil)
+	assert.Nil(t, span)
+
+	assert.NotPanics(t, func() {
+		child := span.Start("FIND_NODE", Client)
+		child.SetAttribute("key", "value")
+		child.SetError(errors.New("error"))
+		child.End()
+		span.End()
+	})
+	assert.Nil(t, span.SpanContext())
+	assert.Equal(t, "", span.TraceID())
+	assert.NoError(t, tracer.Close())
+}
+
+func TestValidSpanContext(t *testing.T) {
+	var spanContext *SpanContext
+	assert.False(t, spanContext.Valid())
+
+	assert.True(t, (&SpanContext{randomID(TraceIDLength), randomID(SpanIDLength)}).Valid())
+	assert.False(t, (&SpanContext{randomID(SpanIDLength), randomID(SpanIDLength)}).Valid())
+	assert.False(t, (&SpanContext{"not hex", randomID(SpanIDLength)}).Valid())
+	assert.False(t, (&SpanContext{randomID(TraceIDLength), ""}).Valid())
+
+	// an invalid parent starts a new trace
+	span := NewTracer("kademlia", "node1", NewWriterExporter(ioutil.Discard)).Start("a", Server, &SpanContext{"bad", "bad"})
+	assert.True(t, span.SpanContext().Valid())
+	assert.Equal(t, "", span.ParentSpanID)
+}
+
+func TestWriterExporter(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	tracer := NewTracer("kademlia", "node1", NewWriterExporter(buffer))
+
+	span := tracer.Start("FindValue", Internal, nil)
+	span.SetAttribute("kademlia.key", "ffff")
+	span.SetError(errors.New("no value found"))
+	span.End()
+
+	request := exportRequest{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &request))
+	assert.Equal(t, 1, len(request.ResourceSpans))
+
+	resource := request.ResourceSpans[0].Resource
+	assert.Equal(t, []keyValue{{"service.name", anyValue{"kademlia"}}, {"service.instance.id", anyValue{"node1"}}}, resource.Attributes)
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, span.TraceID(), spans[0].TraceID)
+	assert.Equal(t, "FindValue", spans[0].Name)
+	assert.Equal(t, Internal, spans[0].Kind)
+	assert.Equal(t, []keyValue{{"kademlia.key", anyValue{"ffff"}}}, spans[0].Attributes)
+	assert.Equal(t, status{statusError, "no value found"}, spans[0].Status)
+}
+
+func TestFileExporter(t *testing.T) {
+	filename := "traces.json"
+	exporter, err := NewFileExporter(filename)
+	assert.NoError(t, err)
+
+	tracer := NewTracer("kademlia", "node1", exporter)
+	tracer.Start("NodeLookup", Internal, nil).End()
+	tracer.Start("StoreValue", Internal, nil).End()
+	assert.NoError(t, tracer.Close())
+
+	data, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")))
+
+	os.Remove(filename)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan exportRequest, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := exportRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		requests <- request
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer("kademlia", "node1", NewOTLPExporter(collector.URL))
+	span := tracer.Start("NodeLookup", Internal, nil)
+	span.Start("FIND_NODE", Client).End()
+	span.End()
+	assert.NoError(t, tracer.Close())
+
+	spans := 0
+	for len(requests) > 0 {
+		request := <-requests
+		spans += len(request.ResourceSpans[0].ScopeSpans[0].Spans)
+	}
+	assert.Equal(t, 2, spans)
+
+	assert.Error(t, tracer.exporter.Export(span))
+}
+
+func TestExporterFromEnv(t *testing.T) {
+	defer os.Unsetenv(EnvTraceExporter)
+
+	exporter, err := ExporterFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	os.Setenv(EnvTraceExporter, "stdout")
+	exporter, err = ExporterFromEnv()
+	assert.NoError(t, err)
+	assert.IsType(t, &WriterExporter{}, exporter)
+
+	os.Setenv(EnvTraceExporter, "otlp")
+	exporter, err = ExporterFromEnv()
+	assert.NoError(t, err)
+	assert.IsType(t, &OTLPExporter{}, exporter)
+	exporter.Close()
+
+	os.Setenv(EnvTraceExporter, "unknown")
+	_, err = ExporterFromEnv()
+	assert.EqualError(t, err, errUnknownExporter)
+}